@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2" // core
 
@@ -15,16 +18,21 @@ func main() {
 
 	app := awscdk.NewApp(nil)
 
-	stack.NewFrontendStack(app, "FrontendStack", &stack.FrontendStackProps{
+	security := stack.NewSecurityStack(app, "SecurityStack", &stack.SecurityStackProps{
 		Props: awscdk.StackProps{
 			Env: env(),
 		},
+
+		AllowedIpAddresses: contextList(app, "wafAllowedIps"),
+		BlockedIpAddresses: contextList(app, "wafBlockedIps"),
 	})
 
 	images := stack.NewStorageStack(app, "StorageStack", &stack.StorageStackProps{
 		Props: awscdk.StackProps{
 			Env: env(),
 		},
+
+		FrontendOrigins: contextList(app, "frontendOrigins"),
 	})
 
 	network := stack.NewNetworkStack(app, "NetworkStack", &stack.NetworkStackProps{
@@ -41,26 +49,77 @@ func main() {
 		LambdaSecretsManagerSecurityGroup: network.LambdaSecretsManagerSecurityGroup,
 	})
 
-	stack.NewApiStack(app, "ApiStack", &stack.ApiStackProps{
+	// the bastion owns the vpc's s3 gateway endpoint, which the api and jobs lambdas use too
+	bastion := stack.NewBastionStack(app, "BastionStack", &stack.BastionStackProps{
+		StackProps: awscdk.StackProps{
+			Env: env(),
+		},
+
+		Vpc:             database.Vpc,
+		DbSecurityGroup: database.DbSecurityGroup,
+	})
+
+	auth := stack.NewAuthStack(app, "AuthStack", &stack.AuthStackProps{
 		Props: awscdk.StackProps{
 			Env: env(),
 		},
-		ImagesBucket: images.Bucket,
+
+		AllowedEmailDomains: contextList(app, "allowedEmailDomains"),
+		Database:            database.Access(),
+	})
+
+	api := stack.NewApiStack(app, "ApiStack", &stack.ApiStackProps{
+		Props: awscdk.StackProps{
+			Env: env(),
+		},
+		ImagesBucket:  images.Bucket,
+		ImportsBucket: images.ImportsBucket,
+		ExportsBucket: images.ExportsBucket,
 
 		Vpc:                               database.Vpc,
 		LambdaSecretsManagerSecurityGroup: database.LambdaSecretsManagerSecurityGroup,
 		DbInstance:                        database.DbInstance,
 		ProxyEndpoint:                     database.ProxyEndpoint,
 		LambdaSecurityGroup:               database.LambdaSecurityGroup,
+		DataKey:                           database.DataKey,
+		BlindIndexSecret:                  database.BlindIndexSecret,
+		LambdaS3SecurityGroup:             network.LambdaS3SecurityGroup,
+		S3Endpoint:                        bastion.S3Endpoint,
+
+		WebAclArn: security.ApiWebAcl.AttrArn(),
+
+		UserPool:       auth.UserPool,
+		UserPoolClient: auth.UserPoolClient,
 	})
 
-	stack.NewBastionStack(app, "BastionStack", &stack.BastionStackProps{
-		StackProps: awscdk.StackProps{
+	// after the api and storage stacks since config.json is built from their outputs
+	stack.NewFrontendStack(app, "FrontendStack", &stack.FrontendStackProps{
+		Props: awscdk.StackProps{
 			Env: env(),
 		},
 
-		Vpc:             database.Vpc,
-		DbSecurityGroup: database.DbSecurityGroup,
+		PreviewDomainName:     contextString(app, "previewDomainName"),
+		PreviewCertificateArn: contextString(app, "previewCertificateArn"),
+		PreviewExpirationDays: contextNumber(app, "previewExpirationDays"),
+
+		WebAclArn: security.FrontendWebAcl.AttrArn(),
+
+		ApiEndpoint:      api.ApiUrl,
+		ImageDomainName:  images.ImageDistribution.DomainName(),
+		UserPoolId:       auth.UserPool.UserPoolId(),
+		UserPoolClientId: auth.UserPoolClient.UserPoolClientId(),
+	})
+
+	stack.NewJobsStack(app, "JobsStack", &stack.JobsStackProps{
+		Props: awscdk.StackProps{
+			Env: env(),
+		},
+
+		Database: database.Access(),
+
+		ImportsBucket:         images.ImportsBucket,
+		LambdaS3SecurityGroup: network.LambdaS3SecurityGroup,
+		S3Endpoint:            bastion.S3Endpoint,
 	})
 
 	app.Synth(nil)
@@ -92,3 +151,47 @@ func env() *awscdk.Environment {
 		Region:  jsii.String(os.Getenv("CDK_DEFAULT_REGION")),
 	}
 }
+
+// contextString reads a value set in cdk.json "context" or passed with `cdk deploy -c key=value`,
+// returning "" when it isn't set.
+func contextString(app awscdk.App, key string) string {
+	value := app.Node().TryGetContext(jsii.String(key))
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// contextList reads a list from cdk.json context, or a comma separated value passed with -c.
+func contextList(app awscdk.App, key string) []string {
+	switch value := app.Node().TryGetContext(jsii.String(key)).(type) {
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	case string:
+		if value == "" {
+			return nil
+		}
+		return strings.Split(value, ",")
+	}
+	return nil
+}
+
+// contextNumber is contextString for numbers, values from -c arrive as strings
+// while the ones in cdk.json are already numbers.
+func contextNumber(app awscdk.App, key string) float64 {
+	switch value := app.Node().TryGetContext(jsii.String(key)).(type) {
+	case float64:
+		return value
+	case string:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			panic(fmt.Sprintf("context %s must be a number, got %q", key, value))
+		}
+		return number
+	}
+	return 0
+}
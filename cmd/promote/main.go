@@ -0,0 +1,73 @@
+// Command promote copies a frontend build from the /main origin path to /production
+// by invoking the PromoteFrontend lambda in FrontendStack.
+//
+//	go run ./cmd/promote -build <git sha>
+//	go run ./cmd/promote -history
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+func main() {
+	build := flag.String("build", "", "build id (manifest buildId) currently in /main to promote")
+	prune := flag.Bool("prune", false, "delete files in /production that aren't part of the build")
+	showHistory := flag.Bool("history", false, "list recent promotions instead of promoting")
+	function := flag.String("function", "PromoteFrontend", "name of the promotion lambda")
+	by := flag.String("by", os.Getenv("USER"), "who is promoting, recorded in the history")
+	flag.Parse()
+
+	payload := map[string]any{"action": "history"}
+	if !*showHistory {
+		if *build == "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		payload = map[string]any{
+			"action":     "promote",
+			"buildId":    *build,
+			"promotedBy": *by,
+			"prune":      *prune,
+		}
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("loading aws config: %v", err)
+	}
+
+	body, _ := json.Marshal(payload)
+	out, err := lambda.NewFromConfig(cfg).Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(*function),
+		Payload:      body,
+	})
+	if err != nil {
+		log.Fatalf("invoking %s: %v", *function, err)
+	}
+
+	// errors returned by the handler come back as a 200 with FunctionError set
+	if out.FunctionError != nil {
+		var lambdaErr struct {
+			Message string `json:"errorMessage"`
+		}
+		json.Unmarshal(out.Payload, &lambdaErr)
+		log.Fatalf("promotion failed: %s", lambdaErr.Message)
+	}
+
+	var result any
+	if err := json.Unmarshal(out.Payload, &result); err != nil {
+		log.Fatalf("reading response: %v", err)
+	}
+	pretty, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(pretty))
+}
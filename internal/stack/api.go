@@ -1,12 +1,22 @@
 package stack
 
 import (
+	"strings"
+
 	"github.com/aws/aws-cdk-go/awscdk/v2" // core
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudfront"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudfrontorigins"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudwatch"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awskms"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsrds"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssecretsmanager"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigatewayv2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigatewayv2authorizers"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigatewayv2integrations"
 
 	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
@@ -18,6 +28,10 @@ import (
 type ApiStackProps struct {
 	Props        awscdk.StackProps
 	ImagesBucket awss3.IBucket
+	// ImportsBucket is where member form exports are uploaded
+	ImportsBucket awss3.IBucket
+	// ExportsBucket is where student data archives are written
+	ExportsBucket awss3.IBucket
 
 	// DatabaseStackData DatabaseStack
 	Vpc                               awsec2.Vpc
@@ -25,9 +39,32 @@ type ApiStackProps struct {
 	DbInstance                        awsrds.DatabaseInstance
 	ProxyEndpoint                     *string
 	LambdaSecurityGroup               awsec2.SecurityGroup
+	DataKey                           awskms.Key
+	BlindIndexSecret                  awssecretsmanager.Secret
+	// LambdaS3SecurityGroup is for functions in the vpc that also use S3, which they
+	// reach through S3Endpoint
+	LambdaS3SecurityGroup awsec2.SecurityGroup
+	S3Endpoint            awsec2.IGatewayVpcEndpoint
+
+	// WebAclArn is attached to the distribution in front of the api (optional)
+	WebAclArn *string
+
+	// tokens from this pool/client are required on every route that isn't public
+	UserPool       awscognito.IUserPool
+	UserPoolClient awscognito.IUserPoolClient
 }
 
-func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) awscdk.Stack {
+type ApiStack struct {
+	Stack   awscdk.Stack
+	HttpApi awsapigatewayv2.HttpApi
+
+	// Distribution fronts HttpApi so requests go through WAF, ApiUrl is its https url
+	// and what clients should be using instead of the execute-api endpoint
+	Distribution awscloudfront.Distribution
+	ApiUrl       *string
+}
+
+func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) *ApiStack {
 	var sprops awscdk.StackProps
 	if props != nil {
 		sprops = props.Props
@@ -38,11 +75,57 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 	//  =======================================
 	// Api Creation
 	//  =======================================
+	// every route needs a valid cognito token (id or access) unless it opts out with
+	// publicRoute, the claims reach the lambdas in requestContext.authorizer.jwt
+	jwtAuthorizer := awsapigatewayv2authorizers.NewHttpJwtAuthorizer(
+		jsii.String("CognitoAuthorizer"),
+		jsii.String("https://cognito-idp."+*stack.Region()+".amazonaws.com/"+*props.UserPool.UserPoolId()),
+		&awsapigatewayv2authorizers.HttpJwtAuthorizerProps{
+			AuthorizerName: jsii.String("CognitoAuthorizer"),
+			JwtAudience:    &[]*string{props.UserPoolClient.UserPoolClientId()},
+		},
+	)
+
 	// create HTTP API
 	httpApi := awsapigatewayv2.NewHttpApi(stack, jsii.String("ClubEventApi"), &awsapigatewayv2.HttpApiProps{
-		ApiName: jsii.String("ClubEventApi"),
+		ApiName:           jsii.String("ClubEventApi"),
+		DefaultAuthorizer: jwtAuthorizer,
+		// preflight requests are answered by API Gateway before the authorizer runs
+		CorsPreflight: &awsapigatewayv2.CorsPreflightOptions{
+			AllowOrigins: jsii.Strings("*"),
+			AllowHeaders: jsii.Strings("Authorization", "Content-Type", "If-Match", "Idempotency-Key"),
+			AllowMethods: &[]awsapigatewayv2.CorsHttpMethod{
+				awsapigatewayv2.CorsHttpMethod_GET,
+				awsapigatewayv2.CorsHttpMethod_POST,
+				awsapigatewayv2.CorsHttpMethod_PUT,
+				awsapigatewayv2.CorsHttpMethod_PATCH,
+				awsapigatewayv2.CorsHttpMethod_DELETE,
+			},
+			// event edits are made against the version in the ETag, see lambda/events
+			ExposeHeaders: jsii.Strings("ETag"),
+			MaxAge:        awscdk.Duration_Hours(jsii.Number(1)),
+		},
 	})
 
+	publicRoute := awsapigatewayv2.NewHttpNoneAuthorizer()
+
+	// WAF can't be attached to HTTP APIs, not even a regional web ACL, so the CloudFront
+	// scoped ACL on ClubEventApiCdn (see SecurityStack) stands in for it. That only
+	// works if nothing reaches the api around the distribution. The execute-api endpoint
+	// can't be disabled since it's the distribution's origin, so CloudFront sends this
+	// secret in apiutils.OriginHeader and every lambda behind a route rejects requests
+	// without it (apiutils.CheckOrigin). addLambdaRoutes hands it to the functions.
+	originSecret := awssecretsmanager.NewSecret(stack, jsii.String("ApiOriginSecret"), &awssecretsmanager.SecretProps{
+		Description: jsii.String("Header value ClubEventApiCdn proves requests came through it with"),
+		GenerateSecretString: &awssecretsmanager.SecretStringGenerator{
+			PasswordLength:     jsii.Number(64),
+			ExcludePunctuation: jsii.Bool(true),
+		},
+	})
+	// resolved by CloudFormation at deploy time, it's in the distribution and function
+	// configs but not the template
+	originVerify := originSecret.SecretValue().UnsafeUnwrap()
+
 	//  =======================================
 	//  Test ping and s3 image storage test
 	//  =======================================
@@ -53,32 +136,25 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 	})
 
 	// add route to HTTP API
-	httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
-		Path:    jsii.String("/pingTest"),
-		Methods: &[]awsapigatewayv2.HttpMethod{awsapigatewayv2.HttpMethod_GET},
-		Integration: awsapigatewayv2integrations.NewHttpLambdaIntegration(
-			jsii.String("PingLambdaIntegration"),
-			pingFunc,
-			&awsapigatewayv2integrations.HttpLambdaIntegrationProps{},
-		),
-	})
+	addAuthorizedLambdaRoutes(httpApi, originVerify, "PingLambdaIntegration", pingFunc, publicRoute,
+		"GET /pingTest",
+	)
 
 	// create presign lambda function
 	presignFunc := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("Presign Function"), &awscdklambdagoalpha.GoFunctionProps{
 		FunctionName: jsii.String("S3Presign"),
 		Entry:        jsii.String("./lambda/presign/main.go"),
+		Environment: &map[string]*string{
+			"IMAGE_BUCKET_NAME": props.ImagesBucket.BucketName(),
+		},
 	})
+	// presigned urls are signed with the function's role, so it needs to be able to put
+	props.ImagesBucket.GrantPut(presignFunc, jsii.String("uploads/*"))
 
 	// add route to HTTP API
-	httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
-		Path:    jsii.String("/presign"),
-		Methods: &[]awsapigatewayv2.HttpMethod{awsapigatewayv2.HttpMethod_GET},
-		Integration: awsapigatewayv2integrations.NewHttpLambdaIntegration(
-			jsii.String("PresignOptionsIntegration"),
-			presignFunc,
-			&awsapigatewayv2integrations.HttpLambdaIntegrationProps{},
-		),
-	})
+	presignRoutes := addLambdaRoutes(httpApi, originVerify, "PresignOptionsIntegration", presignFunc,
+		"GET /presign",
+	)
 
 	//  =======================================
 	//  Lamnds to rds
@@ -109,21 +185,405 @@ func NewApiStack(scope constructs.Construct, id string, props *ApiStackProps) aw
 	dbInstance.Secret().
 		GrantRead(dbTestFunction, nil)
 
-	httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
-		Path:    jsii.String("/database/test"),
-		Methods: &[]awsapigatewayv2.HttpMethod{awsapigatewayv2.HttpMethod_GET},
-		Integration: awsapigatewayv2integrations.NewHttpLambdaIntegration(
-			jsii.String("DBTestIntegration"),
-			dbTestFunction,
-			&awsapigatewayv2integrations.HttpLambdaIntegrationProps{},
-		),
+	addLambdaRoutes(httpApi, originVerify, "DBTestIntegration", dbTestFunction,
+		"GET /database/test",
+	)
+
+	//  =======================================
+	//  Students
+	//  =======================================
+	db := DatabaseAccess{
+		Vpc:                               vpc,
+		LambdaSecretsManagerSecurityGroup: lambdaSecretsManagerSecurityGroup,
+		LambdaSecurityGroup:               lambdaSecurityGroup,
+		DbInstance:                        dbInstance,
+		ProxyEndpoint:                     proxyEndpoint,
+		DataKey:                           props.DataKey,
+		BlindIndexSecret:                  props.BlindIndexSecret,
+	}
+
+	studentsFunc := newDatabaseFunction(stack, "Students Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("Students"),
+		Entry:        jsii.String("./lambda/students/main.go"),
+	})
+	addLambdaRoutes(httpApi, originVerify, "StudentsIntegration", studentsFunc,
+		"GET /students/me",
+		"PATCH /students/me",
+		"PUT /students/me/interests",
+		"GET /students",
+		"GET /students/{studentId}",
+		"GET /interests",
+		"GET /students/duplicates",
+		"POST /students/{studentId}/merge",
+		"GET /students/merges",
+	)
+
+	//  =======================================
+	//  Clubs
+	//  =======================================
+	clubsFunc := newDatabaseFunction(stack, "Clubs Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("Clubs"),
+		Entry:        jsii.String("./lambda/clubs/main.go"),
+		Environment: &map[string]*string{
+			"IMAGE_BUCKET_NAME": props.ImagesBucket.BucketName(),
+		},
+	})
+	props.ImagesBucket.GrantPut(clubsFunc, jsii.String("clubs/*"))
+	addLambdaRoutes(httpApi, originVerify, "ClubsIntegration", clubsFunc,
+		"GET /clubs",
+		"POST /clubs",
+		"GET /clubs/{clubId}",
+		"PATCH /clubs/{clubId}",
+		"GET /clubs/{clubId}/icon-upload",
+		"GET /clubs/{clubId}/members",
+		"POST /clubs/{clubId}/members",
+		"DELETE /clubs/{clubId}/members/me",
+		"DELETE /clubs/{clubId}/members/{studentId}",
+		"PUT /clubs/{clubId}/members/{studentId}/role",
+	)
+
+	//  =======================================
+	//  Events
+	//  =======================================
+	eventsFunc := newDatabaseFunction(stack, "Events Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("Events"),
+		Entry:        jsii.String("./lambda/events/main.go"),
+	})
+	addLambdaRoutes(httpApi, originVerify, "EventsIntegration", eventsFunc,
+		"GET /events",
+		"POST /events",
+		"GET /events/{eventId}",
+		"PATCH /events/{eventId}",
+		"DELETE /events/{eventId}",
+		"POST /events/{eventId}/publish",
+		"GET /events/{eventId}/versions",
+		"GET /events/{eventId}/diff",
+		"POST /events/{eventId}/revert",
+		"GET /events/{eventId}/cohosts",
+		"POST /events/{eventId}/cohosts",
+		"DELETE /events/{eventId}/cohosts/{clubId}",
+		"GET /clubs/{clubId}/invitations",
+		"POST /clubs/{clubId}/invitations/{invitationId}/accept",
+		"POST /clubs/{clubId}/invitations/{invitationId}/decline",
+		"GET /clubs/{clubId}/events",
+	)
+
+	//  =======================================
+	//  RSVPs
+	//  =======================================
+	rsvpsFunc := newDatabaseFunction(stack, "RSVPs Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("EventRsvps"),
+		Entry:        jsii.String("./lambda/rsvps/main.go"),
+	})
+	addLambdaRoutes(httpApi, originVerify, "RsvpsIntegration", rsvpsFunc,
+		"GET /events/{eventId}/rsvp",
+		"PUT /events/{eventId}/rsvp",
+		"PUT /events/{eventId}/capacity",
+		"GET /events/{eventId}/attendees",
+		"GET /events/{eventId}/catering",
+	)
+
+	//  =======================================
+	//  Check-in and points
+	//  =======================================
+	// signs the check-in QR codes, rotating it invalidates every code that's been handed out
+	checkinSecret := awssecretsmanager.NewSecret(stack, jsii.String("CheckinSigningKey"), &awssecretsmanager.SecretProps{
+		Description: jsii.String("HMAC key for event check-in tokens"),
+		GenerateSecretString: &awssecretsmanager.SecretStringGenerator{
+			PasswordLength:     jsii.Number(64),
+			ExcludePunctuation: jsii.Bool(true),
+		},
+	})
+
+	checkinFunc := newDatabaseFunction(stack, "Checkin Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("EventCheckin"),
+		Entry:        jsii.String("./lambda/checkin/main.go"),
+		Environment: &map[string]*string{
+			"CHECKIN_SECRET_ARN": checkinSecret.SecretArn(),
+		},
+	})
+	checkinSecret.GrantRead(checkinFunc, nil)
+	addLambdaRoutes(httpApi, originVerify, "CheckinIntegration", checkinFunc,
+		"GET /events/{eventId}/checkin-token",
+		"POST /checkin",
+		"GET /events/{eventId}/checkins",
+		"PUT /events/{eventId}/point-source",
+		"GET /point-sources",
+		"POST /point-sources",
+	)
+
+	pointsFunc := newDatabaseFunction(stack, "Points Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("StudentPoints"),
+		Entry:        jsii.String("./lambda/points/main.go"),
+	})
+	addLambdaRoutes(httpApi, originVerify, "PointsIntegration", pointsFunc,
+		"GET /students/me/points",
+		"GET /students/{studentId}/points",
+		"POST /students/{studentId}/points/adjustments",
+	)
+
+	rewardsFunc := newDatabaseFunction(stack, "Rewards Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("RewardsStore"),
+		Entry:        jsii.String("./lambda/rewards/main.go"),
+	})
+	addLambdaRoutes(httpApi, originVerify, "RewardsIntegration", rewardsFunc,
+		"GET /rewards",
+		"POST /rewards",
+		"GET /rewards/{rewardId}",
+		"PATCH /rewards/{rewardId}",
+		"POST /rewards/{rewardId}/purchase",
+		"GET /students/me/purchases",
+		"GET /clubs/{clubId}/purchases",
+		"GET /purchases",
+		"POST /purchases/{purchaseId}/fulfill",
+		"POST /purchases/{purchaseId}/refund",
+	)
+
+	//  =======================================
+	//  Member form imports
+	//  =======================================
+	// only talks to S3, so it stays out of the vpc like the presign function
+	importsFunc := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("Imports Function"), &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("MemberFormImports"),
+		Entry:        jsii.String("./lambda/imports/main.go"),
+		Environment: &map[string]*string{
+			"IMPORTS_BUCKET_NAME": props.ImportsBucket.BucketName(),
+		},
+	})
+	props.ImportsBucket.GrantPut(importsFunc, jsii.String("imports/*"))
+	props.ImportsBucket.GrantRead(importsFunc, jsii.String("reports/*"))
+	addLambdaRoutes(httpApi, originVerify, "ImportsIntegration", importsFunc,
+		"GET /imports/upload-url",
+		"GET /imports/report",
+	)
+
+	//  =======================================
+	//  Student data export and erasure
+	//  =======================================
+	privacyFunc := newDatabaseFunction(stack, "Privacy Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("StudentPrivacy"),
+		Entry:        jsii.String("./lambda/privacy/main.go"),
+		Environment: &map[string]*string{
+			"EXPORTS_BUCKET_NAME": props.ExportsBucket.BucketName(),
+			"USER_POOL_ID":        props.UserPool.UserPoolId(),
+		},
+		Timeout: awscdk.Duration_Seconds(jsii.Number(30)),
+	})
+	privacyFunc.Connections().AddSecurityGroup(props.LambdaS3SecurityGroup)
+	privacyFunc.Node().AddDependency(props.S3Endpoint)
+	props.ExportsBucket.GrantReadWrite(privacyFunc, jsii.String("exports/*"))
+	// erasing a student deletes their sign in account
+	props.UserPool.Grant(privacyFunc, jsii.String("cognito-idp:AdminDeleteUser"))
+	addLambdaRoutes(httpApi, originVerify, "PrivacyIntegration", privacyFunc,
+		"POST /students/{studentId}/export",
+		"POST /students/me/erasure",
+		"GET /erasures",
+		"POST /students/{studentId}/erase",
+	)
+
+	//  =======================================
+	//  Audit log
+	//  =======================================
+	// the other functions write AUDIT_LOG through auditutils.Wrap, this one reads it
+	auditFunc := newDatabaseFunction(stack, "Audit Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("AuditLog"),
+		Entry:        jsii.String("./lambda/audit/main.go"),
+	})
+	addLambdaRoutes(httpApi, originVerify, "AuditIntegration", auditFunc,
+		"GET /audit-log",
+	)
+
+	// a call whose entry couldn't be written still went through, the alarm is there so
+	// someone reads the logs and fills in the gap
+	awscloudwatch.NewAlarm(stack, jsii.String("AuditWriteFailureAlarm"), &awscloudwatch.AlarmProps{
+		AlarmName:        jsii.String("gwc-audit-write-failures"),
+		AlarmDescription: jsii.String("Mutating API calls went through without an AUDIT_LOG entry"),
+		Metric: awscloudwatch.NewMetric(&awscloudwatch.MetricProps{
+			Namespace:  jsii.String("GWC"),
+			MetricName: jsii.String("AuditWriteFailures"),
+			Statistic:  jsii.String("Sum"),
+			Period:     awscdk.Duration_Minutes(jsii.Number(5)),
+		}),
+		Threshold:          jsii.Number(0),
+		ComparisonOperator: awscloudwatch.ComparisonOperator_GREATER_THAN_THRESHOLD,
+		EvaluationPeriods:  jsii.Number(1),
+		TreatMissingData:   awscloudwatch.TreatMissingData_NOT_BREACHING,
+	})
+
+	//  =======================================
+	//  Calendar feeds
+	//  =======================================
+	// signs the personal feed urls, rotating it breaks every student's subscription
+	calendarSecret := awssecretsmanager.NewSecret(stack, jsii.String("CalendarSigningKey"), &awssecretsmanager.SecretProps{
+		Description: jsii.String("HMAC key for personal calendar feed urls"),
+		GenerateSecretString: &awssecretsmanager.SecretStringGenerator{
+			PasswordLength:     jsii.Number(64),
+			ExcludePunctuation: jsii.Bool(true),
+		},
+	})
+
+	calendarFunc := newDatabaseFunction(stack, "Calendar Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("CalendarFeeds"),
+		Entry:        jsii.String("./lambda/calendar/main.go"),
+		Environment: &map[string]*string{
+			"CALENDAR_SECRET_ARN": calendarSecret.SecretArn(),
+		},
+	})
+	calendarSecret.GrantRead(calendarFunc, nil)
+	addLambdaRoutes(httpApi, originVerify, "CalendarIntegration", calendarFunc,
+		"GET /students/me/calendar",
+		"POST /students/me/calendar/reset",
+	)
+	// calendar apps subscribe without signing in
+	addAuthorizedLambdaRoutes(httpApi, originVerify, "PublicCalendarIntegration", calendarFunc, publicRoute,
+		"GET /clubs/{clubId}/calendar.ics",
+		"GET /calendar/{token}/events.ics",
+	)
+
+	//  =======================================
+	//  Public event feeds
+	//  =======================================
+	// for partner sites, cached by the /public/* behavior of the distribution below
+	publicFunc := newDatabaseFunction(stack, "Public Events Function", db, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("PublicEvents"),
+		Entry:        jsii.String("./lambda/public/events/main.go"),
+	})
+	addAuthorizedLambdaRoutes(httpApi, originVerify, "PublicEventsIntegration", publicFunc, publicRoute,
+		"GET /public/events",
+		"GET /public/events.rss",
+	)
+
+	//  =======================================
+	//  Throttling and WAF
+	//  =======================================
+	// stage wide throttling, with a much lower limit on presign since every call can
+	// turn into an upload to the image bucket
+	defaultStage := httpApi.DefaultStage().Node().DefaultChild().(awsapigatewayv2.CfnStage)
+	defaultStage.SetDefaultRouteSettings(&awsapigatewayv2.CfnStage_RouteSettingsProperty{
+		ThrottlingRateLimit:  jsii.Number(50),
+		ThrottlingBurstLimit: jsii.Number(100),
+	})
+	defaultStage.SetRouteSettings(map[string]interface{}{
+		"GET /presign": &awsapigatewayv2.CfnStage_RouteSettingsProperty{
+			ThrottlingRateLimit:  jsii.Number(5),
+			ThrottlingBurstLimit: jsii.Number(10),
+		},
+	})
+	// route settings fail to deploy if the route doesn't exist yet
+	for _, route := range presignRoutes {
+		defaultStage.Node().AddDependency(route)
+	}
+
+	// WAF can't be attached to HTTP APIs, so the api is put behind cloudfront and the
+	// web acl goes on the distribution instead, see originSecret for what keeps clients
+	// from going around it
+	apiOrigin := awscloudfrontorigins.NewHttpOrigin(
+		jsii.String(*httpApi.ApiId()+".execute-api."+*stack.Region()+"."+*stack.UrlSuffix()),
+		&awscloudfrontorigins.HttpOriginProps{
+			ProtocolPolicy: awscloudfront.OriginProtocolPolicy_HTTPS_ONLY,
+			// replaces a header of the same name sent by the viewer
+			CustomHeaders: &map[string]*string{
+				"X-Origin-Verify": originVerify,
+			},
+		},
+	)
+	// the public feeds are the same for everyone, so they're cached by their query
+	// string alone. Only the cache key reaches the origin, which is what keeps other
+	// parameters from splitting the cache or changing what's served.
+	publicCachePolicy := awscloudfront.NewCachePolicy(stack, jsii.String("PublicEventsCachePolicy"), &awscloudfront.CachePolicyProps{
+		Comment:                    jsii.String("ClubEventApi /public/* feeds"),
+		MinTtl:                     awscdk.Duration_Seconds(jsii.Number(0)),
+		DefaultTtl:                 awscdk.Duration_Seconds(jsii.Number(60)),
+		MaxTtl:                     awscdk.Duration_Minutes(jsii.Number(5)),
+		QueryStringBehavior:        awscloudfront.CacheQueryStringBehavior_AllowList(jsii.String("clubId"), jsii.String("limit")),
+		HeaderBehavior:             awscloudfront.CacheHeaderBehavior_None(),
+		CookieBehavior:             awscloudfront.CacheCookieBehavior_None(),
+		EnableAcceptEncodingGzip:   jsii.Bool(true),
+		EnableAcceptEncodingBrotli: jsii.Bool(true),
 	})
 
-	// log HTTP API endpoint
-	awscdk.NewCfnOutput(stack, jsii.String("myHttpApiEndpoint"), &awscdk.CfnOutputProps{
-		Value:       httpApi.ApiEndpoint(),
-		Description: jsii.String("HTTP API Endpoint"),
+	apiDistribution := awscloudfront.NewDistribution(stack, jsii.String("ClubEventApiCdn"), &awscloudfront.DistributionProps{
+		Comment: jsii.String("ClubEventApi"),
+		DefaultBehavior: &awscloudfront.BehaviorOptions{
+			Origin:               apiOrigin,
+			ViewerProtocolPolicy: awscloudfront.ViewerProtocolPolicy_HTTPS_ONLY,
+			AllowedMethods:       awscloudfront.AllowedMethods_ALLOW_ALL(),
+			// nothing is cached, the distribution is mostly here for WAF
+			CachePolicy:         awscloudfront.CachePolicy_CACHING_DISABLED(),
+			OriginRequestPolicy: awscloudfront.OriginRequestPolicy_ALL_VIEWER_EXCEPT_HOST_HEADER(),
+		},
+		AdditionalBehaviors: &map[string]*awscloudfront.BehaviorOptions{
+			"/public/*": {
+				Origin:               apiOrigin,
+				ViewerProtocolPolicy: awscloudfront.ViewerProtocolPolicy_HTTPS_ONLY,
+				AllowedMethods:       awscloudfront.AllowedMethods_ALLOW_GET_HEAD(),
+				CachePolicy:          publicCachePolicy,
+				Compress:             jsii.Bool(true),
+			},
+		},
+		WebAclId: props.WebAclArn,
 	})
+	apiUrl := jsii.String("https://" + *apiDistribution.DomainName())
+	publicFunc.AddEnvironment(jsii.String("API_URL"), apiUrl, nil)
+	calendarFunc.AddEnvironment(jsii.String("API_URL"), apiUrl, nil)
 
-	return stack
+	// the events function is in the vpc and can't reach CloudFront, so it invokes this
+	// one to clear the feeds when an event in them changes, see publicutils.Invalidate
+	invalidatorFunc := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("Public Invalidator Function"), &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("PublicEventsInvalidator"),
+		Entry:        jsii.String("./lambda/public/invalidate/main.go"),
+		Environment: &map[string]*string{
+			"DISTRIBUTION_ID": apiDistribution.DistributionId(),
+		},
+	})
+	apiDistribution.GrantCreateInvalidation(invalidatorFunc)
+	invalidatorFunc.GrantInvoke(eventsFunc)
+	eventsFunc.AddEnvironment(jsii.String("PUBLIC_INVALIDATOR_NAME"), invalidatorFunc.FunctionName(), nil)
+
+	awscdk.NewCfnOutput(stack, jsii.String("CloudFront_Api_Info"), &awscdk.CfnOutputProps{
+		Description: jsii.String("API CloudFront Info"),
+		Value:       jsii.String("API URL: " + *apiUrl + " | ID: " + *apiDistribution.DistributionId()),
+	})
+
+	return &ApiStack{
+		Stack:   stack,
+		HttpApi: httpApi,
+
+		Distribution: apiDistribution,
+		ApiUrl:       apiUrl,
+	}
+}
+
+// addLambdaRoutes sends each route, written like its route key e.g. "GET /students/{studentId}",
+// to fn. The lambda tells the routes apart by the route key (see apiutils.Router).
+// originVerify is the value of apiutils.OriginHeader, fn gets it in API_ORIGIN_SECRET.
+func addLambdaRoutes(httpApi awsapigatewayv2.HttpApi, originVerify *string, id string, fn awslambda.Function,
+	routes ...string) []awsapigatewayv2.HttpRoute {
+
+	return addAuthorizedLambdaRoutes(httpApi, originVerify, id, fn, nil, routes...)
+}
+
+// addAuthorizedLambdaRoutes is addLambdaRoutes with another authorizer than the api's
+// default, e.g. publicRoute. A nil authorizer keeps the default.
+func addAuthorizedLambdaRoutes(httpApi awsapigatewayv2.HttpApi, originVerify *string, id string, fn awslambda.Function,
+	authorizer awsapigatewayv2.IHttpRouteAuthorizer, routes ...string) []awsapigatewayv2.HttpRoute {
+
+	fn.AddEnvironment(jsii.String("API_ORIGIN_SECRET"), originVerify, nil)
+	integration := awsapigatewayv2integrations.NewHttpLambdaIntegration(
+		jsii.String(id),
+		fn,
+		&awsapigatewayv2integrations.HttpLambdaIntegrationProps{},
+	)
+
+	var added []awsapigatewayv2.HttpRoute
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		added = append(added, *httpApi.AddRoutes(&awsapigatewayv2.AddRoutesOptions{
+			Path:        jsii.String(path),
+			Methods:     &[]awsapigatewayv2.HttpMethod{awsapigatewayv2.HttpMethod(method)},
+			Integration: integration,
+			Authorizer:  authorizer,
+		})...)
+	}
+	return added
 }
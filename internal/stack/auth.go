@@ -0,0 +1,120 @@
+package stack
+
+import (
+	"strings"
+
+	"github.com/aws/aws-cdk-go/awscdk/v2" // core
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
+
+	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
+
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// user pool groups, these show up in the cognito:groups claim of a user's tokens.
+// Lower precedence wins when a user is in more than one group.
+var userPoolGroups = []struct {
+	name        string
+	description string
+	precedence  float64
+}{
+	{"admin", "Site administrators", 0},
+	{"eboard", "Executive board members of at least one club", 10},
+	{"member", "Club members", 20},
+}
+
+type AuthStackProps struct {
+	Props awscdk.StackProps
+
+	// AllowedEmailDomains are the only email domains that can sign up, e.g. "myhunter.cuny.edu"
+	AllowedEmailDomains []string
+
+	// the post confirmation trigger links new users to STUDENTS
+	Database DatabaseAccess
+}
+
+type AuthStack struct {
+	Stack          awscdk.Stack
+	UserPool       awscognito.UserPool
+	UserPoolClient awscognito.UserPoolClient
+}
+
+func NewAuthStack(scope constructs.Construct, id string, props *AuthStackProps) *AuthStack {
+	var sprops awscdk.StackProps
+	if props != nil {
+		sprops = props.Props
+	}
+	stack := awscdk.NewStack(scope, &id, &sprops)
+
+	//  =======================================
+	//  sign up restrictions
+	//  =======================================
+	preSignUpFunc := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("PreSignUp Function"), &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("CognitoPreSignUp"),
+		Entry:        jsii.String("./lambda/auth/presignup/main.go"),
+		Environment: &map[string]*string{
+			"ALLOWED_EMAIL_DOMAINS": jsii.String(strings.Join(props.AllowedEmailDomains, ",")),
+		},
+	})
+
+	// links confirmed users to their STUDENTS row
+	postConfirmationFunc := newDatabaseFunction(stack, "PostConfirmation Function", props.Database, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("CognitoPostConfirmation"),
+		Entry:        jsii.String("./lambda/auth/postconfirmation/main.go"),
+	})
+
+	//  =======================================
+	//  user pool
+	//  =======================================
+	userPool := awscognito.NewUserPool(stack, jsii.String("ClubUserPool"), &awscognito.UserPoolProps{
+		UserPoolName:      jsii.String("gwc-club-users"),
+		SelfSignUpEnabled: jsii.Bool(true),
+		SignInAliases:     &awscognito.SignInAliases{Email: jsii.Bool(true)},
+		AutoVerify:        &awscognito.AutoVerifiedAttrs{Email: jsii.Bool(true)},
+		StandardAttributes: &awscognito.StandardAttributes{
+			Email:      &awscognito.StandardAttribute{Required: jsii.Bool(true), Mutable: jsii.Bool(true)},
+			GivenName:  &awscognito.StandardAttribute{Required: jsii.Bool(true), Mutable: jsii.Bool(true)},
+			FamilyName: &awscognito.StandardAttribute{Required: jsii.Bool(true), Mutable: jsii.Bool(true)},
+		},
+		AccountRecovery: awscognito.AccountRecovery_EMAIL_ONLY,
+		LambdaTriggers: &awscognito.UserPoolTriggers{
+			PreSignUp:        preSignUpFunc,
+			PostConfirmation: postConfirmationFunc,
+		},
+		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+	})
+
+	for _, group := range userPoolGroups {
+		awscognito.NewUserPoolGroup(stack, jsii.String("Group-"+group.name), &awscognito.UserPoolGroupProps{
+			UserPool:    userPool,
+			GroupName:   jsii.String(group.name),
+			Description: jsii.String(group.description),
+			Precedence:  jsii.Number(group.precedence),
+		})
+	}
+
+	// the SPA signs in with SRP, a public client can't keep a secret
+	userPoolClient := userPool.AddClient(jsii.String("ClubSiteClient"), &awscognito.UserPoolClientOptions{
+		UserPoolClientName: jsii.String("gwc-club-site"),
+		GenerateSecret:     jsii.Bool(false),
+		AuthFlows: &awscognito.AuthFlow{
+			UserSrp: jsii.Bool(true),
+		},
+		PreventUserExistenceErrors: jsii.Bool(true),
+	})
+
+	awscdk.NewCfnOutput(stack, jsii.String("UserPoolId"), &awscdk.CfnOutputProps{
+		Value: userPool.UserPoolId(),
+	})
+
+	awscdk.NewCfnOutput(stack, jsii.String("UserPoolClientId"), &awscdk.CfnOutputProps{
+		Value: userPoolClient.UserPoolClientId(),
+	})
+
+	return &AuthStack{
+		Stack:          stack,
+		UserPool:       userPool,
+		UserPoolClient: userPoolClient,
+	}
+}
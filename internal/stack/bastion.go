@@ -18,7 +18,15 @@ type BastionStackProps struct {
 	DbSecurityGroup awsec2.SecurityGroup
 }
 
-func NewBastionStack(scope constructs.Construct, id string, props *BastionStackProps) awscdk.Stack {
+type BastionStack struct {
+	Stack awscdk.Stack
+
+	// S3Endpoint routes the vpc's S3 traffic, the bastion installs mysql through it and
+	// lambdas that use S3 depend on it
+	S3Endpoint awsec2.GatewayVpcEndpoint
+}
+
+func NewBastionStack(scope constructs.Construct, id string, props *BastionStackProps) *BastionStack {
 	var sprops awscdk.StackProps
 	if props != nil {
 		sprops = props.StackProps
@@ -89,7 +97,7 @@ func NewBastionStack(scope constructs.Construct, id string, props *BastionStackP
 	)
 
 	// s3 gateway endpoint for mysql
-	awsec2.NewGatewayVpcEndpoint(stack, jsii.String("S3Endpoint"), &awsec2.GatewayVpcEndpointProps{
+	s3Endpoint := awsec2.NewGatewayVpcEndpoint(stack, jsii.String("S3Endpoint"), &awsec2.GatewayVpcEndpointProps{
 		Vpc:     vpc,
 		Service: awsec2.GatewayVpcEndpointAwsService_S3(),
 	})
@@ -133,7 +141,10 @@ func NewBastionStack(scope constructs.Construct, id string, props *BastionStackP
 		Value: instance.InstanceId(),
 	})
 
-	return stack
+	return &BastionStack{
+		Stack:      stack,
+		S3Endpoint: s3Endpoint,
+	}
 }
 
 func addEndpoint(scope constructs.Construct,
@@ -3,15 +3,25 @@ package stack
 import (
 	"github.com/aws/aws-cdk-go/awscdk/v2" // core
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awskms"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsrds"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awssecretsmanager"
 	"github.com/aws/aws-cdk-go/awscdk/v2/customresources"
 
+	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
+
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
 )
 
+// databaseName is the schema the init lambda creates the tables in, and the one
+// every lambda made with newDatabaseFunction connects to
+const databaseName = "STAGING"
+
+// initFunctionDir holds the init lambda's Dockerfile and migrations
+const initFunctionDir = "lambda/database/init"
+
 type DatabaseStackProps struct {
 	Props awscdk.StackProps
 
@@ -31,6 +41,11 @@ type DatabaseStack struct {
 	ProxySecurityGroup  awsec2.SecurityGroup
 
 	ProxyEndpoint *string
+
+	// DataKey wraps the keys student info is encrypted with, BlindIndexSecret is the
+	// HMAC key of STUDENT_INFO.emplid_index. See utils/crypto.
+	DataKey          awskms.Key
+	BlindIndexSecret awssecretsmanager.Secret
 }
 
 func NewDatabaseStack(scope constructs.Construct, id string, props *DatabaseStackProps) *DatabaseStack {
@@ -111,11 +126,31 @@ func NewDatabaseStack(scope constructs.Construct, id string, props *DatabaseStac
 
 	lambdaSecretsManagerSecurityGroup := props.LambdaSecretsManagerSecurityGroup
 
+	// ====================================
+	// encryption of sensitive columns
+	// ====================================
+
+	// both are kept when the stack is deleted, the data can't be read without them
+	dataKey := awskms.NewKey(stack, jsii.String("StudentDataKey"), &awskms.KeyProps{
+		Alias:             jsii.String("alias/club-event-student-data"),
+		Description:       jsii.String("Wraps the data keys STUDENT_INFO columns are encrypted with"),
+		EnableKeyRotation: jsii.Bool(true),
+		RemovalPolicy:     awscdk.RemovalPolicy_RETAIN,
+	})
+	blindIndexSecret := awssecretsmanager.NewSecret(stack, jsii.String("BlindIndexKey"), &awssecretsmanager.SecretProps{
+		Description: jsii.String("HMAC key for blind indexes of encrypted columns, changing it breaks emplid lookups"),
+		GenerateSecretString: &awssecretsmanager.SecretStringGenerator{
+			PasswordLength:     jsii.Number(64),
+			ExcludePunctuation: jsii.Bool(true),
+		},
+		RemovalPolicy: awscdk.RemovalPolicy_RETAIN,
+	})
+
 	initRDSFunc := awslambda.NewDockerImageFunction(stack, jsii.String("RDS Init Function"),
 		&awslambda.DockerImageFunctionProps{
 			FunctionName: jsii.String("InitRDS"),
 			Description:  jsii.String("Lambda function to initialize RDS database"),
-			Code:         awslambda.DockerImageCode_FromImageAsset(jsii.String("lambda/database/init"), nil),
+			Code:         awslambda.DockerImageCode_FromImageAsset(jsii.String(initFunctionDir), nil),
 			Timeout:      awscdk.Duration_Minutes(jsii.Number(1)),
 			MemorySize:   jsii.Number(256),
 			Architecture: awslambda.Architecture_X86_64(),
@@ -140,8 +175,13 @@ func NewDatabaseStack(scope constructs.Construct, id string, props *DatabaseStac
 		OnEventHandler: initRDSFunc,
 	})
 
+	// the fingerprint changes whenever a migration is added, which makes cloudformation send
+	// an update to the init lambda so new migrations run on the next deploy
 	rdsInitializer := awscdk.NewCustomResource(stack, jsii.String("RdsInitializer"), &awscdk.CustomResourceProps{
 		ServiceToken: provider.ServiceToken(),
+		Properties: &map[string]interface{}{
+			"SourceFingerprint": awscdk.FileSystem_Fingerprint(jsii.String(initFunctionDir), nil),
+		},
 	})
 
 	// Ensure the database is ready before the Lambda runs
@@ -193,5 +233,71 @@ func NewDatabaseStack(scope constructs.Construct, id string, props *DatabaseStac
 		ProxySecurityGroup:  proxySecurityGroup,
 
 		ProxyEndpoint: proxy.Endpoint(),
+
+		DataKey:          dataKey,
+		BlindIndexSecret: blindIndexSecret,
+	}
+}
+
+// DatabaseAccess is what a lambda in another stack needs to reach the database through the proxy
+type DatabaseAccess struct {
+	Vpc                               awsec2.Vpc
+	LambdaSecretsManagerSecurityGroup awsec2.SecurityGroup
+	LambdaSecurityGroup               awsec2.SecurityGroup
+	DbInstance                        awsrds.DatabaseInstance
+	ProxyEndpoint                     *string
+	DataKey                           awskms.Key
+	BlindIndexSecret                  awssecretsmanager.Secret
+}
+
+func (d *DatabaseStack) Access() DatabaseAccess {
+	return DatabaseAccess{
+		Vpc:                               d.Vpc,
+		LambdaSecretsManagerSecurityGroup: d.LambdaSecretsManagerSecurityGroup,
+		LambdaSecurityGroup:               d.LambdaSecurityGroup,
+		DbInstance:                        d.DbInstance,
+		ProxyEndpoint:                     d.ProxyEndpoint,
+		DataKey:                           d.DataKey,
+		BlindIndexSecret:                  d.BlindIndexSecret,
 	}
 }
+
+// newDatabaseFunction creates a go lambda in the vpc that can connect to the database
+// the same way DBTestFunction does, databaseutils.Connect reads the environment set here.
+// It can also encrypt and decrypt student info, see cryptoutils.Default.
+// MemorySize and Timeout default to 256MB and 10 seconds.
+func newDatabaseFunction(scope constructs.Construct, id string, db DatabaseAccess,
+	props *awscdklambdagoalpha.GoFunctionProps) awscdklambdagoalpha.GoFunction {
+
+	environment := map[string]*string{}
+	if props.Environment != nil {
+		environment = *props.Environment
+	}
+	environment["DB_SECRET_ARN"] = db.DbInstance.Secret().SecretArn()
+	environment["DB_HOST"] = db.ProxyEndpoint
+	environment["DB_NAME"] = jsii.String(databaseName)
+	environment["DATA_KEY_ARN"] = db.DataKey.KeyArn()
+	environment["BLIND_INDEX_SECRET_ARN"] = db.BlindIndexSecret.SecretArn()
+	props.Environment = &environment
+
+	if props.MemorySize == nil {
+		props.MemorySize = jsii.Number(256)
+	}
+	if props.Timeout == nil {
+		props.Timeout = awscdk.Duration_Seconds(jsii.Number(10))
+	}
+
+	props.Vpc = db.Vpc
+	props.SecurityGroups = &[]awsec2.ISecurityGroup{
+		db.LambdaSecretsManagerSecurityGroup,
+		db.LambdaSecurityGroup,
+	}
+	props.AllowPublicSubnet = jsii.Bool(true)
+
+	function := awscdklambdagoalpha.NewGoFunction(scope, jsii.String(id), props)
+	db.DbInstance.Secret().GrantRead(function, nil)
+	db.DataKey.GrantEncryptDecrypt(function)
+	db.BlindIndexSecret.GrantRead(function, nil)
+
+	return function
+}
@@ -1,8 +1,17 @@
 package stack
 
 import (
+	"fmt"
+	"path"
+
 	"github.com/aws/aws-cdk-go/awscdk/v2" // core
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscertificatemanager"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awss3deployment"
+
+	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
 
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
@@ -11,16 +20,52 @@ import (
 	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudfrontorigins"
 )
 
+// previewPrefix is the key prefix in the website bucket that holds one folder per
+// feature branch preview build, e.g. previews/my-branch/index.html
+const previewPrefix = "previews"
+
+// configName is the runtime config the app fetches on load, written into every origin
+// path at deploy time so builds don't need to know which stack they're deployed against
+const configName = "config.json"
+
+// previewConfigKey is where the shared preview config lives, outside previews/ so the
+// lifecycle rule doesn't expire it
+const previewConfigKey = "config/preview.json"
+
 type FrontendStackProps struct {
 	Props awscdk.StackProps
+
+	// PreviewDomainName is the domain previews are served under, a build uploaded to
+	// previews/<branch>/ is served at https://<branch>.<PreviewDomainName>.
+	// The preview distribution is skipped when this is empty.
+	PreviewDomainName string
+	// PreviewCertificateArn is an ACM certificate (in us-east-1) for *.<PreviewDomainName>
+	PreviewCertificateArn string
+	// PreviewExpirationDays is how long a preview is kept after its branch was last deployed
+	PreviewExpirationDays float64
+
+	// WebAclArn is attached to every frontend distribution (optional)
+	WebAclArn *string
+
+	// these end up in config.json
+	ApiEndpoint      *string
+	ImageDomainName  *string
+	UserPoolId       *string
+	UserPoolClientId *string
 }
 
 func NewFrontendStack(scope constructs.Construct, id string, props *FrontendStackProps) awscdk.Stack {
 	var sprops awscdk.StackProps
 	if props != nil {
 		sprops = props.Props
+	} else {
+		props = &FrontendStackProps{}
 	}
 	stack := awscdk.NewStack(scope, &id, &sprops)
+	// every config.json points the site at the api
+	if props.ApiEndpoint == nil {
+		panic(fmt.Sprintf("%s needs an ApiEndpoint for config.json", id))
+	}
 
 	// The code that defines your stack goes here
 
@@ -33,6 +78,45 @@ func NewFrontendStack(scope constructs.Construct, id string, props *FrontendStac
 			AutoDeleteObjects: jsii.Bool(true),
 		})
 
+	// preview builds are expired a whole branch at a time from its last deploy, see
+	// lambda/frontend/expirepreviews. A lifecycle rule would expire each file by its own
+	// upload time and break previews that are still being deployed to.
+	if props.PreviewExpirationDays > 0 {
+		websiteBucket.AddLifecycleRule(&awss3.LifecycleRule{
+			Id:                                  jsii.String("AbortPreviewUploads"),
+			Prefix:                              jsii.String(previewPrefix + "/"),
+			AbortIncompleteMultipartUploadAfter: awscdk.Duration_Days(jsii.Number(1)),
+		})
+
+		expireFunc := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("Expire Previews Function"), &awscdklambdagoalpha.GoFunctionProps{
+			FunctionName: jsii.String("ExpirePreviews"),
+			Description:  jsii.String("Deletes preview builds whose branch hasn't been deployed recently"),
+			Entry:        jsii.String("./lambda/frontend/expirepreviews/main.go"),
+			Timeout:      awscdk.Duration_Minutes(jsii.Number(5)),
+			Environment: &map[string]*string{
+				"BUCKET_NAME":     websiteBucket.BucketName(),
+				"PREVIEW_PREFIX":  jsii.String(previewPrefix),
+				"EXPIRATION_DAYS": jsii.String(fmt.Sprint(props.PreviewExpirationDays)),
+			},
+		})
+		websiteBucket.GrantRead(expireFunc, jsii.String(previewPrefix+"/*"))
+		websiteBucket.GrantDelete(expireFunc, jsii.String(previewPrefix+"/*"))
+		awsevents.NewRule(stack, jsii.String("ExpirePreviewsSchedule"), &awsevents.RuleProps{
+			Schedule: awsevents.Schedule_Cron(&awsevents.CronOptions{Hour: jsii.String("8"), Minute: jsii.String("0")}),
+			Targets: &[]awsevents.IRuleTarget{
+				awseventstargets.NewLambdaFunction(expireFunc, &awseventstargets.LambdaFunctionProps{}),
+			},
+		})
+	}
+
+	// PromoteFrontend deletes its staged copy when it's done, this catches the runs that
+	// didn't get to
+	websiteBucket.AddLifecycleRule(&awss3.LifecycleRule{
+		Id:         jsii.String("ExpirePromotionStaging"),
+		Prefix:     jsii.String("promotions-staging/"),
+		Expiration: awscdk.Duration_Days(jsii.Number(1)),
+	})
+
 	// Output S3 bucket name
 	awscdk.NewCfnOutput(stack, jsii.String("websiteBucketName"), &awscdk.CfnOutputProps{
 		Value: websiteBucket.BucketName(),
@@ -58,6 +142,7 @@ func NewFrontendStack(scope constructs.Construct, id string, props *FrontendStac
 	var frontendMain awscloudfront.Distribution
 
 	frontendMain = awscloudfront.NewDistribution(stack, jsii.String("FrontendMain"), &awscloudfront.DistributionProps{
+		WebAclId:          props.WebAclArn,
 		DefaultRootObject: jsii.String("index.html"),
 		DefaultBehavior:   cloudfrontMainBehavior,
 		ErrorResponses: &[]*awscloudfront.ErrorResponse{
@@ -76,6 +161,8 @@ func NewFrontendStack(scope constructs.Construct, id string, props *FrontendStac
 		},
 	})
 
+	deployConfig(stack, "MainConfig", websiteBucket, "main/"+configName, frontendConfig(stack, "main", props), frontendMain)
+
 	awscdk.NewCfnOutput(stack, jsii.String("CloudFront_Main_Info"), &awscdk.CfnOutputProps{
 		Description: jsii.String("Main Branch CloudFront Info"),
 		Value: jsii.String("Main URL: https://" + *frontendMain.DomainName() +
@@ -97,6 +184,7 @@ func NewFrontendStack(scope constructs.Construct, id string, props *FrontendStac
 	var frontendProduction awscloudfront.Distribution
 
 	frontendProduction = awscloudfront.NewDistribution(stack, jsii.String("FrontendProduction"), &awscloudfront.DistributionProps{
+		WebAclId:          props.WebAclArn,
 		DefaultRootObject: jsii.String("index.html"),
 		DefaultBehavior:   cloudfrontProductionBehavior,
 		ErrorResponses: &[]*awscloudfront.ErrorResponse{
@@ -115,11 +203,148 @@ func NewFrontendStack(scope constructs.Construct, id string, props *FrontendStac
 		},
 	})
 
+	deployConfig(stack, "ProductionConfig", websiteBucket, "production/"+configName, frontendConfig(stack, "production", props), frontendProduction)
+
 	awscdk.NewCfnOutput(stack, jsii.String("CloudFront_Production_Info"), &awscdk.CfnOutputProps{
 		Description: jsii.String("Production Branch CloudFront Info"),
 		Value: jsii.String("Production URL: https://" + *frontendProduction.DomainName() +
 			" | ID: " + *frontendProduction.DistributionId()),
 	})
 
+	// promotes a build from main to production, see cmd/promote
+	promoteFunc := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("Promote Function"), &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("PromoteFrontend"),
+		Description:  jsii.String("Copies a frontend build from /main to /production and invalidates production"),
+		Entry:        jsii.String("./lambda/frontend/promote/main.go"),
+		MemorySize:   jsii.Number(256),
+		Timeout:      awscdk.Duration_Minutes(jsii.Number(5)),
+		Environment: &map[string]*string{
+			"BUCKET_NAME":     websiteBucket.BucketName(),
+			"SOURCE_PREFIX":   jsii.String("main"),
+			"TARGET_PREFIX":   jsii.String("production"),
+			"DISTRIBUTION_ID": frontendProduction.DistributionId(),
+		},
+	})
+	websiteBucket.GrantReadWrite(promoteFunc, nil)
+	websiteBucket.GrantDelete(promoteFunc, nil)
+	frontendProduction.GrantCreateInvalidation(promoteFunc)
+
+	// then the previews, one wildcard distribution for every feature branch
+	if props.PreviewDomainName != "" {
+		frontendPreview := newPreviewDistribution(stack, websiteBucket, cloudfrontOAI, props)
+		deployConfig(stack, "PreviewConfig", websiteBucket, previewConfigKey, frontendConfig(stack, "preview", props), frontendPreview)
+	}
+
 	return stack
 }
+
+// newPreviewDistribution serves every branch under previews/ from a single distribution.
+// A CloudFront function reads the branch from the Host header and rewrites the request
+// into that branch's folder, so no infrastructure change is needed per branch.
+func newPreviewDistribution(stack awscdk.Stack, websiteBucket awss3.Bucket,
+	oai awscloudfront.OriginAccessIdentity, props *FrontendStackProps) awscloudfront.Distribution {
+
+	routeFunc := awscloudfront.NewFunction(stack, jsii.String("PreviewRouter"), &awscloudfront.FunctionProps{
+		Comment: jsii.String("Routes <branch>." + props.PreviewDomainName + " to " + previewPrefix + "/<branch>/"),
+		Runtime: awscloudfront.FunctionRuntime_JS_2_0(),
+		Code:    awscloudfront.FunctionCode_FromInline(jsii.String(previewRouterCode())),
+	})
+
+	certificate := awscertificatemanager.Certificate_FromCertificateArn(stack,
+		jsii.String("PreviewCertificate"), jsii.String(props.PreviewCertificateArn))
+
+	previewBehavior := &awscloudfront.BehaviorOptions{
+		// no origin path here, the router function adds the branch folder itself
+		Origin: awscloudfrontorigins.NewS3Origin(websiteBucket, &awscloudfrontorigins.S3OriginProps{
+			OriginAccessIdentity: oai,
+		}),
+		ViewerProtocolPolicy: awscloudfront.ViewerProtocolPolicy_REDIRECT_TO_HTTPS,
+		FunctionAssociations: &[]*awscloudfront.FunctionAssociation{
+			{
+				EventType: awscloudfront.FunctionEventType_VIEWER_REQUEST,
+				Function:  routeFunc,
+			},
+		},
+	}
+
+	// no ErrorResponses like main/production, the error page fetch skips the router
+	// function so it couldn't find the branch's index.html anyway
+	frontendPreview := awscloudfront.NewDistribution(stack, jsii.String("FrontendPreview"), &awscloudfront.DistributionProps{
+		DefaultBehavior: previewBehavior,
+		DomainNames:     &[]*string{jsii.String("*." + props.PreviewDomainName)},
+		Certificate:     certificate,
+		WebAclId:        props.WebAclArn,
+	})
+
+	awscdk.NewCfnOutput(stack, jsii.String("CloudFront_Preview_Info"), &awscdk.CfnOutputProps{
+		Description: jsii.String("Preview Branches CloudFront Info"),
+		Value: jsii.String("Preview URL: https://<branch>." + props.PreviewDomainName +
+			" (CNAME to " + *frontendPreview.DomainName() + ") | ID: " + *frontendPreview.DistributionId()),
+	})
+
+	return frontendPreview
+}
+
+// previewRouterCode is the viewer request handler for the preview distribution.
+// Branch names have to be valid DNS labels, CI is expected to slugify them
+// (feature/new-nav -> feature-new-nav) before uploading to previews/<branch>/.
+func previewRouterCode() string {
+	return fmt.Sprintf(`function handler(event) {
+	var request = event.request;
+	var host = request.headers.host ? request.headers.host.value : '';
+	var branch = host.split('.')[0].toLowerCase();
+
+	if (!/^[a-z0-9-]{1,63}$/.test(branch)) {
+		return { statusCode: 404, statusDescription: 'Not Found' };
+	}
+
+	// every branch shares one config, see frontendConfig
+	if (request.uri === '/%s') {
+		request.uri = '/%s';
+		return request;
+	}
+
+	// single page app, anything that isn't a file goes to the branch's index.html
+	var uri = request.uri;
+	if (uri.endsWith('/') || uri.split('/').pop().indexOf('.') === -1) {
+		uri = '/index.html';
+	}
+
+	request.uri = '/%s/' + branch + uri;
+	return request;
+}`, configName, previewConfigKey, previewPrefix)
+}
+
+// frontendConfig is the content of config.json for one environment. Values are deploy
+// time tokens from the other stacks, they get resolved when the config is uploaded.
+func frontendConfig(stack awscdk.Stack, environment string, props *FrontendStackProps) map[string]interface{} {
+	return map[string]interface{}{
+		"environment":    environment,
+		"apiUrl":         props.ApiEndpoint,
+		"uploadEndpoint": jsii.String(*props.ApiEndpoint + "/presign"),
+		"imageDomain":    props.ImageDomainName,
+		"auth": map[string]interface{}{
+			"region":           stack.Region(),
+			"userPoolId":       props.UserPoolId,
+			"userPoolClientId": props.UserPoolClientId,
+		},
+	}
+}
+
+// deployConfig writes config.json to key and invalidates it on the distribution serving it.
+// Prune is off so the site files next to it are left alone.
+func deployConfig(stack awscdk.Stack, id string, websiteBucket awss3.Bucket, key string,
+	config map[string]interface{}, distribution awscloudfront.Distribution) {
+
+	dir, name := path.Split(key)
+
+	awss3deployment.NewBucketDeployment(stack, jsii.String(id), &awss3deployment.BucketDeploymentProps{
+		Sources:              &[]awss3deployment.ISource{awss3deployment.Source_JsonData(jsii.String(name), config, nil)},
+		DestinationBucket:    websiteBucket,
+		DestinationKeyPrefix: jsii.String(dir),
+		Prune:                jsii.Bool(false),
+		CacheControl:         &[]awss3deployment.CacheControl{awss3deployment.CacheControl_NoCache()},
+		Distribution:         distribution,
+		DistributionPaths:    &[]*string{jsii.String("/" + configName)},
+	})
+}
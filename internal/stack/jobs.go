@@ -0,0 +1,130 @@
+package stack
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk/v2" // core
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudwatch"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
+
+	"github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
+
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type JobsStackProps struct {
+	Props awscdk.StackProps
+
+	Database DatabaseAccess
+
+	// uploads to ImportsBucket are imported, which needs S3 from inside the vpc
+	ImportsBucket         awss3.IBucket
+	LambdaS3SecurityGroup awsec2.SecurityGroup
+	S3Endpoint            awsec2.IGatewayVpcEndpoint
+}
+
+// JobsStack holds the lambdas that run on a schedule instead of behind the API
+type JobsStack struct {
+	Stack awscdk.Stack
+}
+
+func NewJobsStack(scope constructs.Construct, id string, props *JobsStackProps) *JobsStack {
+	var sprops awscdk.StackProps
+	if props != nil {
+		sprops = props.Props
+	}
+	stack := awscdk.NewStack(scope, &id, &sprops)
+
+	//  =======================================
+	//  ledger verification
+	//  =======================================
+	// recomputes every balance chain, which is a full scan of POINT_HISTORIES and PURCHASES
+	verifyLedgerFunc := newDatabaseFunction(stack, "VerifyLedger Function", props.Database, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("VerifyLedger"),
+		Entry:        jsii.String("./lambda/jobs/verifyledger/main.go"),
+		Timeout:      awscdk.Duration_Minutes(jsii.Number(5)),
+	})
+
+	// nightly, 3am eastern during daylight time
+	awsevents.NewRule(stack, jsii.String("VerifyLedgerSchedule"), &awsevents.RuleProps{
+		Schedule: awsevents.Schedule_Cron(&awsevents.CronOptions{Hour: jsii.String("7"), Minute: jsii.String("0")}),
+		Targets: &[]awsevents.IRuleTarget{
+			awseventstargets.NewLambdaFunction(verifyLedgerFunc, &awseventstargets.LambdaFunctionProps{
+				Event:         awsevents.RuleTargetInput_FromObject(map[string]any{"emitRepairs": false}),
+				RetryAttempts: jsii.Number(2),
+			}),
+		},
+	})
+
+	// the job logs each discrepancy, the alarm is there so someone goes and reads them
+	awscloudwatch.NewAlarm(stack, jsii.String("LedgerDiscrepancyAlarm"), &awscloudwatch.AlarmProps{
+		AlarmName:        jsii.String("gwc-ledger-discrepancies"),
+		AlarmDescription: jsii.String("VerifyLedger found stored balances that don't match the points ledger"),
+		Metric: awscloudwatch.NewMetric(&awscloudwatch.MetricProps{
+			Namespace:     jsii.String("GWC"),
+			MetricName:    jsii.String("LedgerDiscrepancies"),
+			DimensionsMap: &map[string]*string{"Job": jsii.String("VerifyLedger")},
+			Statistic:     jsii.String("Maximum"),
+			Period:        awscdk.Duration_Days(jsii.Number(1)),
+		}),
+		Threshold:          jsii.Number(0),
+		ComparisonOperator: awscloudwatch.ComparisonOperator_GREATER_THAN_THRESHOLD,
+		EvaluationPeriods:  jsii.Number(1),
+		TreatMissingData:   awscloudwatch.TreatMissingData_NOT_BREACHING,
+	})
+
+	//  =======================================
+	//  member form import
+	//  =======================================
+	// run by hand, see lambda/jobs/importmembers
+	newDatabaseFunction(stack, "ImportMemberForms Function", props.Database, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("ImportMemberForms"),
+		Entry:        jsii.String("./lambda/jobs/importmembers/main.go"),
+		Timeout:      awscdk.Duration_Minutes(jsii.Number(5)),
+	})
+
+	// uploads from GET /imports/upload-url are loaded into MEMBER_FORM_DATA and imported,
+	// the report is written back to the bucket
+	importCsvFunc := newDatabaseFunction(stack, "ImportCsv Function", props.Database, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("ImportMemberFormCsv"),
+		Entry:        jsii.String("./lambda/jobs/importcsv/main.go"),
+		Timeout:      awscdk.Duration_Minutes(jsii.Number(5)),
+	})
+	importCsvFunc.Connections().AddSecurityGroup(props.LambdaS3SecurityGroup)
+	importCsvFunc.Node().AddDependency(props.S3Endpoint)
+	props.ImportsBucket.GrantRead(importCsvFunc, jsii.String("imports/*"))
+	props.ImportsBucket.GrantPut(importCsvFunc, jsii.String("reports/*"))
+
+	awsevents.NewRule(stack, jsii.String("ImportCsvUploaded"), &awsevents.RuleProps{
+		EventPattern: &awsevents.EventPattern{
+			Source:     jsii.Strings("aws.s3"),
+			DetailType: jsii.Strings("Object Created"),
+			Detail: &map[string]interface{}{
+				"bucket": map[string]interface{}{"name": []*string{props.ImportsBucket.BucketName()}},
+				"object": map[string]interface{}{"key": []interface{}{map[string]interface{}{"prefix": "imports/"}}},
+			},
+		},
+		Targets: &[]awsevents.IRuleTarget{
+			awseventstargets.NewLambdaFunction(importCsvFunc, &awseventstargets.LambdaFunctionProps{
+				RetryAttempts: jsii.Number(2),
+			}),
+		},
+	})
+
+	//  =======================================
+	//  student info encryption
+	//  =======================================
+	// run by hand after the encrypt_student_info migration, and with {"rewrap": true}
+	// to re-encrypt everything, see lambda/jobs/encryptstudentinfo
+	newDatabaseFunction(stack, "EncryptStudentInfo Function", props.Database, &awscdklambdagoalpha.GoFunctionProps{
+		FunctionName: jsii.String("EncryptStudentInfo"),
+		Entry:        jsii.String("./lambda/jobs/encryptstudentinfo/main.go"),
+		Timeout:      awscdk.Duration_Minutes(jsii.Number(15)),
+	})
+
+	return &JobsStack{
+		Stack: stack,
+	}
+}
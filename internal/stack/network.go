@@ -17,6 +17,9 @@ type NetworkStack struct {
 	Stack                             awscdk.Stack
 	Vpc                               awsec2.Vpc
 	LambdaSecretsManagerSecurityGroup awsec2.SecurityGroup
+	// LambdaS3SecurityGroup lets a lambda in the vpc reach S3 through the gateway endpoint
+	// in BastionStack
+	LambdaS3SecurityGroup awsec2.SecurityGroup
 }
 
 func NewNetworkStack(scope constructs.Construct, id string, props *NetworkStackProps) *NetworkStack {
@@ -72,10 +75,84 @@ func NewNetworkStack(scope constructs.Construct, id string, props *NetworkStackP
 		SecurityGroups:    &[]awsec2.ISecurityGroup{secretsManagerVpcEndpointSecurityGroup},
 	})
 
+	// every database lambda encrypts student info with KMS, so it goes through the
+	// same security group as secrets manager
+	kmsVpcEndpointSecurityGroup := createSecurityGroup(stack, vpc, "kms-vpc-endpoint")
+	kmsVpcEndpointSecurityGroup.AddIngressRule(
+		lambdaSecretsManagerSecurityGroup,
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections from lambda."),
+		jsii.Bool(false))
+
+	lambdaSecretsManagerSecurityGroup.AddEgressRule(
+		kmsVpcEndpointSecurityGroup,
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections to KMS VPC endpoint."),
+		jsii.Bool(false))
+
+	vpc.AddInterfaceEndpoint(jsii.String("kms-endpoint"), &awsec2.InterfaceVpcEndpointOptions{
+		Service:           awsec2.InterfaceVpcEndpointAwsService_KMS(),
+		PrivateDnsEnabled: jsii.Bool(true),
+		Open:              jsii.Bool(false),
+		SecurityGroups:    &[]awsec2.ISecurityGroup{kmsVpcEndpointSecurityGroup},
+	})
+
+	// the events function invokes a function outside the vpc to invalidate CloudFront,
+	// see publicutils.Invalidate
+	lambdaVpcEndpointSecurityGroup := createSecurityGroup(stack, vpc, "lambda-vpc-endpoint")
+	lambdaVpcEndpointSecurityGroup.AddIngressRule(
+		lambdaSecretsManagerSecurityGroup,
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections from lambda."),
+		jsii.Bool(false))
+
+	lambdaSecretsManagerSecurityGroup.AddEgressRule(
+		lambdaVpcEndpointSecurityGroup,
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections to Lambda VPC endpoint."),
+		jsii.Bool(false))
+
+	vpc.AddInterfaceEndpoint(jsii.String("lambda-endpoint"), &awsec2.InterfaceVpcEndpointOptions{
+		Service:           awsec2.InterfaceVpcEndpointAwsService_LAMBDA(),
+		PrivateDnsEnabled: jsii.Bool(true),
+		Open:              jsii.Bool(false),
+		SecurityGroups:    &[]awsec2.ISecurityGroup{lambdaVpcEndpointSecurityGroup},
+	})
+
+	// the privacy function deletes the sign in accounts of erased students
+	cognitoVpcEndpointSecurityGroup := createSecurityGroup(stack, vpc, "cognito-vpc-endpoint")
+	cognitoVpcEndpointSecurityGroup.AddIngressRule(
+		lambdaSecretsManagerSecurityGroup,
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections from lambda."),
+		jsii.Bool(false))
+
+	lambdaSecretsManagerSecurityGroup.AddEgressRule(
+		cognitoVpcEndpointSecurityGroup,
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections to Cognito VPC endpoint."),
+		jsii.Bool(false))
+
+	vpc.AddInterfaceEndpoint(jsii.String("cognito-endpoint"), &awsec2.InterfaceVpcEndpointOptions{
+		Service:           awsec2.NewInterfaceVpcEndpointAwsService(jsii.String("cognito-idp"), nil, nil, nil),
+		PrivateDnsEnabled: jsii.Bool(true),
+		Open:              jsii.Bool(false),
+		SecurityGroups:    &[]awsec2.ISecurityGroup{cognitoVpcEndpointSecurityGroup},
+	})
+
+	// there's no NAT, so the only place https can go from the subnets is the endpoints
+	lambdaS3SecurityGroup := createSecurityGroup(stack, vpc, "lambda-s3")
+	lambdaS3SecurityGroup.AddEgressRule(
+		awsec2.Peer_AnyIpv4(),
+		awsec2.Port_Tcp(jsii.Number(443)),
+		jsii.String("Allow connections to S3 through the gateway endpoint."),
+		jsii.Bool(false))
+
 	return &NetworkStack{
 		Stack:                             stack,
 		Vpc:                               vpc,
 		LambdaSecretsManagerSecurityGroup: lambdaSecretsManagerSecurityGroup,
+		LambdaS3SecurityGroup:             lambdaS3SecurityGroup,
 	}
 }
 
@@ -0,0 +1,197 @@
+package stack
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk/v2" // core
+	"github.com/aws/aws-cdk-go/awscdk/v2/awswafv2"
+
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// web ACLs attached to CloudFront have to be created in us-east-1. The distributions
+// take them from this stack directly, so NewSecurityStack refuses any other region
+// and the whole app has to be deployed there.
+const (
+	wafScope  = "CLOUDFRONT"
+	wafRegion = "us-east-1"
+)
+
+type SecurityStackProps struct {
+	Props awscdk.StackProps
+
+	// AllowedIpAddresses skip every other rule, e.g. the club's office or CI runners (CIDR notation)
+	AllowedIpAddresses []string
+	// BlockedIpAddresses are always blocked (CIDR notation)
+	BlockedIpAddresses []string
+
+	// RateLimit is the most requests one IP can make in 5 minutes, defaults to 2000
+	RateLimit float64
+	// PresignRateLimit is the same but only for /presign, defaults to 100
+	PresignRateLimit float64
+}
+
+type SecurityStack struct {
+	Stack awscdk.Stack
+
+	// FrontendWebAcl is for the frontend distributions
+	FrontendWebAcl awswafv2.CfnWebACL
+	// ApiWebAcl is for the distribution in front of ClubEventApi. HTTP APIs can't be
+	// associated with WAF directly, so the API is fronted by CloudFront (see ApiStack)
+	ApiWebAcl awswafv2.CfnWebACL
+}
+
+func NewSecurityStack(scope constructs.Construct, id string, props *SecurityStackProps) *SecurityStack {
+	var sprops awscdk.StackProps
+	if props != nil {
+		sprops = props.Props
+	} else {
+		props = &SecurityStackProps{}
+	}
+	stack := awscdk.NewStack(scope, &id, &sprops)
+	if region := stack.Region(); *awscdk.Token_IsUnresolved(region) || *region != wafRegion {
+		panic(fmt.Sprintf("%s has to be deployed to %s for CloudFront to use its web ACLs, set CDK_DEFAULT_REGION to it (got %q)",
+			id, wafRegion, *region))
+	}
+
+	rateLimit := props.RateLimit
+	if rateLimit == 0 {
+		rateLimit = 2000
+	}
+	presignRateLimit := props.PresignRateLimit
+	if presignRateLimit == 0 {
+		presignRateLimit = 100
+	}
+
+	// ====================================
+	// ip allow and block lists
+	// ====================================
+	allowList := awswafv2.NewCfnIPSet(stack, jsii.String("AllowList"), &awswafv2.CfnIPSetProps{
+		Name:             jsii.String("gwc-allow-list"),
+		Scope:            jsii.String(wafScope),
+		IpAddressVersion: jsii.String("IPV4"),
+		Addresses:        jsii.Strings(props.AllowedIpAddresses...),
+	})
+
+	blockList := awswafv2.NewCfnIPSet(stack, jsii.String("BlockList"), &awswafv2.CfnIPSetProps{
+		Name:             jsii.String("gwc-block-list"),
+		Scope:            jsii.String(wafScope),
+		IpAddressVersion: jsii.String("IPV4"),
+		Addresses:        jsii.Strings(props.BlockedIpAddresses...),
+	})
+
+	// ====================================
+	// web acls
+	// ====================================
+	frontendWebAcl := awswafv2.NewCfnWebACL(stack, jsii.String("FrontendWebAcl"), &awswafv2.CfnWebACLProps{
+		Name:             jsii.String("gwc-frontend"),
+		Scope:            jsii.String(wafScope),
+		DefaultAction:    &awswafv2.CfnWebACL_DefaultActionProperty{Allow: &awswafv2.CfnWebACL_AllowActionProperty{}},
+		VisibilityConfig: visibility("gwc-frontend"),
+		Rules: &[]interface{}{
+			ipSetRule("AllowList", 0, allowList, true),
+			ipSetRule("BlockList", 1, blockList, false),
+			rateLimitRule("RateLimit", 2, rateLimit, ""),
+			managedRule("AWSManagedRulesAmazonIpReputationList", 3),
+			managedRule("AWSManagedRulesCommonRuleSet", 4),
+			managedRule("AWSManagedRulesKnownBadInputsRuleSet", 5),
+		},
+	})
+
+	apiWebAcl := awswafv2.NewCfnWebACL(stack, jsii.String("ApiWebAcl"), &awswafv2.CfnWebACLProps{
+		Name:             jsii.String("gwc-api"),
+		Scope:            jsii.String(wafScope),
+		DefaultAction:    &awswafv2.CfnWebACL_DefaultActionProperty{Allow: &awswafv2.CfnWebACL_AllowActionProperty{}},
+		VisibilityConfig: visibility("gwc-api"),
+		Rules: &[]interface{}{
+			ipSetRule("AllowList", 0, allowList, true),
+			ipSetRule("BlockList", 1, blockList, false),
+			// presigned urls cost us storage, so they get a much tighter limit than the rest
+			rateLimitRule("PresignRateLimit", 2, presignRateLimit, "/presign"),
+			rateLimitRule("RateLimit", 3, rateLimit, ""),
+			managedRule("AWSManagedRulesAmazonIpReputationList", 4),
+			managedRule("AWSManagedRulesCommonRuleSet", 5),
+			managedRule("AWSManagedRulesKnownBadInputsRuleSet", 6),
+		},
+	})
+
+	return &SecurityStack{
+		Stack:          stack,
+		FrontendWebAcl: frontendWebAcl,
+		ApiWebAcl:      apiWebAcl,
+	}
+}
+
+func visibility(metricName string) *awswafv2.CfnWebACL_VisibilityConfigProperty {
+	return &awswafv2.CfnWebACL_VisibilityConfigProperty{
+		CloudWatchMetricsEnabled: jsii.Bool(true),
+		MetricName:               jsii.String(metricName),
+		SampledRequestsEnabled:   jsii.Bool(true),
+	}
+}
+
+// ipSetRule allows (or blocks) every request coming from an address in the set
+func ipSetRule(name string, priority float64, ipSet awswafv2.CfnIPSet, allow bool) *awswafv2.CfnWebACL_RuleProperty {
+	action := &awswafv2.CfnWebACL_RuleActionProperty{Block: &awswafv2.CfnWebACL_BlockActionProperty{}}
+	if allow {
+		action = &awswafv2.CfnWebACL_RuleActionProperty{Allow: &awswafv2.CfnWebACL_AllowActionProperty{}}
+	}
+
+	return &awswafv2.CfnWebACL_RuleProperty{
+		Name:     jsii.String(name),
+		Priority: jsii.Number(priority),
+		Action:   action,
+		Statement: &awswafv2.CfnWebACL_StatementProperty{
+			IpSetReferenceStatement: &awswafv2.CfnWebACL_IPSetReferenceStatementProperty{
+				Arn: ipSet.AttrArn(),
+			},
+		},
+		VisibilityConfig: visibility(name),
+	}
+}
+
+// rateLimitRule blocks an IP once it goes over limit requests in 5 minutes. With a
+// pathPrefix only requests to paths starting with it are counted.
+func rateLimitRule(name string, priority float64, limit float64, pathPrefix string) *awswafv2.CfnWebACL_RuleProperty {
+	statement := &awswafv2.CfnWebACL_RateBasedStatementProperty{
+		AggregateKeyType: jsii.String("IP"),
+		Limit:            jsii.Number(limit),
+	}
+	if pathPrefix != "" {
+		statement.ScopeDownStatement = &awswafv2.CfnWebACL_StatementProperty{
+			ByteMatchStatement: &awswafv2.CfnWebACL_ByteMatchStatementProperty{
+				FieldToMatch:         &awswafv2.CfnWebACL_FieldToMatchProperty{UriPath: map[string]interface{}{}},
+				PositionalConstraint: jsii.String("STARTS_WITH"),
+				SearchString:         jsii.String(pathPrefix),
+				TextTransformations: &[]interface{}{
+					&awswafv2.CfnWebACL_TextTransformationProperty{Priority: jsii.Number(0), Type: jsii.String("LOWERCASE")},
+				},
+			},
+		}
+	}
+
+	return &awswafv2.CfnWebACL_RuleProperty{
+		Name:             jsii.String(name),
+		Priority:         jsii.Number(priority),
+		Action:           &awswafv2.CfnWebACL_RuleActionProperty{Block: &awswafv2.CfnWebACL_BlockActionProperty{}},
+		Statement:        &awswafv2.CfnWebACL_StatementProperty{RateBasedStatement: statement},
+		VisibilityConfig: visibility(name),
+	}
+}
+
+// managedRule adds one of the AWS managed rule groups with its own actions
+func managedRule(name string, priority float64) *awswafv2.CfnWebACL_RuleProperty {
+	return &awswafv2.CfnWebACL_RuleProperty{
+		Name:           jsii.String(name),
+		Priority:       jsii.Number(priority),
+		OverrideAction: &awswafv2.CfnWebACL_OverrideActionProperty{None: map[string]interface{}{}},
+		Statement: &awswafv2.CfnWebACL_StatementProperty{
+			ManagedRuleGroupStatement: &awswafv2.CfnWebACL_ManagedRuleGroupStatementProperty{
+				VendorName: jsii.String("AWS"),
+				Name:       jsii.String(name),
+			},
+		},
+		VisibilityConfig: visibility(name),
+	}
+}
@@ -2,6 +2,8 @@ package stack
 
 import (
 	"github.com/aws/aws-cdk-go/awscdk/v2" // core
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudfront"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudfrontorigins"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
@@ -9,11 +11,25 @@ import (
 
 type StorageStackProps struct {
 	Props awscdk.StackProps
+
+	// FrontendOrigins can upload member form exports from the browser, e.g.
+	// https://d111111abcdef8.cloudfront.net. The distributions are made in FrontendStack,
+	// which depends on this one, so they're configured instead of passed in.
+	FrontendOrigins []string
 }
 
 type StorageStack struct {
 	Stack  awscdk.Stack
 	Bucket awss3.Bucket
+
+	// ImportsBucket holds uploaded member form exports and their import reports. It's
+	// kept apart from Bucket since everything in that one is served by ImageDistribution.
+	ImportsBucket awss3.Bucket
+	// ExportsBucket holds the archives students download with their data
+	ExportsBucket awss3.Bucket
+
+	// ImageDistribution serves the uploaded images
+	ImageDistribution awscloudfront.Distribution
 }
 
 func NewStorageStack(scope constructs.Construct, id string, props *StorageStackProps) *StorageStack {
@@ -53,5 +69,82 @@ func NewStorageStack(scope constructs.Construct, id string, props *StorageStackP
 		Value: imageBucket.BucketName(),
 	})
 
-	return &StorageStack{Stack: stack, Bucket: imageBucket}
+	// the bucket stays private, images are read through cloudfront like the frontend
+	imageOAI := awscloudfront.NewOriginAccessIdentity(stack, jsii.String("ImageOAI"), &awscloudfront.OriginAccessIdentityProps{})
+
+	imageBucket.GrantRead(imageOAI, nil)
+
+	imageDistribution := awscloudfront.NewDistribution(stack, jsii.String("ImageCdn"), &awscloudfront.DistributionProps{
+		DefaultBehavior: &awscloudfront.BehaviorOptions{
+			Origin: awscloudfrontorigins.NewS3Origin(imageBucket, &awscloudfrontorigins.S3OriginProps{
+				OriginAccessIdentity: imageOAI,
+			}),
+			ViewerProtocolPolicy: awscloudfront.ViewerProtocolPolicy_REDIRECT_TO_HTTPS,
+		},
+	})
+
+	awscdk.NewCfnOutput(stack, jsii.String("CloudFront_Image_Info"), &awscdk.CfnOutputProps{
+		Description: jsii.String("Image CDN CloudFront Info"),
+		Value: jsii.String("Image URL: https://" + *imageDistribution.DomainName() +
+			" | ID: " + *imageDistribution.DistributionId()),
+	})
+
+	// ====================================
+	// member form imports
+	// ====================================
+	// the exports have emails and emplids in them, so they're only kept long enough to
+	// look at the reports. Uploads are sent to EventBridge, JobsStack picks them up there.
+	importsBucket := awss3.NewBucket(stack, jsii.String("ImportsBucket"), &awss3.BucketProps{
+		BlockPublicAccess:  awss3.BlockPublicAccess_BLOCK_ALL(),
+		Encryption:         awss3.BucketEncryption_S3_MANAGED,
+		EnforceSSL:         jsii.Bool(true),
+		EventBridgeEnabled: jsii.Bool(true),
+		LifecycleRules: &[]*awss3.LifecycleRule{
+			{Expiration: awscdk.Duration_Days(jsii.Number(30))},
+		},
+		RemovalPolicy:     awscdk.RemovalPolicy_DESTROY,
+		AutoDeleteObjects: jsii.Bool(true),
+	})
+
+	// the admin site uploads with the presigned urls from GET /imports/upload-url. CORS only
+	// keeps other sites' pages from using them in a browser, what limits uploads is that
+	// only admins get a url and it expires after 5 minutes.
+	if props != nil && len(props.FrontendOrigins) > 0 {
+		importsBucket.AddCorsRule(&awss3.CorsRule{
+			AllowedOrigins: jsii.Strings(props.FrontendOrigins...),
+			AllowedMethods: &[]awss3.HttpMethods{awss3.HttpMethods_PUT},
+			AllowedHeaders: &[]*string{jsii.String("*")},
+		})
+	}
+
+	// ====================================
+	// student data exports
+	// ====================================
+	// archives are downloaded with presigned urls that last minutes, nothing needs them
+	// after a week
+	exportsBucket := awss3.NewBucket(stack, jsii.String("ExportsBucket"), &awss3.BucketProps{
+		BlockPublicAccess: awss3.BlockPublicAccess_BLOCK_ALL(),
+		Encryption:        awss3.BucketEncryption_S3_MANAGED,
+		EnforceSSL:        jsii.Bool(true),
+		LifecycleRules: &[]*awss3.LifecycleRule{
+			{Expiration: awscdk.Duration_Days(jsii.Number(7))},
+		},
+		RemovalPolicy:     awscdk.RemovalPolicy_DESTROY,
+		AutoDeleteObjects: jsii.Bool(true),
+	})
+
+	// the site downloads the archive with the presigned url from POST /students/{studentId}/export
+	exportsBucket.AddCorsRule(&awss3.CorsRule{
+		AllowedOrigins: &[]*string{jsii.String("*")},
+		AllowedMethods: &[]awss3.HttpMethods{awss3.HttpMethods_GET},
+		AllowedHeaders: &[]*string{jsii.String("*")},
+	})
+
+	return &StorageStack{
+		Stack:             stack,
+		Bucket:            imageBucket,
+		ImageDistribution: imageDistribution,
+		ImportsBucket:     importsBucket,
+		ExportsBucket:     exportsBucket,
+	}
 }
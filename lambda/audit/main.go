@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+const maxPageSize = 100
+
+var router = apiutils.Router{
+	"GET /audit-log": listEntries,
+}
+
+// listEntries is admin only, newest first, e.g.
+// GET /audit-log?actorId=42&entity=event&entityId=7&from=2026-10-01&to=2026-10-31&limit=50&offset=0.
+// from and to are RFC 3339 timestamps or dates, a date for to includes the whole day.
+func listEntries(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	filter := auditutils.Filter{Entity: evt.QueryStringParameters["entity"]}
+	var err error
+	for name, dst := range map[string]*int64{"actorId": &filter.ActorID, "entityId": &filter.EntityID, "offset": &filter.Offset} {
+		if *dst, err = apiutils.QueryInt(evt, name, 0); err != nil {
+			return apiutils.Fail(err)
+		}
+	}
+	if filter.Limit, err = apiutils.QueryInt(evt, "limit", 50); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.Limit < 1 || filter.Limit > maxPageSize || filter.Offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+	if filter.From, err = queryTime(evt, "from", false); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.To, err = queryTime(evt, "to", true); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	entries, err := auditutils.Entries(ctx, db, filter)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"entries": entries, "limit": filter.Limit, "offset": filter.Offset})
+}
+
+// queryTime reads an optional timestamp or date, dates are midnight UTC. endOfDay
+// moves a date to the next midnight so the day is included.
+func queryTime(evt events.APIGatewayV2HTTPRequest, name string, endOfDay bool) (time.Time, error) {
+	value := evt.QueryStringParameters[name]
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, apiutils.Errorf(http.StatusBadRequest, "%s must be a date or an RFC 3339 timestamp", name)
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+func main() {
+	lambda.Start(router.Handle)
+}
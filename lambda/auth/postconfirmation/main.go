@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	importutils "cdk-infrastructure/utils/imports"
+)
+
+// handler links a newly confirmed Cognito user to a STUDENTS row, creating one if the
+// email hasn't been seen before. Members who filled out the membership form before
+// signing up also get their STUDENT_INFO filled in from MEMBER_FORM_DATA.
+//
+// Cognito retries the trigger on failure, so everything here has to be safe to run twice.
+func handler(ctx context.Context, event events.CognitoEventUserPoolsPostConfirmation) (events.CognitoEventUserPoolsPostConfirmation, error) {
+	// also fires after a forgotten password is reset, nothing to link then
+	if event.TriggerSource != "PostConfirmation_ConfirmSignUp" {
+		return event, nil
+	}
+
+	attributes := event.Request.UserAttributes
+	sub := attributes["sub"]
+	email := strings.ToLower(strings.TrimSpace(attributes["email"]))
+	if sub == "" || email == "" {
+		return event, fmt.Errorf("user %s is missing sub or email", event.UserName)
+	}
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return event, err
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		studentID, err := linkStudent(ctx, tx, sub, email, attributes["given_name"], attributes["family_name"])
+		if err != nil {
+			return err
+		}
+		return importMemberForm(ctx, tx, studentID, email)
+	})
+	if err != nil {
+		log.Printf("linking %s failed: %v", sub, err)
+		return event, err
+	}
+
+	return event, nil
+}
+
+// linkStudent returns the id of the STUDENTS row for the cognito user, linking an existing
+// row with the same email or inserting a new one
+func linkStudent(ctx context.Context, tx *sql.Tx, sub, email, firstName, lastName string) (int64, error) {
+	var studentID int64
+	err := tx.QueryRowContext(ctx, "SELECT `id` FROM `STUDENTS` WHERE `cognito_sub` = ?", sub).Scan(&studentID)
+	if err == nil {
+		return studentID, nil // already linked by an earlier attempt
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	var linkedSub sql.NullString
+	err = tx.QueryRowContext(ctx,
+		"SELECT `id`, `cognito_sub` FROM `STUDENTS` WHERE LOWER(`email`) = ? ORDER BY `id` LIMIT 1 FOR UPDATE",
+		email,
+	).Scan(&studentID, &linkedSub)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO `STUDENTS` (`first_name`, `last_name`, `email`, `cognito_sub`) VALUES (?, ?, ?, ?)",
+			firstName, lastName, email, sub,
+		)
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("created student for %s", sub)
+		return result.LastInsertId()
+
+	case err != nil:
+		return 0, err
+	}
+
+	// a different sub means the old cognito user was deleted and the student signed up again
+	if linkedSub.Valid {
+		log.Printf("relinking student %d from %s to %s", studentID, linkedSub.String, sub)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE `STUDENTS` SET `cognito_sub` = ?, "+
+			"`first_name` = COALESCE(NULLIF(`first_name`, ''), ?), "+
+			"`last_name` = COALESCE(NULLIF(`last_name`, ''), ?) "+
+			"WHERE `id` = ?",
+		sub, firstName, lastName, studentID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("linked student %d to %s", studentID, sub)
+	return studentID, nil
+}
+
+// importMemberForm imports the student's pending membership forms now instead of at
+// the next import, through the same checks the import job runs
+func importMemberForm(ctx context.Context, tx *sql.Tx, studentID int64, email string) error {
+	results, err := importutils.ImportEmail(ctx, tx, email)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		log.Printf("imported member form %d for student %d: %s %s", result.RowID, studentID, result.Status, result.Message)
+	}
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// allowedDomains comes from ALLOWED_EMAIL_DOMAINS, a comma separated list like
+// "hunter.cuny.edu,myhunter.cuny.edu". Subdomains are not allowed implicitly.
+var allowedDomains []string
+
+func init() {
+	for _, domain := range strings.Split(os.Getenv("ALLOWED_EMAIL_DOMAINS"), ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			allowedDomains = append(allowedDomains, domain)
+		}
+	}
+}
+
+// handler rejects sign ups from email addresses outside the allowed domains. Cognito
+// shows the returned error to the user as "PreSignUp failed with error <message>".
+func handler(ctx context.Context, event events.CognitoEventUserPoolsPreSignup) (events.CognitoEventUserPoolsPreSignup, error) {
+	email := strings.ToLower(strings.TrimSpace(event.Request.UserAttributes["email"]))
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return event, fmt.Errorf("a valid email address is required")
+	}
+
+	domain := email[at+1:]
+	for _, allowed := range allowedDomains {
+		if domain == allowed {
+			return event, nil
+		}
+	}
+
+	log.Printf("rejected sign up from domain %s", domain)
+	return event, fmt.Errorf("sign up is limited to %s email addresses", strings.Join(allowedDomains, ", "))
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	calendarutils "cdk-infrastructure/utils/calendar"
+	clubutils "cdk-infrastructure/utils/clubs"
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// the .ics routes are public since calendar apps can't sign in, a student's feed is
+// found by the signed token in its path instead
+var router = apiutils.Router{
+	"GET /clubs/{clubId}/calendar.ics": clubCalendar,
+	"GET /calendar/{token}/events.ics": studentCalendar,
+	"GET /students/me/calendar":        calendarURL,
+	"POST /students/me/calendar/reset": resetCalendarURL,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG, the token version is all
+// that changes so nothing is loaded
+var audits = map[string]auditutils.Target{
+	"POST /students/me/calendar/reset": {Entity: "student", Param: auditutils.ParamMe},
+}
+
+// clubCalendar is the feed of the events a club hosts, e.g. GET /clubs/3/calendar.ics
+func clubCalendar(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	club, err := clubutils.Get(ctx, db, clubID)
+	if errors.Is(err, clubutils.ErrNotFound) {
+		return apiutils.Error(http.StatusNotFound, "club not found")
+	}
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	entries, err := calendarutils.ClubEntries(ctx, db, clubID, time.Now().Add(-calendarutils.History))
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	name := "Club events"
+	if club.Name != nil {
+		name = *club.Name
+	}
+	return ics(calendarutils.Calendar{Name: name, Entries: entries}, "public")
+}
+
+// studentCalendar is the feed of the events a student is going to or might go to,
+// e.g. GET /calendar/eyJzIjo0Mn0.c2lnbmF0dXJl/events.ics
+func studentCalendar(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	key, err := calendarutils.Key(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := calendarutils.Authorize(ctx, db, key, evt.PathParameters["token"])
+	if errors.Is(err, calendarutils.ErrInvalidToken) {
+		// the same answer as an unknown path, so tokens can't be probed
+		return apiutils.Error(http.StatusNotFound, "calendar not found")
+	}
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	entries, err := calendarutils.StudentEntries(ctx, db, studentID, time.Now().Add(-calendarutils.History))
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return ics(calendarutils.Calendar{Name: "My club events", Entries: entries}, "private")
+}
+
+// calendarURL returns the caller's personal feed URL, and the webcal:// form calendar
+// apps subscribe to when it's opened
+func calendarURL(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, studentID, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	version, err := calendarutils.TokenVersion(ctx, db, studentID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return feedURL(ctx, studentID, version)
+}
+
+// resetCalendarURL revokes the caller's feed URLs, e.g. after one was shared by mistake,
+// and returns the new one like GET /students/me/calendar. Subscriptions to the old
+// URL stop updating.
+func resetCalendarURL(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, studentID, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	version, err := calendarutils.ResetToken(ctx, db, studentID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return feedURL(ctx, studentID, version)
+}
+
+// caller connects to the database and returns the signed in student
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, int64, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, 0, err
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return db, studentID, nil
+}
+
+// feedURL responds with the student's feed url on the distribution in API_URL, the
+// api's own domain rejects requests that don't come through it
+func feedURL(ctx context.Context, studentID, version int64) (events.APIGatewayV2HTTPResponse, error) {
+	key, err := calendarutils.Key(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	host := strings.TrimPrefix(os.Getenv("API_URL"), "https://")
+	path := host + "/calendar/" + calendarutils.Sign(key, studentID, version) + "/events.ics"
+
+	return apiutils.JSON(http.StatusOK, map[string]string{
+		"url":    "https://" + path,
+		"webcal": "webcal://" + path,
+	})
+}
+
+// ics responds with the calendar. Calendar apps poll, so the feed can be cached for a
+// while, privately for a student's feed.
+func ics(calendar calendarutils.Calendar, cache string) (events.APIGatewayV2HTTPResponse, error) {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":  "text/calendar; charset=utf-8",
+			"Cache-Control": cache + ", max-age=900",
+		},
+		Body: calendar.ICS(),
+	}, nil
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
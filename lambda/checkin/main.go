@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	checkinutils "cdk-infrastructure/utils/checkin"
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+const (
+	defaultTokenMinutes = 15
+	maxTokenMinutes     = 240 // long enough to leave one code up for a whole event
+)
+
+var router = apiutils.Router{
+	"GET /events/{eventId}/checkin-token": checkinToken,
+	"POST /checkin":                       checkIn,
+	"GET /events/{eventId}/checkins":      listCheckIns,
+	"PUT /events/{eventId}/point-source":  putPointSource,
+	"GET /point-sources":                  listPointSources,
+	"POST /point-sources":                 createPointSource,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG. Check-ins are their own
+// record, the entry only says who checked in when.
+var audits = map[string]auditutils.Target{
+	"POST /checkin":                      {Entity: "checkin", Param: auditutils.ParamMe},
+	"PUT /events/{eventId}/point-source": {Entity: "event", Param: "eventId", Load: loadEvent},
+	"POST /point-sources":                {Entity: "point_source", Load: loadPointSource},
+}
+
+func loadEvent(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, eventID int64) (any, error) {
+	event, err := eventutils.Get(ctx, q, eventID)
+	if errors.Is(err, eventutils.ErrNotFound) {
+		return nil, nil
+	}
+	return event, err
+}
+
+func loadPointSource(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, sourceID int64) (any, error) {
+	source, err := pointutils.GetSource(ctx, q, sourceID)
+	if errors.Is(err, pointutils.ErrNotFound) {
+		return nil, nil
+	}
+	return source, err
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+// checkinToken signs a token for the QR code shown at the event, e.g.
+// GET /events/7/checkin-token?minutes=30. The frontend encodes it in the QR code and
+// students' phones send it back to POST /checkin.
+func checkinToken(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	minutes, err := apiutils.QueryInt(evt, "minutes", defaultTokenMinutes)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if minutes < 1 || minutes > maxTokenMinutes {
+		return apiutils.Error(http.StatusBadRequest, "minutes must be between 1 and 240")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	event, err := eventutils.Get(ctx, db, eventID)
+	if err != nil {
+		return checkinErr(err)
+	}
+	if !event.Visible() {
+		return apiutils.Error(http.StatusConflict, "only posted events can be checked in to")
+	}
+
+	key, err := checkinutils.Key(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	expires := time.Now().Add(time.Duration(minutes) * time.Minute).UTC().Truncate(time.Second)
+
+	return apiutils.JSON(http.StatusOK, map[string]any{
+		"token":     checkinutils.Sign(key, eventID, expires),
+		"expiresAt": expires,
+	})
+}
+
+type checkInBody struct {
+	Token string `json:"token"`
+}
+
+// checkIn records the signed in student's attendance and awards the event's points once
+func checkIn(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body checkInBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	key, err := checkinutils.Key(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	eventID, err := checkinutils.Verify(key, strings.TrimSpace(body.Token), time.Now())
+	if err != nil {
+		return checkinErr(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var record *checkinutils.CheckIn
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		// the token outlives a delete or unpublish, the event doesn't
+		if !event.Visible() {
+			return eventutils.ErrNotFound
+		}
+		record, err = checkinutils.Record(ctx, tx, event, studentID)
+		return err
+	})
+	if err != nil {
+		return checkinErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, record)
+}
+
+func listCheckIns(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	attendance, err := checkinutils.List(ctx, db, eventID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"checkins": attendance})
+}
+
+type pointSourceBody struct {
+	// PointSourceID is what checking in awards, null for nothing
+	PointSourceID *int64 `json:"pointSourceId"`
+}
+
+func putPointSource(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body pointSourceBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		return checkinutils.SetPointSource(ctx, tx, event, body.PointSourceID)
+	})
+	if err != nil {
+		return checkinErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, body)
+}
+
+func listPointSources(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	sources, err := pointutils.Sources(ctx, db)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"pointSources": sources})
+}
+
+type createSourceBody struct {
+	Title  string `json:"title"`
+	Points int64  `json:"points"`
+}
+
+// createPointSource is admin only since every club's events draw from the same sources
+func createPointSource(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body createSourceBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	source, err := pointutils.CreateSource(ctx, db, strings.TrimSpace(body.Title), body.Points)
+	if err != nil {
+		return checkinErr(err)
+	}
+	return apiutils.JSON(http.StatusCreated, source)
+}
+
+// checkinErr maps the util package errors to their status codes
+func checkinErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, checkinutils.ErrExpiredToken):
+		return apiutils.Error(http.StatusGone, err.Error())
+	case errors.Is(err, checkinutils.ErrInvalidToken):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, eventutils.ErrNotFound), errors.Is(err, pointutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, pointutils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	clubutils "cdk-infrastructure/utils/clubs"
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+var (
+	presignClient *s3.PresignClient
+	imageBucket   = os.Getenv("IMAGE_BUCKET_NAME")
+)
+
+// icons are shown on the public site, svg is left out since it can carry scripts
+var iconTypes = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/webp": "webp",
+}
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	presignClient = s3.NewPresignClient(s3.NewFromConfig(cfg))
+}
+
+var router = apiutils.Router{
+	"GET /clubs":                                   listClubs,
+	"POST /clubs":                                  createClub,
+	"GET /clubs/{clubId}":                          getClub,
+	"PATCH /clubs/{clubId}":                        patchClub,
+	"GET /clubs/{clubId}/icon-upload":              iconUpload,
+	"GET /clubs/{clubId}/members":                  listMembers,
+	"POST /clubs/{clubId}/members":                 join,
+	"DELETE /clubs/{clubId}/members/me":            leave,
+	"DELETE /clubs/{clubId}/members/{studentId}":   removeMember,
+	"PUT /clubs/{clubId}/members/{studentId}/role": setRole,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG
+var audits = map[string]auditutils.Target{
+	"POST /clubs":                                  {Entity: "club", Load: loadClub},
+	"PATCH /clubs/{clubId}":                        {Entity: "club", Param: "clubId", Load: loadClub},
+	"POST /clubs/{clubId}/members":                 {Entity: "club_member", Param: auditutils.ParamMe, Load: loadMember},
+	"DELETE /clubs/{clubId}/members/me":            {Entity: "club_member", Param: auditutils.ParamMe, Load: loadMember},
+	"DELETE /clubs/{clubId}/members/{studentId}":   {Entity: "club_member", Param: "studentId", Load: loadMember},
+	"PUT /clubs/{clubId}/members/{studentId}/role": {Entity: "club_member", Param: "studentId", Load: loadMember},
+}
+
+func loadClub(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, clubID int64) (any, error) {
+	club, err := clubutils.Get(ctx, q, clubID)
+	if errors.Is(err, clubutils.ErrNotFound) {
+		return nil, nil
+	}
+	return club, err
+}
+
+// loadMember is the student's membership of the club in the path
+func loadMember(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, studentID int64) (any, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return nil, err
+	}
+	roles, err := authutils.NewSQLStore(q).ClubRoles(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := roles[clubID]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]any{"clubId": clubID, "studentId": studentID, "role": role}, nil
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+// withMyRole fills in the caller's role in each club, if they have one
+func withMyRole(ctx context.Context, c *authutils.Caller, clubs ...*clubutils.Club) error {
+	roles, err := c.Roles(ctx)
+	if errors.Is(err, authutils.ErrNoStudent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, club := range clubs {
+		if role, ok := roles[club.ID]; ok {
+			club.MyRole = aws.String(string(role))
+		}
+	}
+	return nil
+}
+
+func listClubs(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	clubs, err := clubutils.List(ctx, db)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := withMyRole(ctx, c, clubs...); err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"clubs": clubs})
+}
+
+func getClub(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	club, err := clubutils.Get(ctx, db, clubID)
+	if err != nil {
+		return clubResponse(http.StatusOK, nil, err)
+	}
+	if err := withMyRole(ctx, c, club); err != nil {
+		return apiutils.Fail(err)
+	}
+	return clubResponse(http.StatusOK, club, nil)
+}
+
+type createBody struct {
+	Name string `json:"name"`
+	// EboardStudentID becomes the club's first eboard member, defaults to the caller
+	EboardStudentID int64 `json:"eboardStudentId"`
+}
+
+// createClub is admin only, every club starts with one eboard member so someone can manage it
+func createClub(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body createBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 255 {
+		return apiutils.Error(http.StatusBadRequest, "name is required and can be at most 255 characters")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+	if body.EboardStudentID == 0 {
+		if body.EboardStudentID, err = c.StudentID(ctx); err != nil {
+			return apiutils.Fail(err)
+		}
+	}
+
+	var clubID int64
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		clubID, err = clubutils.Create(ctx, tx, body.Name, body.EboardStudentID)
+		return err
+	})
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	club, err := clubutils.Get(ctx, db, clubID)
+	return clubResponse(http.StatusCreated, club, err)
+}
+
+type patchBody struct {
+	Name *string `json:"name"`
+	// Icon is the key returned by GET /clubs/{clubId}/icon-upload after the upload finished
+	Icon *string `json:"icon"`
+}
+
+func patchClub(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body patchBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+	if body.Name != nil {
+		*body.Name = strings.TrimSpace(*body.Name)
+		if *body.Name == "" || len(*body.Name) > 255 {
+			return apiutils.Error(http.StatusBadRequest, "name can't be empty or longer than 255 characters")
+		}
+	}
+	// only keys handed out for this club, otherwise a club could point at any object in the bucket
+	if body.Icon != nil && !strings.HasPrefix(*body.Icon, iconPrefix(clubID)) {
+		return apiutils.Error(http.StatusBadRequest, "icon must be a key from /clubs/{clubId}/icon-upload")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		club, err := clubutils.Get(ctx, tx, clubID)
+		if err != nil {
+			return err
+		}
+		if body.Name != nil {
+			club.Name = body.Name
+		}
+		if body.Icon != nil {
+			club.Icon = body.Icon
+		}
+		return clubutils.Update(ctx, tx, club)
+	})
+	if err != nil {
+		return clubResponse(http.StatusOK, nil, err)
+	}
+
+	club, err := clubutils.Get(ctx, db, clubID)
+	return clubResponse(http.StatusOK, club, err)
+}
+
+func iconPrefix(clubID int64) string {
+	return fmt.Sprintf("clubs/%d/", clubID)
+}
+
+// iconUpload presigns a PUT for a new club icon, e.g. GET /clubs/3/icon-upload?fileType=image/png.
+// Once the upload is done the client saves the key with PATCH /clubs/{clubId}.
+func iconUpload(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	fileType := evt.QueryStringParameters["fileType"]
+	extension, ok := iconTypes[fileType]
+	if !ok {
+		return apiutils.Error(http.StatusBadRequest, "fileType must be image/png, image/jpeg or image/webp")
+	}
+
+	_, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	key := fmt.Sprintf("%sicon-%d.%s", iconPrefix(clubID), time.Now().UnixMilli(), extension)
+	url, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(imageBucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(fileType),
+	}, func(o *s3.PresignOptions) {
+		o.Expires = 5 * time.Minute
+	})
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return apiutils.JSON(http.StatusOK, map[string]string{"uploadUrl": url.URL, "key": key})
+}
+
+// listMembers is for members of the club, emails are only shown to its eboard
+func listMembers(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.MemberOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	members, err := clubutils.Members(ctx, db, clubID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	eboard, err := c.Can(ctx, authutils.EboardOf(clubID))
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if !eboard {
+		for i := range members {
+			members[i].Email = nil
+		}
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"members": members})
+}
+
+func join(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		return clubutils.Join(ctx, tx, clubID, studentID)
+	})
+	return noContent(err)
+}
+
+func leave(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		return clubutils.Remove(ctx, tx, clubID, studentID)
+	})
+	return noContent(err)
+}
+
+func removeMember(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		return clubutils.Remove(ctx, tx, clubID, studentID)
+	})
+	return noContent(err)
+}
+
+type roleBody struct {
+	Role authutils.Role `json:"role"`
+}
+
+// setRole promotes a member to eboard or demotes them, e.g. PUT /clubs/3/members/42/role {"role": "eboard"}
+func setRole(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body roleBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		return clubutils.SetRole(ctx, tx, clubID, studentID, body.Role)
+	})
+	return noContent(err)
+}
+
+// clubErr maps the clubutils errors to their status codes
+func clubErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, clubutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, clubutils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, clubutils.ErrConflict):
+		return apiutils.Error(http.StatusConflict, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func clubResponse(status int, club *clubutils.Club, err error) (events.APIGatewayV2HTTPResponse, error) {
+	if err != nil {
+		return clubErr(err)
+	}
+	return apiutils.JSON(status, club)
+}
+
+func noContent(err error) (events.APIGatewayV2HTTPResponse, error) {
+	if err != nil {
+		return clubErr(err)
+	}
+	return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusNoContent}, nil
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
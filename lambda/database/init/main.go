@@ -31,11 +31,32 @@ import (
 
 var databaseNames = []string{"STAGING"}
 
+// Run in order, add new migrations to the end. Each one is recorded in SCHEMA_MIGRATIONS
+// and only runs once per database, so they don't have to be idempotent.
 var initTableMigrationFiles = []string{
 	"07_11_2025_create_core_tables_up.sql",
 	"07_11_2025_create_member_form_migration_table_up.sql",
+	"19_10_2026_link_students_to_cognito_up.sql",
+	"19_10_2026_version_events_up.sql",
+	"19_10_2026_create_cohost_invitations_up.sql",
+	"19_10_2026_create_event_rsvps_up.sql",
+	"19_10_2026_create_event_checkins_up.sql",
+	"19_10_2026_points_ledger_up.sql",
+	"19_10_2026_create_rewards_up.sql",
+	"19_10_2026_import_member_forms_up.sql",
+	"19_10_2026_create_student_merges_up.sql",
+	"19_10_2026_create_student_erasures_up.sql",
+	"19_10_2026_encrypt_student_info_up.sql",
+	"19_10_2026_create_audit_log_up.sql",
+	"19_10_2026_calendar_token_version_up.sql",
+	"19_10_2026_clear_imported_form_answers_up.sql",
 }
 
+const createMigrationTable = `CREATE TABLE IF NOT EXISTS SCHEMA_MIGRATIONS (
+  filename VARCHAR(255) PRIMARY KEY,
+  applied_at timestamp DEFAULT CURRENT_TIMESTAMP
+)`
+
 var initDatabaseMigrationFile = "07_11_2025_create_databases_up.sql"
 
 var (
@@ -51,10 +72,12 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 	err := initDatabase(ctx)
 	if err != nil {
 		log.Printf("Error initializing database: %v", err)
+		// the custom resource provider only fails the deploy when the handler returns an
+		// error, a 500 response would be reported to cloudformation as a success
 		return events.APIGatewayProxyResponse{
 			StatusCode: 500,
 			Body:       fmt.Sprintf("Failed to initialize database: %v", err),
-		}, nil
+		}, fmt.Errorf("initializing database: %w", err)
 	}
 
 	return events.APIGatewayProxyResponse{
@@ -107,12 +130,28 @@ func initDatabase(ctx context.Context) error {
 		log.Printf("Connected to database %s successfully", dbName)
 		log.Printf("Running migrations for database %s", dbName)
 
+		applied, err := appliedMigrations(mysqlConn)
+		if err != nil {
+			log.Printf("Failed to read applied migrations for %s: %v", dbName, err)
+			return err
+		}
+
 		for _, file := range initTableMigrationFiles {
+			if applied[file] {
+				log.Printf("Migration %s already applied, skipping", file)
+				continue
+			}
+
 			err := runMigration(mysqlConn, file)
 			if err != nil {
 				log.Printf("Failed to run migration %s: %v", file, err)
 				return err
 			}
+
+			if _, err := mysqlConn.Exec("INSERT INTO SCHEMA_MIGRATIONS (filename) VALUES (?)", file); err != nil {
+				log.Printf("Failed to record migration %s: %v", file, err)
+				return err
+			}
 			log.Printf("Migration %s completed successfully", file)
 		}
 	}
@@ -184,6 +223,30 @@ func connectToMySQL(user string, password string, dbName string, address string)
 	return db, nil
 }
 
+// appliedMigrations creates the migration table if needed and returns the migrations
+// that have already been run against the database.
+func appliedMigrations(db *sql.DB) (map[string]bool, error) {
+	if _, err := db.Exec(createMigrationTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT filename FROM SCHEMA_MIGRATIONS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		applied[file] = true
+	}
+	return applied, rows.Err()
+}
+
 // runMigration executes the SQL statements in the given migration file against the provided database connection.
 //
 // It assumes that your migration files are under a folder "migrations" in the current working directory.
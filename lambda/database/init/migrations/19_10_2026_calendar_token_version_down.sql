@@ -0,0 +1 @@
+ALTER TABLE `STUDENTS` DROP COLUMN `calendar_token_version`;
@@ -0,0 +1,4 @@
+-- personal calendar feed tokens carry this version, bumping it revokes the urls a
+-- student was given before
+ALTER TABLE `STUDENTS`
+  ADD COLUMN `calendar_token_version` int NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+-- the cleared answers are gone, there is nothing to put back
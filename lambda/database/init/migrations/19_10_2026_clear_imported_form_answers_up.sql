@@ -0,0 +1,5 @@
+-- forms that were imported have their answers on the student now, the import clears
+-- them from here from now on. Conflicts keep theirs so they can be retried.
+UPDATE `MEMBER_FORM_DATA`
+SET `emplid` = NULL, `dietary_restrictions` = NULL
+WHERE `import_status` IN ('created', 'updated', 'unchanged');
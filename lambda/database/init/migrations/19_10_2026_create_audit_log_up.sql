@@ -0,0 +1,20 @@
+-- one row per successful mutating api call, written by utils/audit after the handler
+-- ran. Rows are only ever added, erasing a student blanks their before and after.
+CREATE TABLE IF NOT EXISTS `AUDIT_LOG` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `actor_id` int NULL COMMENT 'FK, NULL when the caller has no student yet',
+  `actor_sub` varchar(255) NULL COMMENT 'cognito sub of the caller',
+  `action` varchar(255) NOT NULL COMMENT 'route key, like PATCH /clubs/{clubId}',
+  `entity` varchar(64) NOT NULL COMMENT 'what was changed, like club or event',
+  `entity_id` int NULL COMMENT 'id of the changed row, NULL when there is none',
+  `before` JSON NULL COMMENT 'the entity before the call, NULL for creates',
+  `after` JSON NULL COMMENT 'the entity after the call, NULL for deletes',
+  `status` smallint NOT NULL COMMENT 'http status of the response',
+  `request_id` varchar(64) NULL COMMENT 'api gateway request id',
+  `created_at` datetime NOT NULL,
+  CONSTRAINT `FK_AuditLog_Actor` FOREIGN KEY (`actor_id`) REFERENCES `STUDENTS` (`id`)
+);
+
+CREATE INDEX `IX_AuditLog_Actor` ON `AUDIT_LOG` (`actor_id`, `created_at`);
+CREATE INDEX `IX_AuditLog_Entity` ON `AUDIT_LOG` (`entity`, `entity_id`, `created_at`);
+CREATE INDEX `IX_AuditLog_Created` ON `AUDIT_LOG` (`created_at`);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `EVENT_COHOST_INVITATIONS`;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS `EVENT_COHOST_INVITATIONS` (
+  `id` int PRIMARY KEY AUTO_INCREMENT,
+  `event_id` int NOT NULL COMMENT 'FK',
+  `club_id` int NOT NULL COMMENT 'FK, the club being invited',
+  `invited_by` int COMMENT 'FK, student on the eboard of a hosting club',
+  `status` ENUM ('pending', 'accepted', 'declined', 'cancelled') NOT NULL DEFAULT 'pending',
+  `created_at` datetime NOT NULL,
+  `responded_by` int NULL COMMENT 'FK, student on the eboard of the invited club',
+  `responded_at` datetime NULL,
+  CONSTRAINT `UQ_CohostInvitations_EventClub` UNIQUE (`event_id`, `club_id`),
+  CONSTRAINT `FK_CohostInvitations_Events` FOREIGN KEY (`event_id`) REFERENCES `EVENTS` (`id`),
+  CONSTRAINT `FK_CohostInvitations_Clubs` FOREIGN KEY (`club_id`) REFERENCES `CLUBS` (`id`),
+  CONSTRAINT `FK_CohostInvitations_InvitedBy` FOREIGN KEY (`invited_by`) REFERENCES `STUDENTS` (`id`),
+  CONSTRAINT `FK_CohostInvitations_RespondedBy` FOREIGN KEY (`responded_by`) REFERENCES `STUDENTS` (`id`)
+);
+
+CREATE INDEX `IX_CohostInvitations_ClubStatus` ON `EVENT_COHOST_INVITATIONS` (`club_id`, `status`);
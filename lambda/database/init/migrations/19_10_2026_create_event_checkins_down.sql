@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `EVENT_CHECKINS`;
+
+ALTER TABLE `EVENTS` DROP FOREIGN KEY `FK_Events_PointSources`;
+
+ALTER TABLE `EVENTS` DROP COLUMN `point_source_id`;
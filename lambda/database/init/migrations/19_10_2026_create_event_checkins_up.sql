@@ -0,0 +1,13 @@
+ALTER TABLE `EVENTS`
+  ADD COLUMN `point_source_id` int NULL COMMENT 'FK, awarded to every student that checks in',
+  ADD CONSTRAINT `FK_Events_PointSources` FOREIGN KEY (`point_source_id`) REFERENCES `POINT_SOURCES` (`id`);
+
+CREATE TABLE IF NOT EXISTS `EVENT_CHECKINS` (
+  `event_id` int NOT NULL COMMENT 'FK',
+  `student_id` int NOT NULL COMMENT 'FK',
+  `checked_in_at` datetime NOT NULL,
+  `points_earned` int NULL COMMENT 'NULL when the event had no point source at check-in',
+  PRIMARY KEY (`event_id`, `student_id`),
+  CONSTRAINT `FK_EventCheckins_Events` FOREIGN KEY (`event_id`) REFERENCES `EVENTS` (`id`),
+  CONSTRAINT `FK_EventCheckins_Students` FOREIGN KEY (`student_id`) REFERENCES `STUDENTS` (`id`)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `EVENT_RSVPS`;
+
+ALTER TABLE `EVENTS` DROP COLUMN `capacity`;
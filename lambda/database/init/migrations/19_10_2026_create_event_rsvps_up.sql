@@ -0,0 +1,16 @@
+ALTER TABLE `EVENTS`
+  ADD COLUMN `capacity` int NULL COMMENT 'most students that can be going, NULL for no limit';
+
+CREATE TABLE IF NOT EXISTS `EVENT_RSVPS` (
+  `event_id` int NOT NULL COMMENT 'FK',
+  `student_id` int NOT NULL COMMENT 'FK',
+  `status` ENUM ('going', 'maybe', 'not_going') NOT NULL,
+  `waitlisted` BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'going but over capacity, promoted in responded_at order',
+  `responded_at` datetime(6) NOT NULL COMMENT 'last time the status changed',
+  `promoted_at` datetime NULL COMMENT 'when the student came off the waitlist',
+  PRIMARY KEY (`event_id`, `student_id`),
+  CONSTRAINT `FK_EventRsvps_Events` FOREIGN KEY (`event_id`) REFERENCES `EVENTS` (`id`),
+  CONSTRAINT `FK_EventRsvps_Students` FOREIGN KEY (`student_id`) REFERENCES `STUDENTS` (`id`)
+);
+
+CREATE INDEX `IX_EventRsvps_Waitlist` ON `EVENT_RSVPS` (`event_id`, `status`, `waitlisted`, `responded_at`);
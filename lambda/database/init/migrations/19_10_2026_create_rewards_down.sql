@@ -0,0 +1,15 @@
+ALTER TABLE `PURCHASES`
+  DROP FOREIGN KEY `FK_Purchases_Rewards`,
+  DROP FOREIGN KEY `FK_Purchases_PointHistories`,
+  DROP FOREIGN KEY `FK_Purchases_HandledBy`;
+
+ALTER TABLE `PURCHASES`
+  DROP INDEX `UQ_Purchases_LedgerEntry`,
+  DROP INDEX `IX_Purchases_Status`,
+  DROP COLUMN `reward_id`,
+  DROP COLUMN `ledger_entry_id`,
+  DROP COLUMN `status`,
+  DROP COLUMN `handled_by`,
+  DROP COLUMN `handled_at`;
+
+DROP TABLE IF EXISTS `REWARDS`;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS `REWARDS` (
+  `id` int PRIMARY KEY AUTO_INCREMENT,
+  `club_id` int NULL COMMENT 'FK, the club that hands it out, NULL for rewards run by admins',
+  `title` VARCHAR(255) NOT NULL,
+  `description` TEXT NULL,
+  `points_cost` int NOT NULL,
+  `stock` int NULL COMMENT 'how many are left, NULL for unlimited',
+  `active` BOOLEAN NOT NULL DEFAULT TRUE COMMENT 'inactive rewards are hidden and can not be bought',
+  `created_at` datetime NOT NULL,
+  CONSTRAINT `FK_Rewards_Clubs` FOREIGN KEY (`club_id`) REFERENCES `CLUBS` (`id`)
+);
+
+-- reward_id and ledger_entry_id are NULL for purchases made before the catalog existed
+ALTER TABLE `PURCHASES`
+  ADD COLUMN `reward_id` int NULL COMMENT 'FK',
+  ADD COLUMN `ledger_entry_id` int NULL COMMENT 'FK, the POINT_HISTORIES row that paid for it',
+  ADD COLUMN `status` ENUM ('pending', 'fulfilled', 'refunded') NOT NULL DEFAULT 'pending',
+  ADD COLUMN `handled_by` int NULL COMMENT 'FK, who fulfilled or refunded it',
+  ADD COLUMN `handled_at` datetime NULL,
+  ADD UNIQUE KEY `UQ_Purchases_LedgerEntry` (`ledger_entry_id`),
+  ADD INDEX `IX_Purchases_Status` (`status`, `id`),
+  ADD CONSTRAINT `FK_Purchases_Rewards` FOREIGN KEY (`reward_id`) REFERENCES `REWARDS` (`id`),
+  ADD CONSTRAINT `FK_Purchases_PointHistories` FOREIGN KEY (`ledger_entry_id`) REFERENCES `POINT_HISTORIES` (`id`),
+  ADD CONSTRAINT `FK_Purchases_HandledBy` FOREIGN KEY (`handled_by`) REFERENCES `STUDENTS` (`id`);
+
+-- anything bought before now was handed out on the spot
+UPDATE `PURCHASES` SET `status` = 'fulfilled';
+
+UPDATE `PURCHASES` AS `p`
+JOIN `POINT_HISTORIES` AS `h` ON `h`.`idempotency_key` = CONCAT('purchase:', `p`.`id`)
+SET `p`.`ledger_entry_id` = `h`.`id`;
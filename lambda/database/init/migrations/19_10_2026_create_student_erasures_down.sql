@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `STUDENT_ERASURES`;
+
+ALTER TABLE `STUDENTS` DROP COLUMN `erased_at`;
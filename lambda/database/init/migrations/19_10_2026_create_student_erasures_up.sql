@@ -0,0 +1,20 @@
+-- an erased student keeps their row, and with it the ledger and purchases that point at
+-- it, but everything that could identify them is gone
+ALTER TABLE `STUDENTS`
+  ADD COLUMN `erased_at` datetime NULL COMMENT 'set once the student was anonymized';
+
+CREATE TABLE IF NOT EXISTS `STUDENT_ERASURES` (
+  `id` int PRIMARY KEY AUTO_INCREMENT,
+  `student_id` int NOT NULL COMMENT 'FK',
+  `requested_at` datetime NOT NULL,
+  `requested_by` int NULL COMMENT 'FK, the student or the admin that asked for it',
+  `erased_at` datetime NULL COMMENT 'NULL while the request is pending',
+  `erased_by` int NULL COMMENT 'FK, the admin that erased the student',
+  `details` JSON NULL COMMENT 'how many rows of each table were removed or anonymized',
+  UNIQUE KEY `UQ_StudentErasures_Student` (`student_id`),
+  CONSTRAINT `FK_StudentErasures_Students` FOREIGN KEY (`student_id`) REFERENCES `STUDENTS` (`id`),
+  CONSTRAINT `FK_StudentErasures_RequestedBy` FOREIGN KEY (`requested_by`) REFERENCES `STUDENTS` (`id`),
+  CONSTRAINT `FK_StudentErasures_ErasedBy` FOREIGN KEY (`erased_by`) REFERENCES `STUDENTS` (`id`)
+);
+
+CREATE INDEX `IX_StudentErasures_Pending` ON `STUDENT_ERASURES` (`erased_at`, `requested_at`);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `STUDENT_MERGES`;
+
+ALTER TABLE `STUDENTS` DROP FOREIGN KEY `FK_Students_MergedInto`;
+
+ALTER TABLE `STUDENTS` DROP COLUMN `merged_into_id`;
@@ -0,0 +1,18 @@
+-- a merged duplicate stays as an empty row pointing at the student it was merged into,
+-- so anything still holding its id can find where it went
+ALTER TABLE `STUDENTS`
+  ADD COLUMN `merged_into_id` int NULL COMMENT 'FK, set once the student was merged into another one',
+  ADD CONSTRAINT `FK_Students_MergedInto` FOREIGN KEY (`merged_into_id`) REFERENCES `STUDENTS` (`id`);
+
+CREATE TABLE IF NOT EXISTS `STUDENT_MERGES` (
+  `id` int PRIMARY KEY AUTO_INCREMENT,
+  `survivor_id` int NOT NULL COMMENT 'FK, the student that was kept',
+  `merged_id` int NOT NULL COMMENT 'FK, the duplicate',
+  `merged_by` int NULL COMMENT 'FK, the admin that merged them',
+  `merged_at` datetime NOT NULL,
+  `details` JSON NOT NULL COMMENT 'the duplicate as it was before the merge and how many rows were moved',
+  UNIQUE KEY `UQ_StudentMerges_Merged` (`merged_id`),
+  CONSTRAINT `FK_StudentMerges_Survivor` FOREIGN KEY (`survivor_id`) REFERENCES `STUDENTS` (`id`),
+  CONSTRAINT `FK_StudentMerges_Merged` FOREIGN KEY (`merged_id`) REFERENCES `STUDENTS` (`id`),
+  CONSTRAINT `FK_StudentMerges_MergedBy` FOREIGN KEY (`merged_by`) REFERENCES `STUDENTS` (`id`)
+);
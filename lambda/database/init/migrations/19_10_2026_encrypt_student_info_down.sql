@@ -0,0 +1,7 @@
+-- every sealed value is lost with these columns, only roll back before anything was sealed
+DROP INDEX `IX_StudentInfo_EmplidIndex` ON `STUDENT_INFO`;
+
+ALTER TABLE `STUDENT_INFO`
+  DROP COLUMN `emplid_ciphertext`,
+  DROP COLUMN `emplid_index`,
+  DROP COLUMN `dietary_restrictions_ciphertext`;
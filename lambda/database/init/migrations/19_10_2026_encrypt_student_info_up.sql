@@ -0,0 +1,9 @@
+-- emplids and dietary restrictions are sealed by utils/crypto with a KMS data key, and
+-- emplids are looked up by a keyed hash instead of the value. The plaintext columns stay
+-- until the EncryptStudentInfo job has sealed every row, it leaves them NULL.
+ALTER TABLE `STUDENT_INFO`
+  ADD COLUMN `emplid_ciphertext` VARBINARY(1024) NULL COMMENT 'emplid sealed by cryptoutils',
+  ADD COLUMN `emplid_index` BINARY(32) NULL COMMENT 'blind index of the emplid, for lookups',
+  ADD COLUMN `dietary_restrictions_ciphertext` VARBINARY(1024) NULL COMMENT 'dietary_restrictions sealed by cryptoutils';
+
+CREATE INDEX `IX_StudentInfo_EmplidIndex` ON `STUDENT_INFO` (`emplid_index`);
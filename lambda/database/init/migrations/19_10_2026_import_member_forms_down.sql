@@ -0,0 +1,12 @@
+DROP INDEX `IX_StudentInfo_Emplid` ON `STUDENT_INFO`;
+
+ALTER TABLE `MEMBER_FORM_DATA` DROP FOREIGN KEY `FK_MemberFormData_Students`;
+
+ALTER TABLE `MEMBER_FORM_DATA`
+  DROP INDEX `IX_MemberFormData_Import`,
+  DROP COLUMN `id`,
+  DROP COLUMN `source`,
+  DROP COLUMN `import_status`,
+  DROP COLUMN `import_message`,
+  DROP COLUMN `student_id`,
+  DROP COLUMN `imported_at`;
@@ -0,0 +1,13 @@
+-- the import job records what it did with each form so running it again skips rows it already handled
+ALTER TABLE `MEMBER_FORM_DATA`
+  ADD COLUMN `id` int NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST,
+  ADD COLUMN `source` VARCHAR(255) NULL COMMENT 'where the row came from, e.g. the uploaded export',
+  ADD COLUMN `import_status` ENUM ('created', 'updated', 'unchanged', 'conflict') NULL COMMENT 'NULL until the import job has looked at it',
+  ADD COLUMN `import_message` VARCHAR(500) NULL COMMENT 'why the row is a conflict',
+  ADD COLUMN `student_id` int NULL COMMENT 'FK, the student the row was imported into',
+  ADD COLUMN `imported_at` datetime NULL,
+  ADD INDEX `IX_MemberFormData_Import` (`import_status`, `source`),
+  ADD CONSTRAINT `FK_MemberFormData_Students` FOREIGN KEY (`student_id`) REFERENCES `STUDENTS` (`id`);
+
+-- imports match students by emplid as well as email
+CREATE INDEX `IX_StudentInfo_Emplid` ON `STUDENT_INFO` (`emplid`);
@@ -0,0 +1,7 @@
+DROP INDEX `IX_Students_Email` ON `STUDENTS`;
+
+DROP INDEX `UQ_Students_CognitoSub` ON `STUDENTS`;
+
+ALTER TABLE `STUDENTS`
+  DROP COLUMN `cognito_sub`,
+  ADD COLUMN `password` VARCHAR(255) COMMENT 'hashed, to be added eventually';
@@ -0,0 +1,7 @@
+ALTER TABLE `STUDENTS`
+  ADD COLUMN `cognito_sub` VARCHAR(64) NULL COMMENT 'sub claim of the linked Cognito user' AFTER `email`,
+  DROP COLUMN `password`;
+
+CREATE UNIQUE INDEX `UQ_Students_CognitoSub` ON `STUDENTS` (`cognito_sub`);
+
+CREATE INDEX `IX_Students_Email` ON `STUDENTS` (`email`);
@@ -0,0 +1,28 @@
+-- the old table can only hold one row per student and source, anything else is dropped
+DELETE FROM `POINT_HISTORIES` WHERE `point_source_id` IS NULL;
+
+DELETE `h` FROM `POINT_HISTORIES` AS `h`
+JOIN `POINT_HISTORIES` AS `o` ON `o`.`member_id` = `h`.`member_id` AND `o`.`point_source_id` = `h`.`point_source_id` AND `o`.`id` < `h`.`id`;
+
+ALTER TABLE `POINT_HISTORIES`
+  DROP FOREIGN KEY `FK_PointHistories_Students`,
+  DROP FOREIGN KEY `FK_PointHistories_PointSources`,
+  DROP FOREIGN KEY `FK_PointHistories_Actors`;
+
+ALTER TABLE `POINT_HISTORIES`
+  DROP INDEX `UQ_PointHistories_IdempotencyKey`,
+  DROP INDEX `IX_PointHistories_Member`,
+  DROP COLUMN `idempotency_key`,
+  DROP COLUMN `reason`,
+  DROP COLUMN `actor_id`,
+  DROP COLUMN `id`,
+  MODIFY COLUMN `member_id` int COMMENT 'FK',
+  MODIFY COLUMN `point_source_id` int COMMENT 'FK',
+  MODIFY COLUMN `points_earned` int,
+  MODIFY COLUMN `points_after_gain` int,
+  MODIFY COLUMN `timestamp` datetime,
+  ADD PRIMARY KEY (`member_id`, `point_source_id`);
+
+ALTER TABLE `POINT_HISTORIES`
+  ADD CONSTRAINT `FK_PointHistories_Students` FOREIGN KEY (`member_id`) REFERENCES `STUDENTS` (`id`),
+  ADD CONSTRAINT `FK_PointHistories_PointSources` FOREIGN KEY (`point_source_id`) REFERENCES `POINT_SOURCES` (`id`);
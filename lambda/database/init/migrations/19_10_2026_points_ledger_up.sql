@@ -0,0 +1,45 @@
+-- POINT_HISTORIES becomes an append-only ledger. Every change to a balance is one row,
+-- a source can be earned more than once, and corrections are new rows instead of edits.
+ALTER TABLE `POINT_HISTORIES`
+  DROP FOREIGN KEY `FK_PointHistories_Students`,
+  DROP FOREIGN KEY `FK_PointHistories_PointSources`;
+
+-- the columns below become NOT NULL and existing rows may have NULLs in them, which would
+-- fail the ALTER in strict mode. The balances are recomputed at the end so they start at 0.
+UPDATE `POINT_HISTORIES`
+SET `points_earned` = COALESCE(`points_earned`, 0),
+  `timestamp` = COALESCE(`timestamp`, NOW()),
+  `points_after_gain` = 0;
+
+ALTER TABLE `POINT_HISTORIES`
+  DROP PRIMARY KEY,
+  ADD COLUMN `id` int NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST,
+  MODIFY COLUMN `member_id` int NOT NULL COMMENT 'FK',
+  MODIFY COLUMN `point_source_id` int NULL COMMENT 'FK, NULL for adjustments and purchases',
+  MODIFY COLUMN `points_earned` int NOT NULL COMMENT 'negative for spending and deductions',
+  MODIFY COLUMN `points_after_gain` int NOT NULL COMMENT 'the balance after this row, written under the STUDENTS row lock',
+  MODIFY COLUMN `timestamp` datetime NOT NULL,
+  ADD COLUMN `idempotency_key` VARCHAR(191) NULL COMMENT 'retrying a write with the same key returns the first row',
+  ADD COLUMN `reason` VARCHAR(500) NULL,
+  ADD COLUMN `actor_id` int NULL COMMENT 'FK, the admin that made an adjustment',
+  ADD UNIQUE KEY `UQ_PointHistories_IdempotencyKey` (`idempotency_key`),
+  ADD INDEX `IX_PointHistories_Member` (`member_id`, `id`);
+
+ALTER TABLE `POINT_HISTORIES`
+  ADD CONSTRAINT `FK_PointHistories_Students` FOREIGN KEY (`member_id`) REFERENCES `STUDENTS` (`id`),
+  ADD CONSTRAINT `FK_PointHistories_PointSources` FOREIGN KEY (`point_source_id`) REFERENCES `POINT_SOURCES` (`id`),
+  ADD CONSTRAINT `FK_PointHistories_Actors` FOREIGN KEY (`actor_id`) REFERENCES `STUDENTS` (`id`);
+
+-- spending used to live only in PURCHASES, copy it in so the ledger alone adds up to the balance
+INSERT INTO `POINT_HISTORIES` (`member_id`, `points_earned`, `points_after_gain`, `timestamp`, `idempotency_key`, `reason`)
+SELECT `member_id`, -`points_cost`, 0, COALESCE(`timestamp`, NOW()), CONCAT('purchase:', `id`), CONCAT('Purchased ', COALESCE(`item_title`, 'an item'))
+FROM `PURCHASES`
+WHERE `member_id` IS NOT NULL AND `points_cost` IS NOT NULL;
+
+-- recompute the running balances, the old ones were never guaranteed to add up
+UPDATE `POINT_HISTORIES` AS `h`
+JOIN (
+  SELECT `id`, SUM(`points_earned`) OVER (PARTITION BY `member_id` ORDER BY `timestamp`, `id`) AS `running`
+  FROM `POINT_HISTORIES`
+) AS `r` ON `r`.`id` = `h`.`id`
+SET `h`.`points_after_gain` = `r`.`running`;
@@ -0,0 +1,10 @@
+ALTER TABLE `EVENT_VERSIONS` DROP FOREIGN KEY `FK_EventVersions_Events`;
+
+DROP INDEX `IX_EventVersions_Event` ON `EVENT_VERSIONS`;
+
+ALTER TABLE `EVENT_VERSIONS`
+  DROP COLUMN `event_id`,
+  DROP COLUMN `event_end`,
+  DROP COLUMN `location`,
+  DROP COLUMN `description`,
+  DROP COLUMN `reverted_from_id`;
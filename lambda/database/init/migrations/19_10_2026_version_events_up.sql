@@ -0,0 +1,9 @@
+ALTER TABLE `EVENT_VERSIONS`
+  ADD COLUMN `event_id` int NULL COMMENT 'FK, the event this is a version of' AFTER `id`,
+  ADD COLUMN `event_end` datetime NULL AFTER `event_date`,
+  ADD COLUMN `location` VARCHAR(255) NULL AFTER `event_end`,
+  ADD COLUMN `description` TEXT NULL AFTER `location`,
+  ADD COLUMN `reverted_from_id` int NULL COMMENT 'set when the version was made by reverting to an older one' AFTER `type`,
+  ADD CONSTRAINT `FK_EventVersions_Events` FOREIGN KEY (`event_id`) REFERENCES `EVENTS` (`id`);
+
+CREATE INDEX `IX_EventVersions_Event` ON `EVENT_VERSIONS` (`event_id`, `id`);
@@ -20,6 +20,9 @@ import (
 
 	// loads AWS creds/region
 	_ "github.com/go-sql-driver/mysql" // MySQL driver; blank import means “register”
+
+	apiutils "cdk-infrastructure/utils/api"
+	authutils "cdk-infrastructure/utils/auth"
 )
 
 //=============================================
@@ -101,6 +104,19 @@ type resp struct {
 // Lambda handler – runs every invocation
 // =============================================
 func handler(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if err := apiutils.CheckOrigin(evt); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	// only admins get to poke at the database, the group comes straight from the
+	// token so no store is needed
+	caller, err := authutils.FromRequest(evt, nil)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := caller.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
 
 	// arn of secret
 	arn := os.Getenv("DB_SECRET_ARN") // secret reference
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+	publicutils "cdk-infrastructure/utils/public"
+)
+
+const maxPageSize = 100
+
+var router = apiutils.Router{
+	"GET /events":                    listEvents,
+	"POST /events":                   createEvent,
+	"GET /events/{eventId}":          getEvent,
+	"PATCH /events/{eventId}":        editEvent,
+	"DELETE /events/{eventId}":       deleteEvent,
+	"POST /events/{eventId}/publish": publishEvent,
+	"GET /events/{eventId}/versions": listVersions,
+	"GET /events/{eventId}/diff":     diffVersions,
+	"POST /events/{eventId}/revert":  revertEvent,
+
+	"GET /events/{eventId}/cohosts":                           cohosts,
+	"POST /events/{eventId}/cohosts":                          inviteCohost,
+	"DELETE /events/{eventId}/cohosts/{clubId}":               removeCohost,
+	"GET /clubs/{clubId}/invitations":                         clubInvitations,
+	"POST /clubs/{clubId}/invitations/{invitationId}/accept":  acceptInvitation,
+	"POST /clubs/{clubId}/invitations/{invitationId}/decline": declineInvitation,
+	"GET /clubs/{clubId}/events":                              clubEvents,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG
+var audits = map[string]auditutils.Target{
+	"POST /events":                   {Entity: "event", Load: loadEvent},
+	"PATCH /events/{eventId}":        {Entity: "event", Param: "eventId", Load: loadEvent},
+	"DELETE /events/{eventId}":       {Entity: "event", Param: "eventId", Load: loadEvent},
+	"POST /events/{eventId}/publish": {Entity: "event", Param: "eventId", Load: loadEvent},
+	"POST /events/{eventId}/revert":  {Entity: "event", Param: "eventId", Load: loadEvent},
+
+	"POST /events/{eventId}/cohosts":                          {Entity: "event", Param: "eventId", Load: loadCohosts},
+	"DELETE /events/{eventId}/cohosts/{clubId}":               {Entity: "event", Param: "eventId", Load: loadCohosts},
+	"POST /clubs/{clubId}/invitations/{invitationId}/accept":  {Entity: "cohost_invitation", Param: "invitationId", Load: loadInvitation},
+	"POST /clubs/{clubId}/invitations/{invitationId}/decline": {Entity: "cohost_invitation", Param: "invitationId", Load: loadInvitation},
+}
+
+func loadEvent(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, eventID int64) (any, error) {
+	event, err := eventutils.Get(ctx, q, eventID)
+	if errors.Is(err, eventutils.ErrNotFound) {
+		return nil, nil
+	}
+	return event, err
+}
+
+// loadCohosts is the event's hosts and every invitation sent for it
+func loadCohosts(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, eventID int64) (any, error) {
+	event, err := eventutils.Get(ctx, q, eventID)
+	if errors.Is(err, eventutils.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := eventutils.EventInvitations(ctx, q, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"clubIds": event.ClubIDs, "invitations": invitations}, nil
+}
+
+// loadInvitation finds the invitation among the club's in the path
+func loadInvitation(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, invitationID int64) (any, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := eventutils.ClubInvitations(ctx, q, clubID, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		if invitation.ID == invitationID {
+			return invitation, nil
+		}
+	}
+	return nil, nil
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+// listEvents returns upcoming posted events, e.g. GET /events?from=2026-10-01T00:00:00Z&clubId=3&limit=20
+func listEvents(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	from := time.Now()
+	if value := evt.QueryStringParameters["from"]; value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return apiutils.Error(http.StatusBadRequest, "from must be an RFC 3339 timestamp")
+		}
+		from = parsed
+	}
+	clubID, err := apiutils.QueryInt(evt, "clubId", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if limit < 1 || limit > maxPageSize {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100")
+	}
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	listed, err := eventutils.ListPosted(ctx, db, from, clubID, limit)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"events": listed})
+}
+
+type createBody struct {
+	ClubIDs []int64 `json:"clubIds"`
+	eventutils.Fields
+}
+
+// createEvent creates a draft hosted by clubIds, the caller has to be on the eboard of all of them
+func createEvent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body createBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+	body.Status = eventutils.StatusDrafted
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	for _, clubID := range body.ClubIDs {
+		if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+			return apiutils.Fail(err)
+		}
+	}
+	authorID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var event *eventutils.Event
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err = eventutils.Create(ctx, tx, authorID, body.ClubIDs, body.Fields)
+		return err
+	})
+	return eventResponse(http.StatusCreated, event, err)
+}
+
+// getEvent shows posted events to anyone signed in, drafts and deleted events only to the hosts
+func getEvent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	event, err := eventutils.Get(ctx, db, eventID)
+	if err != nil {
+		return eventErr(err)
+	}
+	if !event.Visible() {
+		host, err := c.Can(ctx, authutils.EboardOfEventHost(eventID))
+		if err != nil {
+			return apiutils.Fail(err)
+		}
+		if !host {
+			// don't give away that the draft exists
+			return eventErr(eventutils.ErrNotFound)
+		}
+	}
+	return eventResponse(http.StatusOK, event, nil)
+}
+
+// editEvent appends a version with the fields in the body changed, a null clears a field.
+// The status can't be changed here, see publishEvent.
+//
+// Edits have to say which version they were made on, with If-Match (the ETag from
+// GET /events/{eventId}) or baseVersionId in the body. If someone else changed the event
+// since, the edit is rejected with a 409 listing what they changed.
+func editEvent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var patch map[string]json.RawMessage
+	if err := apiutils.Decode(evt, &patch); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	pre := precondition{required: true}
+	if raw, ok := patch["baseVersionId"]; ok {
+		if err := json.Unmarshal(raw, &pre.bodyBase); err != nil {
+			return apiutils.Error(http.StatusBadRequest, "baseVersionId must be a version id")
+		}
+		delete(patch, "baseVersionId")
+	}
+	for field := range patch {
+		pre.touched = append(pre.touched, field)
+	}
+
+	return change(ctx, evt, pre, func(tx *sql.Tx, event *eventutils.Event, authorID int64) error {
+		fields := event.Current.Fields
+		if err := applyPatch(&fields, patch); err != nil {
+			return err
+		}
+		if len(eventutils.Diff(event.Current.Fields, fields)) == 0 && !event.Deleted() {
+			return nil // nothing changed, don't add an empty version
+		}
+		_, err := eventutils.Append(ctx, tx, event, authorID, eventutils.TypeEdit, nil, fields)
+		return err
+	})
+}
+
+// publishEvent, deleteEvent and revertEvent check If-Match when it's sent
+func publishEvent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return change(ctx, evt, precondition{}, func(tx *sql.Tx, event *eventutils.Event, authorID int64) error {
+		if event.Current.Status == eventutils.StatusPosted && !event.Deleted() {
+			return nil // already published, nothing to add
+		}
+		fields := event.Current.Fields
+		fields.Status = eventutils.StatusPosted
+		_, err := eventutils.Append(ctx, tx, event, authorID, eventutils.TypeEdit, nil, fields)
+		return err
+	})
+}
+
+// deleteEvent appends a tombstone, the history stays so the event can be reverted
+func deleteEvent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return change(ctx, evt, precondition{}, func(tx *sql.Tx, event *eventutils.Event, authorID int64) error {
+		_, err := eventutils.Append(ctx, tx, event, authorID, eventutils.TypeDelete, nil, event.Current.Fields)
+		return err
+	})
+}
+
+type revertBody struct {
+	VersionID     int64 `json:"versionId"`
+	BaseVersionID int64 `json:"baseVersionId"`
+}
+
+// revertEvent appends a copy of an earlier version, this also brings back deleted events
+func revertEvent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body revertBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return change(ctx, evt, precondition{bodyBase: body.BaseVersionID}, func(tx *sql.Tx, event *eventutils.Event, authorID int64) error {
+		target, err := eventutils.GetVersion(ctx, tx, event.ID, body.VersionID)
+		if err != nil {
+			return err
+		}
+		if target.Type == eventutils.TypeDelete {
+			return apiutils.Errorf(http.StatusBadRequest, "can't revert to a deleted version")
+		}
+		_, err = eventutils.Append(ctx, tx, event, authorID, eventutils.TypeEdit, &target.ID, target.Fields)
+		return err
+	})
+}
+
+// precondition is the version a change was made on top of
+type precondition struct {
+	bodyBase int64 // baseVersionId from the body, If-Match wins if both are sent
+	required bool
+	touched  []string // fields the change sets, to report conflicts
+}
+
+// baseVersion reads the base version from If-Match or the body, 0 if neither was sent
+func (p precondition) baseVersion(evt events.APIGatewayV2HTTPRequest) (int64, error) {
+	// API Gateway lowercases header names
+	ifMatch := strings.TrimPrefix(strings.TrimSpace(evt.Headers["if-match"]), "W/")
+	if ifMatch != "" {
+		id, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+		if err != nil || id <= 0 {
+			return 0, apiutils.Errorf(http.StatusBadRequest, "If-Match must be an ETag from GET /events/{eventId}")
+		}
+		return id, nil
+	}
+
+	if p.bodyBase == 0 && p.required {
+		return 0, apiutils.Errorf(http.StatusPreconditionRequired, "send the version being edited with If-Match or baseVersionId")
+	}
+	return p.bodyBase, nil
+}
+
+// change runs fn in a transaction with the event locked, for eboard members of a
+// hosting club. It responds with the event as fn left it.
+func change(ctx context.Context, evt events.APIGatewayV2HTTPRequest, pre precondition,
+	fn func(tx *sql.Tx, event *eventutils.Event, authorID int64) error) (events.APIGatewayV2HTTPResponse, error) {
+
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	base, err := pre.baseVersion(evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+	authorID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var event *eventutils.Event
+	var wasVisible bool
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err = eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		if base != 0 {
+			if err := eventutils.CheckBase(ctx, tx, event, base); err != nil {
+				return withConflicts(err, pre.touched)
+			}
+		}
+		wasVisible = event.Visible()
+		return fn(tx, event, authorID)
+	})
+	if err == nil && (wasVisible || event.Visible()) {
+		invalidatePublic(ctx, evt, event)
+	}
+	return eventResponse(http.StatusOK, event, err)
+}
+
+// invalidatePublic clears the cached public feeds after a change to an event that's in
+// them, or was. The change is already committed, a failure only leaves the feeds stale
+// until the cache expires.
+func invalidatePublic(ctx context.Context, evt events.APIGatewayV2HTTPRequest, event *eventutils.Event) {
+	reason := fmt.Sprintf("%s %d", evt.RouteKey, event.ID)
+	if err := publicutils.Invalidate(ctx, reason); err != nil {
+		log.Printf("failed to invalidate the public feeds after %s: %v", reason, err)
+	}
+}
+
+func listVersions(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	versions, err := eventutils.Versions(ctx, db, eventID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if len(versions) == 0 {
+		return eventErr(eventutils.ErrNotFound)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"versions": versions})
+}
+
+// diffVersions compares two versions, e.g. GET /events/7/diff?from=12&to=15. to defaults to the current version.
+func diffVersions(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	fromID, err := apiutils.QueryInt(evt, "from", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	toID, err := apiutils.QueryInt(evt, "to", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if fromID == 0 {
+		return apiutils.Error(http.StatusBadRequest, "from is required")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	from, err := eventutils.GetVersion(ctx, db, eventID, fromID)
+	if err != nil {
+		return eventErr(err)
+	}
+	var to *eventutils.Version
+	if toID == 0 {
+		event, err := eventutils.Get(ctx, db, eventID)
+		if err != nil {
+			return eventErr(err)
+		}
+		to = &event.Current
+	} else if to, err = eventutils.GetVersion(ctx, db, eventID, toID); err != nil {
+		return eventErr(err)
+	}
+
+	return apiutils.JSON(http.StatusOK, map[string]any{
+		"from":    from.ID,
+		"to":      to.ID,
+		"changes": eventutils.Diff(from.Fields, to.Fields),
+	})
+}
+
+// cohosts lists the event's hosts and every invitation sent for it
+func cohosts(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	event, err := eventutils.Get(ctx, db, eventID)
+	if err != nil {
+		return eventErr(err)
+	}
+	invitations, err := eventutils.EventInvitations(ctx, db, eventID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"clubIds": event.ClubIDs, "invitations": invitations})
+}
+
+type inviteBody struct {
+	ClubID int64 `json:"clubId"`
+}
+
+// inviteCohost invites another club to host the event, e.g. POST /events/7/cohosts {"clubId": 4}
+func inviteCohost(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body inviteBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var invitation *eventutils.Invitation
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		invitation, err = eventutils.Invite(ctx, tx, event, body.ClubID, studentID)
+		return err
+	})
+	if err != nil {
+		return eventErr(err)
+	}
+	return apiutils.JSON(http.StatusCreated, invitation)
+}
+
+// removeCohost takes a club off the event or cancels its invitation. The hosts' eboards
+// can remove any club, a co-host's eboard can also take their own club off.
+func removeCohost(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.AnyOf(authutils.EboardOfEventHost(eventID), authutils.EboardOf(clubID))); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var event *eventutils.Event
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err = eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		return eventutils.RemoveHost(ctx, tx, event, clubID)
+	})
+	if err != nil {
+		return eventErr(err)
+	}
+	if event.Visible() {
+		invalidatePublic(ctx, evt, event)
+	}
+	return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusNoContent}, nil
+}
+
+// clubInvitations lists the club's pending invitations, or all of them with ?all=true
+func clubInvitations(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	invitations, err := eventutils.ClubInvitations(ctx, db, clubID, evt.QueryStringParameters["all"] == "true")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"invitations": invitations})
+}
+
+func acceptInvitation(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return respond(ctx, evt, true)
+}
+
+func declineInvitation(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return respond(ctx, evt, false)
+}
+
+// respond answers an invitation for the invited club's eboard
+func respond(ctx context.Context, evt events.APIGatewayV2HTTPRequest, accept bool) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	invitationID, err := apiutils.PathID(evt, "invitationId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var invitation *eventutils.Invitation
+	var event *eventutils.Event
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		invitation, event, err = eventutils.LockInvitation(ctx, tx, clubID, invitationID)
+		if err != nil {
+			return err
+		}
+		return eventutils.Respond(ctx, tx, invitation, event, accept, studentID)
+	})
+	if err != nil {
+		return eventErr(err)
+	}
+	if accept && event.Visible() {
+		invalidatePublic(ctx, evt, event) // the club is a host now
+	}
+	return apiutils.JSON(http.StatusOK, invitation)
+}
+
+// clubEvents lists the events a club hosts or co-hosts, newest first. The club's eboard
+// also sees drafts.
+func clubEvents(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	offset, err := apiutils.QueryInt(evt, "offset", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if limit < 1 || limit > maxPageSize || offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	drafts, err := c.Can(ctx, authutils.EboardOf(clubID))
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	listed, err := eventutils.ListForClub(ctx, db, clubID, drafts, limit, offset)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"events": listed, "limit": limit, "offset": offset})
+}
+
+// withConflicts fills in which of the touched fields were also changed since the base
+func withConflicts(err error, touched []string) error {
+	var stale *eventutils.StaleError
+	if !errors.As(err, &stale) {
+		return err
+	}
+
+	for _, change := range stale.Changes {
+		for _, field := range touched {
+			if change.Field == field {
+				stale.Conflicts = append(stale.Conflicts, field)
+			}
+		}
+	}
+	return err
+}
+
+// applyPatch sets the fields present in patch, unknown fields are a 400 so typos don't go unnoticed
+func applyPatch(fields *eventutils.Fields, patch map[string]json.RawMessage) error {
+	targets := map[string]any{
+		"name":        &fields.Name,
+		"image":       &fields.Image,
+		"start":       &fields.Start,
+		"end":         &fields.End,
+		"location":    &fields.Location,
+		"description": &fields.Description,
+	}
+
+	for field, raw := range patch {
+		target, ok := targets[field]
+		if !ok {
+			return apiutils.Errorf(http.StatusBadRequest, "%s can't be edited", field)
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return apiutils.Errorf(http.StatusBadRequest, "invalid %s: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// eventErr maps the eventutils errors to their status codes
+func eventErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	var stale *eventutils.StaleError
+
+	switch {
+	case errors.As(err, &stale):
+		return apiutils.JSON(http.StatusConflict, struct {
+			Error string `json:"error"`
+			*eventutils.StaleError
+		}{stale.Error(), stale})
+	case errors.Is(err, eventutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, eventutils.ErrDeleted):
+		return apiutils.Error(http.StatusGone, err.Error())
+	case errors.Is(err, eventutils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, eventutils.ErrConflict):
+		return apiutils.Error(http.StatusConflict, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func eventResponse(status int, event *eventutils.Event, err error) (events.APIGatewayV2HTTPResponse, error) {
+	if err != nil {
+		return eventErr(err)
+	}
+
+	resp, err := apiutils.JSON(status, event)
+	if resp.StatusCode == status {
+		// edits send this back in If-Match
+		resp.Headers["ETag"] = fmt.Sprintf(`"%d"`, event.Current.ID)
+	}
+	return resp, err
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
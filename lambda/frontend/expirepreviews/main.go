@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+/*
+	Deletes preview builds whose branch hasn't been deployed for EXPIRATION_DAYS.
+
+	An S3 lifecycle rule can't do this, it expires each object by its own upload time,
+	and `aws s3 sync` only uploads the files that changed. An active branch would lose
+	its unchanged files while the new ones stay, which leaves a broken preview.
+
+	So each branch is expired as a whole, from the time of its last deploy. CI writes
+	previews/<branch>/.deployed on every deploy. Branches without the marker fall back to
+	their newest object.
+
+	Runs daily on a schedule, the payload is ignored.
+*/
+
+// markerName is written by CI on every deploy of a branch, its upload time is the
+// branch's last deploy
+const markerName = ".deployed"
+
+var (
+	s3Client   *s3.Client
+	bucket     string
+	prefix     string
+	expiration time.Duration
+)
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	s3Client = s3.NewFromConfig(cfg)
+
+	bucket = os.Getenv("BUCKET_NAME")
+	prefix = os.Getenv("PREVIEW_PREFIX")
+	days, err := strconv.ParseFloat(os.Getenv("EXPIRATION_DAYS"), 64)
+	if err != nil || days <= 0 {
+		log.Fatalf("EXPIRATION_DAYS must be a positive number")
+	}
+	expiration = time.Duration(days * float64(24*time.Hour))
+}
+
+// branch is everything stored for one preview
+type branch struct {
+	keys     []types.ObjectIdentifier
+	newest   time.Time
+	deployed *time.Time // the marker's upload time, nil without one
+}
+
+func (b *branch) lastDeployed() time.Time {
+	if b.deployed != nil {
+		return *b.deployed
+	}
+	return b.newest
+}
+
+type report struct {
+	Branches int      `json:"branches"`
+	Expired  []string `json:"expired"`
+}
+
+func handler(ctx context.Context) (*report, error) {
+	branches := map[string]*branch{}
+	pages := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix + "/"),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", prefix, err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			name, rest, ok := strings.Cut(strings.TrimPrefix(key, prefix+"/"), "/")
+			if !ok || name == "" {
+				continue
+			}
+
+			b := branches[name]
+			if b == nil {
+				b = &branch{}
+				branches[name] = b
+			}
+			b.keys = append(b.keys, types.ObjectIdentifier{Key: object.Key})
+			modified := aws.ToTime(object.LastModified)
+			if modified.After(b.newest) {
+				b.newest = modified
+			}
+			if rest == markerName {
+				b.deployed = &modified
+			}
+		}
+	}
+
+	result := &report{Branches: len(branches), Expired: []string{}}
+	cutoff := time.Now().Add(-expiration)
+	for name, b := range branches {
+		if !b.lastDeployed().Before(cutoff) {
+			continue
+		}
+		if err := deleteAll(ctx, b.keys); err != nil {
+			return result, fmt.Errorf("expiring %s: %w", path.Join(prefix, name), err)
+		}
+		log.Printf("expired preview %s, last deployed %s (%d objects)", name, b.lastDeployed().Format(time.RFC3339), len(b.keys))
+		result.Expired = append(result.Expired, name)
+	}
+	return result, nil
+}
+
+// deleteAll deletes the keys, the marker last so a failure part way is retried the
+// next day instead of leaving a branch that looks freshly deployed
+func deleteAll(ctx context.Context, keys []types.ObjectIdentifier) error {
+	for i, key := range keys {
+		if path.Base(aws.ToString(key.Key)) == markerName {
+			keys[i], keys[len(keys)-1] = keys[len(keys)-1], keys[i]
+			break
+		}
+	}
+
+	// DeleteObjects takes at most 1000 keys per call
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+		out, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: keys[start:end], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("deleting %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+	}
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
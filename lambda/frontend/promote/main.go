@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+/*
+	Promotes a build from the /main origin path to /production.
+
+	The frontend CI uploads a manifest.json next to every build in main/:
+
+		{"buildId": "<git sha>", "files": [{"path": "index.html", "sha256": "<base64 sha256>"}, ...]}
+
+	sha256 is the base64 encoded digest, the same format S3 uses for ChecksumSHA256
+	(`openssl dgst -sha256 -binary index.html | base64`). Every file needs one, a
+	manifest with a file missing it is rejected.
+
+	Every file, and the manifest, is first copied to a staging prefix and checked against
+	the manifest there. Only once the whole build is verified is it copied from staging
+	to the target, so a file that doesn't match, or a build that lands in main/ part way
+	through, never reaches production.
+
+	Invoke with {"action": "promote", "buildId": "<git sha>"} or {"action": "history"},
+	cmd/promote wraps this.
+*/
+
+const (
+	manifestName   = "manifest.json"
+	configName     = "config.json" // written per environment by FrontendStack, never promoted
+	historyPrefix  = "promotions/"
+	stagingPrefix  = "promotions-staging" // a lifecycle rule cleans up after failed runs
+	historyLimit   = 20
+	copyConcurrent = 8
+)
+
+var (
+	s3Client       *s3.Client
+	cfClient       *cloudfront.Client
+	bucket         string
+	sourcePrefix   string
+	targetPrefix   string
+	distributionID string
+)
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	s3Client = s3.NewFromConfig(cfg)
+	cfClient = cloudfront.NewFromConfig(cfg)
+
+	bucket = os.Getenv("BUCKET_NAME")
+	sourcePrefix = os.Getenv("SOURCE_PREFIX")
+	targetPrefix = os.Getenv("TARGET_PREFIX")
+	distributionID = os.Getenv("DISTRIBUTION_ID")
+}
+
+type request struct {
+	Action     string `json:"action"`
+	BuildID    string `json:"buildId"`
+	PromotedBy string `json:"promotedBy"`
+	// Prune deletes objects in the target that aren't part of the build
+	Prune bool `json:"prune"`
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+type manifest struct {
+	BuildID string         `json:"buildId"`
+	Files   []manifestFile `json:"files"`
+
+	// file is the manifest itself with the checksum of what was read, its copies are
+	// checked against it like the other files
+	file manifestFile
+}
+
+// promotion is what gets written to promotions/ in the bucket and returned to the caller
+type promotion struct {
+	BuildID         string    `json:"buildId"`
+	PreviousBuildID string    `json:"previousBuildId,omitempty"`
+	PromotedBy      string    `json:"promotedBy,omitempty"`
+	PromotedAt      time.Time `json:"promotedAt"`
+	Source          string    `json:"source"`
+	Target          string    `json:"target"`
+	FilesCopied     int       `json:"filesCopied"`
+	FilesPruned     int       `json:"filesPruned"`
+	InvalidationID  string    `json:"invalidationId"`
+}
+
+func handler(ctx context.Context, req request) (any, error) {
+	switch req.Action {
+	case "", "promote":
+		return promote(ctx, req)
+	case "history":
+		return history(ctx)
+	default:
+		return nil, fmt.Errorf("unknown action %q", req.Action)
+	}
+}
+
+func promote(ctx context.Context, req request) (*promotion, error) {
+	if req.BuildID == "" {
+		return nil, errors.New("buildId is required")
+	}
+
+	source, err := readManifest(ctx, sourcePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s/%s: %w", sourcePrefix, manifestName, err)
+	}
+	// main may have moved on since whoever asked for the promotion looked at it
+	if source.BuildID != req.BuildID {
+		return nil, fmt.Errorf("%s currently holds build %s, not %s", sourcePrefix, source.BuildID, req.BuildID)
+	}
+
+	record := &promotion{
+		BuildID:    source.BuildID,
+		PromotedBy: req.PromotedBy,
+		PromotedAt: time.Now().UTC(),
+		Source:     sourcePrefix,
+		Target:     targetPrefix,
+	}
+	if previous, err := readManifest(ctx, targetPrefix); err == nil {
+		record.PreviousBuildID = previous.BuildID
+	}
+
+	// assets are content hashed so copying them first is harmless to the live site,
+	// the html files that reference them go last so the switch over is close to atomic
+	var assets, pages []manifestFile
+	for _, file := range source.Files {
+		if file.Path == manifestName || file.Path == configName || strings.Contains(file.Path, "..") {
+			return nil, fmt.Errorf("invalid path %q in manifest", file.Path)
+		}
+		if file.SHA256 == "" {
+			return nil, fmt.Errorf("%s has no sha256 in the manifest", file.Path)
+		}
+		if strings.HasSuffix(file.Path, ".html") {
+			pages = append(pages, file)
+		} else {
+			assets = append(assets, file)
+		}
+	}
+	staging := path.Join(stagingPrefix, fmt.Sprintf("%s-%d", record.BuildID, record.PromotedAt.UnixMilli()))
+	defer deletePrefix(context.WithoutCancel(ctx), staging)
+	if err := stage(ctx, staging, source); err != nil {
+		return nil, err
+	}
+
+	if err := copyFiles(ctx, staging, targetPrefix, assets); err != nil {
+		return nil, err
+	}
+	if err := copyFiles(ctx, staging, targetPrefix, pages); err != nil {
+		return nil, err
+	}
+	if err := copyObject(ctx, staging, targetPrefix, source.file); err != nil {
+		return nil, err
+	}
+	record.FilesCopied = len(source.Files)
+
+	if req.Prune {
+		pruned, err := prune(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		record.FilesPruned = pruned
+	}
+
+	invalidation, err := cfClient.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(distributionID),
+		InvalidationBatch: &cftypes.InvalidationBatch{
+			CallerReference: aws.String(fmt.Sprintf("promote-%s-%d", record.BuildID, record.PromotedAt.UnixMilli())),
+			Paths: &cftypes.Paths{
+				Quantity: aws.Int32(1),
+				Items:    []string{"/*"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalidating distribution %s: %w", distributionID, err)
+	}
+	record.InvalidationID = aws.ToString(invalidation.Invalidation.Id)
+
+	body, _ := json.Marshal(record)
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(historyPrefix + record.PromotedAt.Format("20060102T150405Z") + "-" + record.BuildID + ".json"),
+		ContentType: aws.String("application/json"),
+		Body:        strings.NewReader(string(body)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recording promotion: %w", err)
+	}
+
+	log.Printf("promoted build %s to %s (%d files, %d pruned)", record.BuildID, targetPrefix, record.FilesCopied, record.FilesPruned)
+	return record, nil
+}
+
+// stage copies the build from the source to staging, checking every file against the
+// manifest. The manifest is staged too and read back, so the build that's promoted is
+// the one the files were checked against even if main/ changes meanwhile.
+func stage(ctx context.Context, staging string, build *manifest) error {
+	if err := copyFiles(ctx, sourcePrefix, staging, build.Files); err != nil {
+		return err
+	}
+	if err := copyObject(ctx, sourcePrefix, staging, build.file); err != nil {
+		return err
+	}
+
+	staged, err := readManifest(ctx, staging)
+	if err != nil {
+		return fmt.Errorf("reading staged %s: %w", manifestName, err)
+	}
+	if staged.BuildID != build.BuildID {
+		return fmt.Errorf("%s moved on to build %s during the promotion of %s", sourcePrefix, staged.BuildID, build.BuildID)
+	}
+	return nil
+}
+
+// copyFiles copies the files server side from one prefix to another, a few at a time.
+// The first failure cancels the copies still running and no new ones are started.
+func copyFiles(ctx context.Context, from, to string, files []manifestFile) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, copyConcurrent)
+	for _, file := range files {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(file manifestFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := copyObject(ctx, from, to, file); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(file)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// copyObject copies one file between prefixes. The copy has to match the file's
+// checksum, S3 computes it while copying.
+func copyObject(ctx context.Context, from, to string, file manifestFile) error {
+	out, err := s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		CopySource:        aws.String(bucket + "/" + escapeKey(path.Join(from, file.Path))),
+		Key:               aws.String(path.Join(to, file.Path)),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return fmt.Errorf("copying %s to %s: %w", file.Path, to, err)
+	}
+
+	if aws.ToString(out.CopyObjectResult.ChecksumSHA256) != file.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: manifest has %s, copied object has %s",
+			file.Path, file.SHA256, aws.ToString(out.CopyObjectResult.ChecksumSHA256))
+	}
+	return nil
+}
+
+// escapeKey URL encodes a key for CopySource, keeping the slashes between its parts
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// deletePrefix removes the staged copy, a failure is only logged since the lifecycle
+// rule on the staging prefix gets to it eventually
+func deletePrefix(ctx context.Context, prefix string) {
+	var keys []types.ObjectIdentifier
+	pages := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix + "/"),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			log.Printf("failed to list %s for cleanup: %v", prefix, err)
+			return
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, types.ObjectIdentifier{Key: object.Key})
+		}
+	}
+
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+		_, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: keys[start:end], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			log.Printf("failed to clean up %s: %v", prefix, err)
+			return
+		}
+	}
+}
+
+// prune removes everything under the target prefix that isn't in the manifest
+func prune(ctx context.Context, build *manifest) (int, error) {
+	keep := map[string]bool{
+		path.Join(targetPrefix, manifestName): true,
+		path.Join(targetPrefix, configName):   true,
+	}
+	for _, file := range build.Files {
+		keep[path.Join(targetPrefix, file.Path)] = true
+	}
+
+	var stale []types.ObjectIdentifier
+	pages := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(targetPrefix + "/"),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("listing %s: %w", targetPrefix, err)
+		}
+		for _, object := range page.Contents {
+			if !keep[aws.ToString(object.Key)] {
+				stale = append(stale, types.ObjectIdentifier{Key: object.Key})
+			}
+		}
+	}
+
+	// DeleteObjects takes at most 1000 keys per call
+	for start := 0; start < len(stale); start += 1000 {
+		end := min(start+1000, len(stale))
+		_, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: stale[start:end], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("pruning %s: %w", targetPrefix, err)
+		}
+	}
+	return len(stale), nil
+}
+
+func readManifest(ctx context.Context, prefix string) (*manifest, error) {
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(path.Join(prefix, manifestName)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	if m.BuildID == "" {
+		return nil, errors.New("manifest has no buildId")
+	}
+	sum := sha256.Sum256(body)
+	m.file = manifestFile{Path: manifestName, SHA256: base64.StdEncoding.EncodeToString(sum[:])}
+	return &m, nil
+}
+
+// history returns the most recent promotions, newest first
+func history(ctx context.Context) ([]promotion, error) {
+	var keys []string
+	pages := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(historyPrefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+
+	// keys start with the promotion time so sorting them sorts by date
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	if len(keys) > historyLimit {
+		keys = keys[:historyLimit]
+	}
+
+	records := make([]promotion, 0, len(keys))
+	for _, key := range keys {
+		out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, err
+		}
+		var record promotion
+		err = json.NewDecoder(out.Body).Decode(&record)
+		out.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", key, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	apiutils "cdk-infrastructure/utils/api"
+	authutils "cdk-infrastructure/utils/auth"
+	importutils "cdk-infrastructure/utils/imports"
+)
+
+var (
+	s3Client      *s3.Client
+	presignClient *s3.PresignClient
+	importsBucket = os.Getenv("IMPORTS_BUCKET_NAME")
+)
+
+// anything else in an uploaded file's name is replaced, the key ends up in reports and logs
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	s3Client = s3.NewFromConfig(cfg)
+	presignClient = s3.NewPresignClient(s3Client)
+}
+
+var router = apiutils.Router{
+	"GET /imports/upload-url": uploadURL,
+	"GET /imports/report":     getReport,
+}
+
+// requireAdmin is every route's check, member forms are only handled by admins. Nothing
+// here looks at clubs so there's no store.
+func requireAdmin(ctx context.Context, evt events.APIGatewayV2HTTPRequest) error {
+	c, err := authutils.FromRequest(evt, nil)
+	if err != nil {
+		return err
+	}
+	return c.Require(ctx, authutils.Admin())
+}
+
+// uploadURL presigns a PUT for a member form export, e.g.
+// GET /imports/upload-url?fileName=fall-2026.csv. Uploading it starts the import, the
+// report shows up at GET /imports/report?key=<key> when it's done.
+func uploadURL(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if err := requireAdmin(ctx, evt); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	fileName := unsafeFileName.ReplaceAllString(path.Base(evt.QueryStringParameters["fileName"]), "_")
+	if !strings.HasSuffix(strings.ToLower(fileName), ".csv") {
+		return apiutils.Error(http.StatusBadRequest, "fileName must be a .csv file")
+	}
+	key := fmt.Sprintf("%s%d-%s", importutils.UploadPrefix, time.Now().UnixMilli(), fileName)
+
+	url, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(importsBucket),
+		Key:         aws.String(key),
+		ContentType: aws.String("text/csv"),
+	}, func(o *s3.PresignOptions) {
+		o.Expires = 5 * time.Minute
+	})
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return apiutils.JSON(http.StatusOK, map[string]any{
+		"uploadUrl":   url.URL,
+		"contentType": "text/csv",
+		"key":         key,
+	})
+}
+
+// getReport returns the report the import wrote for an upload, 404 until it's done
+func getReport(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if err := requireAdmin(ctx, evt); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	key := evt.QueryStringParameters["key"]
+	if !strings.HasPrefix(key, importutils.UploadPrefix) || strings.Contains(key, "..") {
+		return apiutils.Error(http.StatusBadRequest, "key must be one returned by /imports/upload-url")
+	}
+
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(importsBucket),
+		Key:    aws.String(importutils.ReportKey(key)),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return apiutils.Error(http.StatusNotFound, "the import hasn't finished yet")
+	}
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	defer out.Body.Close()
+
+	report, err := io.ReadAll(out.Body)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(report),
+	}, nil
+}
+
+func main() {
+	lambda.Start(router.Handle)
+}
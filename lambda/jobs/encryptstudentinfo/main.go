@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+/*
+	Encrypts the STUDENT_INFO emplids and dietary restrictions that are still plaintext.
+	Invoke it by hand once after the encrypt_student_info migration has run:
+
+	aws lambda invoke --function-name EncryptStudentInfo --payload '{}' \
+		--cli-binary-format raw-in-base64-out report.json
+
+	Add "rewrap": true to encrypt every row again with new data keys, e.g. after moving
+	to a different KMS key. It's safe to run again if it times out.
+*/
+
+type input struct {
+	Rewrap bool `json:"rewrap"`
+}
+
+func handler(ctx context.Context, in input) (*studentutils.EncryptReport, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := studentutils.EncryptInfo(ctx, db, in.Rewrap)
+	if err != nil {
+		log.Printf("Failed to encrypt student info after %d rows: %v", report.Sealed, err)
+		return nil, err
+	}
+
+	log.Printf("Encrypted student info: %d rows sealed", report.Sealed)
+	return report, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	importutils "cdk-infrastructure/utils/imports"
+)
+
+// exports are a few thousand rows at most, anything much bigger is the wrong file
+const maxUploadBytes = 10 << 20
+
+var s3Client *s3.Client
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	s3Client = s3.NewFromConfig(cfg)
+}
+
+// objectCreated is the detail of the EventBridge "Object Created" event S3 sends
+type objectCreated struct {
+	Bucket struct {
+		Name string `json:"name"`
+	} `json:"bucket"`
+	Object struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	} `json:"object"`
+}
+
+// report is written next to the upload, see importutils.ReportKey
+type report struct {
+	Source string `json:"source"`
+	// Error is set when the file couldn't be loaded at all, e.g. a bad header
+	Error    string                 `json:"error,omitempty"`
+	Loaded   int                    `json:"loaded"`
+	Rejected []importutils.Rejected `json:"rejected"`
+	// AlreadyLoaded means this upload was loaded by an earlier run, only the import ran again
+	AlreadyLoaded bool                `json:"alreadyLoaded,omitempty"`
+	Import        *importutils.Report `json:"import,omitempty"`
+}
+
+func handler(ctx context.Context, evt events.CloudWatchEvent) error {
+	var detail objectCreated
+	if err := json.Unmarshal(evt.Detail, &detail); err != nil {
+		return err
+	}
+	bucket, key := detail.Bucket.Name, detail.Object.Key
+	if !strings.HasPrefix(key, importutils.UploadPrefix) {
+		log.Printf("Ignoring %s, it isn't an upload", key)
+		return nil
+	}
+
+	r := process(ctx, bucket, key, detail.Object.Size)
+	if r.Error != "" {
+		log.Printf("Failed to import %s: %s", key, r.Error)
+	}
+
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(importutils.ReportKey(key)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// process loads and imports the upload, every failure ends up in the report so the
+// admin who uploaded it can see what went wrong
+func process(ctx context.Context, bucket, key string, size int64) *report {
+	r := &report{Source: key, Rejected: []importutils.Rejected{}}
+	if size > maxUploadBytes {
+		r.Error = fmt.Sprintf("the file is %d bytes, the most is %d", size, maxUploadBytes)
+		return r
+	}
+
+	out, err := s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer out.Body.Close()
+
+	rows, rejected, err := importutils.ParseCSV(io.LimitReader(out.Body, maxUploadBytes))
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Rejected = rejected
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	var loaded bool
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		loaded, err = importutils.Load(ctx, tx, key, rows)
+		return err
+	})
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if loaded {
+		r.Loaded = len(rows)
+	} else {
+		r.AlreadyLoaded = true
+	}
+
+	r.Import, err = importutils.Run(ctx, db, importutils.Options{Source: key})
+	if errors.Is(err, importutils.ErrBusy) {
+		// the rows are loaded, the next run for this source or ImportMemberForms picks them up
+		r.Error = "another import was running, invoke ImportMemberForms with this source to finish it"
+	} else if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	importutils "cdk-infrastructure/utils/imports"
+)
+
+/*
+	Imports the pending MEMBER_FORM_DATA rows into STUDENTS and STUDENT_INFO. Invoke it by
+	hand after loading rows into the staging table:
+
+	aws lambda invoke --function-name ImportMemberForms --payload '{"source": "fall-2026.csv"}' \
+		--cli-binary-format raw-in-base64-out report.json
+
+	Leave out source to import every pending row, add "retryConflicts": true after fixing
+	the rows the last report listed as conflicts.
+*/
+
+func handler(ctx context.Context, opts importutils.Options) (*importutils.Report, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := importutils.Run(ctx, db, opts)
+	if err != nil {
+		log.Printf("Failed to import member forms: %v", err)
+		return nil, err
+	}
+
+	for _, row := range report.Rows {
+		if row.Status == importutils.StatusConflict {
+			log.Printf("Member form row %d (%s) is a conflict: %s", row.RowID, row.Email, row.Message)
+		}
+	}
+	log.Printf("Imported member forms: %d created, %d updated, %d unchanged, %d conflicts",
+		report.Created, report.Updated, report.Unchanged, report.Conflicts)
+	return report, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	metricutils "cdk-infrastructure/utils/metrics"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+/*
+	Runs on a schedule from JobsStack. To get the repair statements, invoke it by hand with
+
+	aws lambda invoke --function-name VerifyLedger --payload '{"emitRepairs": true}' \
+		--cli-binary-format raw-in-base64-out report.json
+
+	The statements are only logged and returned, nothing is changed. Review them before
+	running them through the bastion.
+*/
+
+type input struct {
+	EmitRepairs bool `json:"emitRepairs"`
+}
+
+func handler(ctx context.Context, in input) (*pointutils.Report, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := pointutils.Verify(ctx, db, in.EmitRepairs)
+	if err != nil {
+		log.Printf("Failed to verify the ledger: %v", err)
+		return nil, err
+	}
+
+	counts := map[string]float64{
+		"LedgerEntriesChecked": float64(report.Entries),
+		"LedgerDiscrepancies":  float64(len(report.Discrepancies)),
+	}
+	for _, d := range report.Discrepancies {
+		b, _ := json.Marshal(d)
+		log.Printf("Ledger discrepancy: %s", b)
+	}
+	if err := metricutils.Emit(map[string]string{"Job": "VerifyLedger"}, counts); err != nil {
+		log.Printf("Failed to emit metrics: %v", err)
+	}
+
+	log.Printf("Checked %d ledger entries for %d students and %d purchases, found %d discrepancies",
+		report.Entries, report.Students, report.Purchases, len(report.Discrepancies))
+	return report, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
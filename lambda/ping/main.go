@@ -6,6 +6,8 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
 )
 
 type response struct {
@@ -15,15 +17,19 @@ type response struct {
 func init() {
 }
 
-func handleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handleRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if err := apiutils.CheckOrigin(request); err != nil {
+		return apiutils.Fail(err)
+	}
+
 	resp := &response{
 		Message: "hello world!",
 	}
 	body, err := json.Marshal(resp)
 	if err != nil {
-		return events.APIGatewayProxyResponse{Body: string("Error parsing payload"), StatusCode: 400}, err
+		return events.APIGatewayV2HTTPResponse{Body: string("Error parsing payload"), StatusCode: 400}, err
 	}
-	return events.APIGatewayProxyResponse{Body: string(body), StatusCode: 200}, nil
+	return events.APIGatewayV2HTTPResponse{Body: string(body), StatusCode: 200}, nil
 }
 
 func main() {
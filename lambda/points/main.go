@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+const maxPageSize = 100
+
+var router = apiutils.Router{
+	"GET /students/me/points":                       getMyPoints,
+	"GET /students/{studentId}/points":              getPoints,
+	"POST /students/{studentId}/points/adjustments": adjustPoints,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG
+var audits = map[string]auditutils.Target{
+	"POST /students/{studentId}/points/adjustments": {Entity: "points", Param: "studentId", Load: loadBalance},
+}
+
+func loadBalance(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, studentID int64) (any, error) {
+	balance, err := pointutils.Balance(ctx, q, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"balance": balance}, nil
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+func getMyPoints(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return pointsResponse(ctx, db, evt, studentID)
+}
+
+// getPoints lets admins and the student themselves look at a balance
+func getPoints(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Self(studentID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return pointsResponse(ctx, db, evt, studentID)
+}
+
+// pointsResponse is the balance and a page of the ledger, e.g. ?limit=20&offset=40
+func pointsResponse(ctx context.Context, db *sql.DB, evt events.APIGatewayV2HTTPRequest, studentID int64) (events.APIGatewayV2HTTPResponse, error) {
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	offset, err := apiutils.QueryInt(evt, "offset", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if limit < 1 || limit > maxPageSize || offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+
+	// both reads see the same snapshot so the history adds up to the balance
+	var balance int64
+	var history []pointutils.Entry
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		if balance, err = pointutils.Balance(ctx, tx, studentID); err != nil {
+			return err
+		}
+		history, err = pointutils.History(ctx, tx, studentID, limit, offset)
+		return err
+	})
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return apiutils.JSON(http.StatusOK, map[string]any{
+		"studentId": studentID,
+		"balance":   balance,
+		"history":   history,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+type adjustmentBody struct {
+	// Points is added to the balance, negative to take points away
+	Points int64  `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// adjustPoints is admin only. The Idempotency-Key header is required so a retried
+// request returns the first adjustment instead of making a second one.
+func adjustPoints(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body adjustmentBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+	key := strings.TrimSpace(evt.Headers["idempotency-key"])
+	if key == "" {
+		return apiutils.Error(http.StatusBadRequest, "the Idempotency-Key header is required")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+	actorID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var entry *pointutils.Entry
+	var added bool
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		entry, added, err = pointutils.Adjust(ctx, tx, studentID, actorID, body.Points, strings.TrimSpace(body.Reason), key)
+		return err
+	})
+	if err != nil {
+		return pointsErr(err)
+	}
+
+	status := http.StatusCreated
+	if !added {
+		status = http.StatusOK
+	}
+	return apiutils.JSON(status, entry)
+}
+
+// pointsErr maps the pointutils errors to their status codes
+func pointsErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, pointutils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, pointutils.ErrInsufficient), errors.Is(err, pointutils.ErrConflict):
+		return apiutils.Error(http.StatusConflict, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -11,11 +12,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	apiutils "cdk-infrastructure/utils/api"
+	authutils "cdk-infrastructure/utils/auth"
 )
 
 var (
 	s3Client *s3.Client
-	bucket   string
+	bucket   = os.Getenv("IMAGE_BUCKET_NAME")
 )
 
 func init() {
@@ -28,11 +32,24 @@ type res struct {
 	Key       string `json:"key"`
 }
 
-func handleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handleRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if err := apiutils.CheckOrigin(request); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	// any signed in user can upload, no store needed since nothing looks at clubs
+	caller, err := authutils.FromRequest(request, nil)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := caller.Require(ctx, authutils.Authenticated()); err != nil {
+		return apiutils.Fail(err)
+	}
+
 	fileName := request.QueryStringParameters["fileName"]
 	fileType := request.QueryStringParameters["fileType"]
 	if fileName == "" || fileType == "" {
-		return events.APIGatewayProxyResponse{Body: string(`message: "Missing fileName or fileType"`), StatusCode: 400}, nil
+		return events.APIGatewayV2HTTPResponse{Body: string(`message: "Missing fileName or fileType"`), StatusCode: 400}, nil
 	}
 
 	// dont know why i have this since in my ts i basically didnt use this
@@ -50,12 +67,12 @@ func handleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (
 		o.Expires = time.Minute
 	})
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+		return events.APIGatewayV2HTTPResponse{StatusCode: 500}, err
 	}
 
 	out, _ := json.Marshal(res{UploadURL: url.URL, Key: key})
 
-	return events.APIGatewayProxyResponse{
+	return events.APIGatewayV2HTTPResponse{
 		StatusCode: 200,
 		Headers:    map[string]string{"Access-Control-Allow-Origin": "*"},
 		Body:       string(out),
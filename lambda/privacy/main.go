@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	cognitotypes "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	privacyutils "cdk-infrastructure/utils/privacy"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+const (
+	maxPageSize = 100
+	// archives are deleted by the bucket's lifecycle rule a week later
+	downloadExpiry = 15 * time.Minute
+)
+
+var (
+	s3Client      *s3.Client
+	presignClient *s3.PresignClient
+	cognitoClient *cognitoidentityprovider.Client
+	exportsBucket = os.Getenv("EXPORTS_BUCKET_NAME")
+	userPoolID    = os.Getenv("USER_POOL_ID")
+)
+
+func init() {
+	cfg, _ := config.LoadDefaultConfig(context.Background())
+	s3Client = s3.NewFromConfig(cfg)
+	presignClient = s3.NewPresignClient(s3Client)
+	cognitoClient = cognitoidentityprovider.NewFromConfig(cfg)
+}
+
+var router = apiutils.Router{
+	"POST /students/{studentId}/export": exportStudent,
+	"POST /students/me/erasure":         requestErasure,
+	"GET /erasures":                     listErasures,
+	"POST /students/{studentId}/erase":  eraseStudent,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG. Nothing is loaded, the
+// entries would keep the data that's being exported or erased.
+var audits = map[string]auditutils.Target{
+	"POST /students/{studentId}/export": {Entity: "student", Param: "studentId"},
+	"POST /students/me/erasure":         {Entity: "erasure"},
+	"POST /students/{studentId}/erase":  {Entity: "student", Param: "studentId"},
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+// exportStudent writes everything about the student to the exports bucket and returns
+// a short lived download link. The student or an admin can ask for it.
+func exportStudent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Self(studentID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	// one transaction so the tables are read at the same point in time
+	var archive *privacyutils.Archive
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		archive, err = privacyutils.Export(ctx, tx, studentID)
+		return err
+	})
+	if err != nil {
+		return privacyErr(err)
+	}
+
+	body, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	key := privacyutils.ArchiveKey(studentID, archive.ExportedAt)
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(exportsBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	url, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(exportsBucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=\"student-%d.json\"", studentID)),
+	}, func(o *s3.PresignOptions) {
+		o.Expires = downloadExpiry
+	})
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return apiutils.JSON(http.StatusCreated, map[string]any{
+		"downloadUrl": url.URL,
+		"expiresAt":   time.Now().UTC().Add(downloadExpiry).Truncate(time.Second),
+	})
+}
+
+// requestErasure is the signed in student asking to be erased, an admin does it
+func requestErasure(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	erasure, added, err := privacyutils.RequestErasure(ctx, db, studentID, studentID)
+	if err != nil {
+		return privacyErr(err)
+	}
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	return apiutils.JSON(status, erasure)
+}
+
+// listErasures is admin only, e.g. GET /erasures?status=all&limit=50&offset=0. Only
+// pending requests are listed without status=all.
+func listErasures(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	offset, err := apiutils.QueryInt(evt, "offset", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if limit < 1 || limit > maxPageSize || offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+	status := evt.QueryStringParameters["status"]
+	if status != "" && status != "pending" && status != "all" {
+		return apiutils.Error(http.StatusBadRequest, "status must be pending or all")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	erasures, err := privacyutils.Erasures(ctx, db, status == "all", limit, offset)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"erasures": erasures, "limit": limit, "offset": offset})
+}
+
+// eraseStudent is admin only. The student's archives and sign in account are deleted
+// along with their data.
+func eraseStudent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+	actorID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	// the archives and the account go before the commit, if deleting them fails the
+	// student isn't marked erased and the request can be retried
+	var erasure *privacyutils.Erasure
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		erasure, err = privacyutils.Erase(ctx, tx, studentID, actorID)
+		if err != nil {
+			return err
+		}
+		if err := deleteArchives(ctx, studentID); err != nil {
+			return err
+		}
+		return deleteAccount(ctx, erasure.CognitoSub)
+	})
+	if errors.Is(err, privacyutils.ErrAlreadyErased) {
+		// an archive exported while the erasure was committing can outlive it, erasing
+		// again still clears those
+		if err := deleteArchives(ctx, studentID); err != nil {
+			return apiutils.Fail(err)
+		}
+	}
+	if err != nil {
+		return privacyErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, erasure)
+}
+
+// deleteArchives removes every archive exported for the student
+func deleteArchives(ctx context.Context, studentID int64) error {
+	prefix := fmt.Sprintf("%s%d/", privacyutils.ExportPrefix, studentID)
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(exportsBucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: object.Key}
+		}
+		out, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(exportsBucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		// a batch delete succeeds even when some of its objects weren't deleted
+		if len(out.Errors) > 0 {
+			failed := out.Errors[0]
+			return fmt.Errorf("deleting %d of the export archives failed, %s: %s",
+				len(out.Errors), aws.ToString(failed.Key), aws.ToString(failed.Message))
+		}
+	}
+	return nil
+}
+
+// deleteAccount removes the student's sign in account from the user pool. One that's
+// already gone, e.g. by a retry after a failed commit, is fine.
+func deleteAccount(ctx context.Context, cognitoSub *string) error {
+	if cognitoSub == nil {
+		return nil
+	}
+	_, err := cognitoClient.AdminDeleteUser(ctx, &cognitoidentityprovider.AdminDeleteUserInput{
+		UserPoolId: aws.String(userPoolID),
+		Username:   cognitoSub,
+	})
+	var notFound *cognitotypes.UserNotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deleting the sign in account: %w", err)
+	}
+	return nil
+}
+
+// privacyErr maps the privacyutils errors to their status codes
+func privacyErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, privacyutils.ErrNotFound), errors.Is(err, studentutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, privacyutils.ErrConflict):
+		return apiutils.Error(http.StatusConflict, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	clubutils "cdk-infrastructure/utils/clubs"
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+	publicutils "cdk-infrastructure/utils/public"
+)
+
+const maxPageSize = 100
+
+// the routes are public and cached by ClubEventApiCdn, only clubId and limit are part of
+// the cache key so no other parameter can be read here
+var router = apiutils.Router{
+	"GET /public/events":     listEvents,
+	"GET /public/events.rss": rssEvents,
+}
+
+// cacheControl lets browsers keep the feeds for a minute and CloudFront for five,
+// publishing or changing an event clears CloudFront sooner (see publicutils.Invalidate)
+const cacheControl = "public, max-age=60, s-maxage=300"
+
+// listEvents returns upcoming posted events, e.g. GET /public/events?clubId=3&limit=20
+func listEvents(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	upcoming, err := upcoming(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	resp, err := apiutils.JSON(http.StatusOK, map[string]any{"events": upcoming})
+	resp.Headers["Cache-Control"] = cacheControl
+	return resp, err
+}
+
+// rssEvents is listEvents as an RSS 2.0 feed, e.g. GET /public/events.rss?clubId=3
+func rssEvents(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	upcoming, err := upcoming(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	body, err := publicutils.RSS(os.Getenv("API_URL")+"/public/events", upcoming)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":  "application/rss+xml; charset=utf-8",
+			"Cache-Control": cacheControl,
+		},
+		Body: string(body),
+	}, nil
+}
+
+// upcoming lists the posted events that haven't ended, soonest first
+func upcoming(ctx context.Context, evt events.APIGatewayV2HTTPRequest) ([]publicutils.Event, error) {
+	clubID, err := apiutils.QueryInt(evt, "clubId", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > maxPageSize {
+		return nil, apiutils.Errorf(http.StatusBadRequest, "limit must be between 1 and 100")
+	}
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := eventutils.ListPosted(ctx, db, time.Now(), clubID, limit)
+	if err != nil {
+		return nil, err
+	}
+	clubs, err := clubutils.List(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[int64]*string{}
+	for _, club := range clubs {
+		names[club.ID] = club.Name
+	}
+	return publicutils.Events(listed, names), nil
+}
+
+func main() {
+	lambda.Start(router.Handle)
+}
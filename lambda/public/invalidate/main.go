@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+
+	publicutils "cdk-infrastructure/utils/public"
+)
+
+/*
+	Clears the public event feeds from ClubEventApiCdn, see publicutils.Invalidate.
+	It runs outside the vpc since CloudFront can't be reached from inside it.
+
+	Invoked asynchronously with {"reason": "event 7 published"}.
+*/
+
+var (
+	distributionID = os.Getenv("DISTRIBUTION_ID")
+	cfClient       *cloudfront.Client
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("loading aws config: %v", err)
+	}
+	cfClient = cloudfront.NewFromConfig(cfg)
+}
+
+func handler(ctx context.Context, req publicutils.InvalidateRequest) error {
+	// lambda retries a failed async invoke with the same request id, which makes the
+	// retry the same invalidation instead of a second one
+	reference := fmt.Sprintf("public-%d", time.Now().UnixNano())
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		reference = "public-" + lc.AwsRequestID
+	}
+
+	invalidation, err := cfClient.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(distributionID),
+		InvalidationBatch: &cftypes.InvalidationBatch{
+			CallerReference: aws.String(reference),
+			Paths: &cftypes.Paths{
+				Quantity: aws.Int32(1),
+				Items:    []string{publicutils.Paths},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalidating distribution %s: %w", distributionID, err)
+	}
+
+	log.Printf("invalidated %s (%s): %s", publicutils.Paths, req.Reason, aws.ToString(invalidation.Invalidation.Id))
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	pointutils "cdk-infrastructure/utils/points"
+	rewardutils "cdk-infrastructure/utils/rewards"
+)
+
+const maxPageSize = 100
+
+var router = apiutils.Router{
+	"GET /rewards":                         listRewards,
+	"POST /rewards":                        createReward,
+	"GET /rewards/{rewardId}":              getReward,
+	"PATCH /rewards/{rewardId}":            patchReward,
+	"POST /rewards/{rewardId}/purchase":    buyReward,
+	"GET /students/me/purchases":           myPurchases,
+	"GET /clubs/{clubId}/purchases":        clubPurchases,
+	"GET /purchases":                       allPurchases,
+	"POST /purchases/{purchaseId}/fulfill": fulfillPurchase,
+	"POST /purchases/{purchaseId}/refund":  refundPurchase,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG
+var audits = map[string]auditutils.Target{
+	"POST /rewards":                        {Entity: "reward", Load: loadReward},
+	"PATCH /rewards/{rewardId}":            {Entity: "reward", Param: "rewardId", Load: loadReward},
+	"POST /rewards/{rewardId}/purchase":    {Entity: "purchase", Load: loadPurchase},
+	"POST /purchases/{purchaseId}/fulfill": {Entity: "purchase", Param: "purchaseId", Load: loadPurchase},
+	"POST /purchases/{purchaseId}/refund":  {Entity: "purchase", Param: "purchaseId", Load: loadPurchase},
+}
+
+func loadReward(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, rewardID int64) (any, error) {
+	reward, err := rewardutils.Get(ctx, q, rewardID)
+	if errors.Is(err, rewardutils.ErrNotFound) {
+		return nil, nil
+	}
+	return reward, err
+}
+
+func loadPurchase(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, purchaseID int64) (any, error) {
+	purchase, err := rewardutils.GetPurchase(ctx, q, purchaseID)
+	if errors.Is(err, rewardutils.ErrNotFound) {
+		return nil, nil
+	}
+	return purchase, err
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+// manages passes for whoever runs the reward, the club's eboard or admins when clubID is nil
+func manages(clubID *int64) authutils.Check {
+	if clubID == nil {
+		return authutils.Admin()
+	}
+	return authutils.EboardOf(*clubID)
+}
+
+// listRewards is the catalog, e.g. GET /rewards?clubId=3. Managers can add
+// includeInactive=true to see what's been taken down.
+func listRewards(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var filter rewardutils.Filter
+	var err error
+	if filter.ClubID, err = apiutils.QueryInt(evt, "clubId", 0); err != nil {
+		return apiutils.Fail(err)
+	}
+	filter.IncludeInactive = evt.QueryStringParameters["includeInactive"] == "true"
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.IncludeInactive {
+		var clubID *int64
+		if filter.ClubID != 0 {
+			clubID = &filter.ClubID
+		}
+		if err := c.Require(ctx, manages(clubID)); err != nil {
+			return apiutils.Fail(err)
+		}
+	}
+
+	rewards, err := rewardutils.List(ctx, db, filter)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"rewards": rewards})
+}
+
+func getReward(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	rewardID, err := apiutils.PathID(evt, "rewardId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	reward, err := rewardutils.Get(ctx, db, rewardID)
+	if err != nil {
+		return rewardErr(err)
+	}
+	if !reward.Active {
+		ok, err := c.Can(ctx, manages(reward.ClubID))
+		if err != nil {
+			return apiutils.Fail(err)
+		}
+		if !ok {
+			return apiutils.Error(http.StatusNotFound, "reward not found")
+		}
+	}
+	return apiutils.JSON(http.StatusOK, reward)
+}
+
+type createBody struct {
+	// ClubID is the club that hands the reward out, leave it out for one run by admins
+	ClubID *int64 `json:"clubId"`
+	rewardutils.Fields
+}
+
+func createReward(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body createBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, manages(body.ClubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	reward, err := rewardutils.Create(ctx, db, body.ClubID, body.Fields)
+	if err != nil {
+		return rewardErr(err)
+	}
+	return apiutils.JSON(http.StatusCreated, reward)
+}
+
+func patchReward(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	rewardID, err := apiutils.PathID(evt, "rewardId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body rewardutils.Fields
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var reward *rewardutils.Reward
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		if reward, err = rewardutils.Lock(ctx, tx, rewardID); err != nil {
+			return err
+		}
+		if err := c.Require(ctx, manages(reward.ClubID)); err != nil {
+			return err
+		}
+		return rewardutils.Update(ctx, tx, reward, body)
+	})
+	if err != nil {
+		return rewardErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, reward)
+}
+
+// buyReward spends the signed in student's points. The Idempotency-Key header is
+// required so a retried request returns the first purchase instead of buying twice.
+func buyReward(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	rewardID, err := apiutils.PathID(evt, "rewardId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	key := strings.TrimSpace(evt.Headers["idempotency-key"])
+	if key == "" {
+		return apiutils.Error(http.StatusBadRequest, "the Idempotency-Key header is required")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var purchase *rewardutils.Purchase
+	var added bool
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		purchase, added, err = rewardutils.Buy(ctx, tx, rewardID, studentID, key)
+		return err
+	})
+	if err != nil {
+		return rewardErr(err)
+	}
+
+	status := http.StatusCreated
+	if !added {
+		status = http.StatusOK
+	}
+	return apiutils.JSON(status, purchase)
+}
+
+func myPurchases(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return purchasesResponse(ctx, db, evt, rewardutils.PurchaseFilter{StudentID: studentID})
+}
+
+// clubPurchases is the club's eboard working through what to hand out, e.g.
+// GET /clubs/3/purchases?status=pending
+func clubPurchases(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	clubID, err := apiutils.PathID(evt, "clubId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOf(clubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return purchasesResponse(ctx, db, evt, rewardutils.PurchaseFilter{ClubID: clubID})
+}
+
+// allPurchases is admin only, every club's purchases and the admin run rewards
+func allPurchases(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return purchasesResponse(ctx, db, evt, rewardutils.PurchaseFilter{})
+}
+
+// purchasesResponse adds ?status=, ?limit= and ?offset= to the filter and lists the page
+func purchasesResponse(ctx context.Context, db *sql.DB, evt events.APIGatewayV2HTTPRequest, filter rewardutils.PurchaseFilter) (events.APIGatewayV2HTTPResponse, error) {
+	var err error
+	switch status := rewardutils.Status(evt.QueryStringParameters["status"]); status {
+	case "", rewardutils.StatusPending, rewardutils.StatusFulfilled, rewardutils.StatusRefunded:
+		filter.Status = status
+	default:
+		return apiutils.Error(http.StatusBadRequest, "status must be pending, fulfilled or refunded")
+	}
+	if filter.Limit, err = apiutils.QueryInt(evt, "limit", 50); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.Offset, err = apiutils.QueryInt(evt, "offset", 0); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.Limit < 1 || filter.Limit > maxPageSize || filter.Offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+
+	purchases, err := rewardutils.Purchases(ctx, db, filter)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{
+		"purchases": purchases,
+		"limit":     filter.Limit,
+		"offset":    filter.Offset,
+	})
+}
+
+func fulfillPurchase(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return handlePurchase(ctx, evt, rewardutils.Fulfill)
+}
+
+func refundPurchase(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return handlePurchase(ctx, evt, rewardutils.Refund)
+}
+
+// handlePurchase runs fulfill or refund for whoever manages the purchased reward
+func handlePurchase(
+	ctx context.Context,
+	evt events.APIGatewayV2HTTPRequest,
+	action func(ctx context.Context, q databaseutils.Querier, purchaseID, actorID int64) (*rewardutils.Purchase, error),
+) (events.APIGatewayV2HTTPResponse, error) {
+	purchaseID, err := apiutils.PathID(evt, "purchaseId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	purchase, err := rewardutils.GetPurchase(ctx, db, purchaseID)
+	if err != nil {
+		return rewardErr(err)
+	}
+	// purchases from before the catalog have no club, admins handle those
+	if err := c.Require(ctx, manages(purchase.ClubID)); err != nil {
+		return apiutils.Fail(err)
+	}
+	actorID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		purchase, err = action(ctx, tx, purchaseID, actorID)
+		return err
+	})
+	if err != nil {
+		return rewardErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, purchase)
+}
+
+// rewardErr maps the util package errors to their status codes
+func rewardErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, rewardutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, rewardutils.ErrInvalid), errors.Is(err, pointutils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, rewardutils.ErrSoldOut), errors.Is(err, rewardutils.ErrConflict),
+		errors.Is(err, pointutils.ErrInsufficient), errors.Is(err, pointutils.ErrConflict):
+		return apiutils.Error(http.StatusConflict, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
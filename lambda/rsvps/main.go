@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+	rsvputils "cdk-infrastructure/utils/rsvps"
+)
+
+var router = apiutils.Router{
+	"GET /events/{eventId}/rsvp":      getRSVP,
+	"PUT /events/{eventId}/rsvp":      putRSVP,
+	"PUT /events/{eventId}/capacity":  putCapacity,
+	"GET /events/{eventId}/attendees": attendees,
+	"GET /events/{eventId}/catering":  catering,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG
+var audits = map[string]auditutils.Target{
+	"PUT /events/{eventId}/rsvp":     {Entity: "rsvp", Param: auditutils.ParamMe, Load: loadRSVP},
+	"PUT /events/{eventId}/capacity": {Entity: "event", Param: "eventId", Load: loadEvent},
+}
+
+// loadRSVP is the student's answer for the event in the path
+func loadRSVP(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, studentID int64) (any, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return nil, err
+	}
+	rsvp, err := rsvputils.Get(ctx, q, eventID, studentID)
+	if rsvp == nil {
+		return nil, err
+	}
+	return rsvp, nil
+}
+
+func loadEvent(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, eventID int64) (any, error) {
+	event, err := eventutils.Get(ctx, q, eventID)
+	if errors.Is(err, eventutils.ErrNotFound) {
+		return nil, nil
+	}
+	return event, err
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+func getRSVP(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	rsvp, err := rsvputils.Get(ctx, db, eventID, studentID)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if rsvp == nil {
+		return apiutils.Error(http.StatusNotFound, "no rsvp for this event")
+	}
+	return apiutils.JSON(http.StatusOK, rsvp)
+}
+
+type rsvpBody struct {
+	Status rsvputils.Status `json:"status"`
+}
+
+// putRSVP answers for the signed in student, e.g. PUT /events/7/rsvp {"status": "going"}.
+// Going to a full event puts the student on the waitlist.
+func putRSVP(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body rsvpBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var rsvp *rsvputils.RSVP
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		// drafts and deleted events look like they don't exist, like GET /events/{eventId}
+		if !event.Visible() {
+			return eventutils.ErrNotFound
+		}
+		if ended(event) {
+			return apiutils.Errorf(http.StatusConflict, "the event is over")
+		}
+		rsvp, err = rsvputils.Respond(ctx, tx, event, studentID, body.Status)
+		return err
+	})
+	if err != nil {
+		return rsvpErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, rsvp)
+}
+
+// ended is true once the event's end, or start if it has none, has passed
+func ended(event *eventutils.Event) bool {
+	end := event.Current.End
+	if end == nil {
+		end = event.Current.Start
+	}
+	return end != nil && end.Before(time.Now())
+}
+
+type capacityBody struct {
+	// Capacity is the most students that can be going, null for no limit
+	Capacity *int64 `json:"capacity"`
+}
+
+// putCapacity sets the event's capacity, raising it confirms students from the waitlist
+func putCapacity(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body capacityBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var summary *rsvputils.Summary
+	var promoted []int64
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := eventutils.Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		if promoted, err = rsvputils.SetCapacity(ctx, tx, event, body.Capacity); err != nil {
+			return err
+		}
+		summary, err = rsvputils.Summarize(ctx, tx, event)
+		return err
+	})
+	if err != nil {
+		return rsvpErr(err)
+	}
+
+	if promoted == nil {
+		promoted = []int64{}
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"summary": summary, "promoted": promoted})
+}
+
+// attendees lists everyone who answered for the hosts' eboards, as JSON or with
+// ?format=csv as a spreadsheet
+func attendees(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	event, list, err := loadAttendees(ctx, evt)
+	if err != nil {
+		return rsvpErr(err)
+	}
+
+	if evt.QueryStringParameters["format"] == "csv" {
+		return attendeesCSV(event, list)
+	}
+
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	summary, err := rsvputils.Summarize(ctx, db, event)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"summary": summary, "attendees": list})
+}
+
+func catering(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	_, list, err := loadAttendees(ctx, evt)
+	if err != nil {
+		return rsvpErr(err)
+	}
+	return apiutils.JSON(http.StatusOK, rsvputils.CateringSummary(list))
+}
+
+// loadAttendees loads the event and its attendees for the hosts' eboards
+func loadAttendees(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*eventutils.Event, []rsvputils.Attendee, error) {
+	eventID, err := apiutils.PathID(evt, "eventId")
+	if err != nil {
+		return nil, nil, err
+	}
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.Require(ctx, authutils.EboardOfEventHost(eventID)); err != nil {
+		return nil, nil, err
+	}
+
+	event, err := eventutils.Get(ctx, db, eventID)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := rsvputils.Attendees(ctx, db, eventID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return event, list, nil
+}
+
+func attendeesCSV(event *eventutils.Event, list []rsvputils.Attendee) (events.APIGatewayV2HTTPResponse, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"first_name", "last_name", "email", "status", "waitlisted", "responded_at", "dietary_restrictions"})
+	for _, a := range list {
+		w.Write([]string{
+			cell(a.FirstName),
+			cell(a.LastName),
+			cell(a.Email),
+			string(a.Status),
+			strconv.FormatBool(a.Waitlisted),
+			a.RespondedAt.UTC().Format(time.RFC3339),
+			cell(a.DietaryRestrictions),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":        "text/csv; charset=utf-8",
+			"Content-Disposition": fmt.Sprintf(`attachment; filename="event-%d-attendees.csv"`, event.ID),
+		},
+		Body: buf.String(),
+	}, nil
+}
+
+// cell keeps spreadsheet apps from running what students typed in as a formula
+func cell(value *string) string {
+	if value == nil {
+		return ""
+	}
+	if *value != "" && strings.ContainsRune("=+-@\t\r", rune((*value)[0])) {
+		return "'" + *value
+	}
+	return *value
+}
+
+// rsvpErr maps the eventutils and rsvputils errors to their status codes
+func rsvpErr(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, eventutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, rsvputils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
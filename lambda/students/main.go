@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	apiutils "cdk-infrastructure/utils/api"
+	auditutils "cdk-infrastructure/utils/audit"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	pointutils "cdk-infrastructure/utils/points"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+const maxPageSize = 100
+
+var router = apiutils.Router{
+	"GET /students/me":           getMe,
+	"PATCH /students/me":         patchMe,
+	"PUT /students/me/interests": putMyInterests,
+	"GET /students":              listStudents,
+	"GET /students/{studentId}":  getStudent,
+	"GET /interests":             listInterests,
+
+	"GET /students/duplicates":         listDuplicates,
+	"POST /students/{studentId}/merge": mergeStudent,
+	"GET /students/merges":             listMerges,
+}
+
+// audits says what each change is recorded as in AUDIT_LOG
+var audits = map[string]auditutils.Target{
+	"PATCH /students/me":               {Entity: "student", Param: auditutils.ParamMe, Load: loadProfile},
+	"PUT /students/me/interests":       {Entity: "student", Param: auditutils.ParamMe, Load: loadProfile},
+	"POST /students/{studentId}/merge": {Entity: "student", Param: "studentId", Load: loadProfile},
+}
+
+func loadProfile(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, studentID int64) (any, error) {
+	profile, err := studentutils.Get(ctx, q, studentID)
+	if errors.Is(err, studentutils.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return profile.Redacted(), nil
+}
+
+// caller connects to the database and identifies who's making the request
+func caller(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (*sql.DB, *authutils.Caller, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db))
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, c, nil
+}
+
+func getMe(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return profileResponse(studentutils.Get(ctx, db, studentID))
+}
+
+// profilePatch only changes the fields that are in the body
+type profilePatch struct {
+	FirstName           *string `json:"firstName"`
+	LastName            *string `json:"lastName"`
+	Major               *string `json:"major"`
+	Emplid              *string `json:"emplid"`
+	GradYear            *int64  `json:"gradYear"`
+	DietaryRestrictions *string `json:"dietaryRestrictions"`
+	Comments            *string `json:"comments"`
+}
+
+func (p profilePatch) validate() error {
+	limits := []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"firstName", p.FirstName, 50},
+		{"lastName", p.LastName, 50},
+		{"major", p.Major, 255},
+		{"emplid", p.Emplid, 255},
+		{"dietaryRestrictions", p.DietaryRestrictions, 255},
+		{"comments", p.Comments, 255},
+	}
+	for _, limit := range limits {
+		if limit.value != nil && len(*limit.value) > limit.max {
+			return apiutils.Errorf(http.StatusBadRequest, "%s can be at most %d characters", limit.name, limit.max)
+		}
+	}
+
+	if p.GradYear != nil && (*p.GradYear < 1900 || *p.GradYear > 2200) {
+		return apiutils.Errorf(http.StatusBadRequest, "gradYear is not a valid year")
+	}
+	return nil
+}
+
+func (p profilePatch) apply(profile *studentutils.Profile) {
+	set := func(dst **string, src *string) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	set(&profile.FirstName, p.FirstName)
+	set(&profile.LastName, p.LastName)
+	set(&profile.Major, p.Major)
+	set(&profile.Emplid, p.Emplid)
+	set(&profile.DietaryRestrictions, p.DietaryRestrictions)
+	set(&profile.Comments, p.Comments)
+	if p.GradYear != nil {
+		profile.GradYear = p.GradYear
+	}
+}
+
+func patchMe(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var patch profilePatch
+	if err := apiutils.Decode(evt, &patch); err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := patch.validate(); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		profile, err := studentutils.Get(ctx, tx, studentID)
+		if err != nil {
+			return err
+		}
+		patch.apply(profile)
+		return studentutils.Save(ctx, tx, profile)
+	})
+	if err != nil {
+		return profileResponse(nil, err)
+	}
+
+	return profileResponse(studentutils.Get(ctx, db, studentID))
+}
+
+type interestsBody struct {
+	InterestIDs []int64 `json:"interestIds"`
+}
+
+func putMyInterests(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var body interestsBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		return studentutils.SetInterests(ctx, tx, studentID, body.InterestIDs)
+	})
+	if err != nil {
+		return profileResponse(nil, err)
+	}
+
+	return profileResponse(studentutils.Get(ctx, db, studentID))
+}
+
+// listStudents is admin only, e.g. GET /students?major=CS&gradYear=2027&interestId=2&limit=50&offset=100
+func listStudents(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	filter := studentutils.Filter{Major: evt.QueryStringParameters["major"]}
+	if filter.GradYear, err = apiutils.QueryInt(evt, "gradYear", 0); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.InterestID, err = apiutils.QueryInt(evt, "interestId", 0); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.Limit, err = apiutils.QueryInt(evt, "limit", 50); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.Offset, err = apiutils.QueryInt(evt, "offset", 0); err != nil {
+		return apiutils.Fail(err)
+	}
+	if filter.Limit < 1 || filter.Limit > maxPageSize || filter.Offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+
+	profiles, err := studentutils.List(ctx, db, filter)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return apiutils.JSON(http.StatusOK, map[string]any{
+		"students": profiles,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+	})
+}
+
+// getStudent lets admins and the student themselves look at a profile
+func getStudent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	studentID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Self(studentID)); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	return profileResponse(studentutils.Get(ctx, db, studentID))
+}
+
+func listInterests(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	db, err := databaseutils.Connect(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	interests, err := studentutils.Interests(ctx, db)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"interests": interests})
+}
+
+// listDuplicates is admin only, e.g. GET /students/duplicates?limit=20
+func listDuplicates(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if limit < 1 || limit > maxPageSize {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	candidates, err := studentutils.Candidates(ctx, db, int(limit))
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"candidates": candidates})
+}
+
+type mergeBody struct {
+	DuplicateID int64 `json:"duplicateId"`
+}
+
+// mergeStudent is admin only, the student in the path is kept and the duplicate is
+// merged into them
+func mergeStudent(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	survivorID, err := apiutils.PathID(evt, "studentId")
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	var body mergeBody
+	if err := apiutils.Decode(evt, &body); err != nil {
+		return apiutils.Fail(err)
+	}
+	if body.DuplicateID == 0 {
+		return apiutils.Error(http.StatusBadRequest, "duplicateId is required")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+	actorID, err := c.StudentID(ctx)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+
+	var record *studentutils.MergeRecord
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		record, err = studentutils.Merge(ctx, tx, survivorID, body.DuplicateID, actorID)
+		return err
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	profile, err := studentutils.Get(ctx, db, survivorID)
+	if err != nil {
+		return fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"merge": record, "student": profile})
+}
+
+// listMerges is admin only, e.g. GET /students/merges?limit=50&offset=0
+func listMerges(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	limit, err := apiutils.QueryInt(evt, "limit", 50)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	offset, err := apiutils.QueryInt(evt, "offset", 0)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if limit < 1 || limit > maxPageSize || offset < 0 {
+		return apiutils.Error(http.StatusBadRequest, "limit must be between 1 and 100 and offset can't be negative")
+	}
+
+	db, c, err := caller(ctx, evt)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	if err := c.Require(ctx, authutils.Admin()); err != nil {
+		return apiutils.Fail(err)
+	}
+
+	merges, err := studentutils.Merges(ctx, db, limit, offset)
+	if err != nil {
+		return apiutils.Fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, map[string]any{"merges": merges, "limit": limit, "offset": offset})
+}
+
+// profileResponse maps the studentutils errors to their status codes
+func profileResponse(profile *studentutils.Profile, err error) (events.APIGatewayV2HTTPResponse, error) {
+	if err != nil {
+		return fail(err)
+	}
+	return apiutils.JSON(http.StatusOK, profile)
+}
+
+func fail(err error) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case errors.Is(err, studentutils.ErrNotFound):
+		return apiutils.Error(http.StatusNotFound, err.Error())
+	case errors.Is(err, studentutils.ErrInvalid):
+		return apiutils.Error(http.StatusBadRequest, err.Error())
+	case errors.Is(err, studentutils.ErrConflict), errors.Is(err, pointutils.ErrInsufficient):
+		return apiutils.Error(http.StatusConflict, err.Error())
+	}
+	return apiutils.Fail(err)
+}
+
+func main() {
+	lambda.Start(auditutils.Wrap(router, audits).Handle)
+}
@@ -0,0 +1,162 @@
+package apiutils
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	authutils "cdk-infrastructure/utils/auth"
+)
+
+// StatusError is an error with the status code it should be answered with,
+// handlers return these for anything that's the caller's fault
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// Errorf returns a *StatusError, e.g. apiutils.Errorf(404, "club %d not found", id)
+func Errorf(status int, format string, args ...any) error {
+	return &StatusError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// JSON responds with v marshalled as the body
+func JSON(status int, v any) (events.APIGatewayV2HTTPResponse, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return Fail(err)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(body),
+	}, nil
+}
+
+// Error responds with {"error": message}
+func Error(status int, message string) (events.APIGatewayV2HTTPResponse, error) {
+	return JSON(status, errorBody{Error: message})
+}
+
+// Fail turns an error from a handler into a response. Auth errors become 401/403,
+// a *StatusError keeps its status and anything else is logged and becomes a 500.
+// The error is never returned to lambda, that would turn into a 500 without a body.
+func Fail(err error) (events.APIGatewayV2HTTPResponse, error) {
+	var statusErr *StatusError
+
+	switch {
+	case errors.As(err, &statusErr):
+		return Error(statusErr.Status, statusErr.Message)
+	case errors.Is(err, authutils.ErrUnauthenticated):
+		return Error(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, authutils.ErrForbidden), errors.Is(err, authutils.ErrNoStudent):
+		return Error(http.StatusForbidden, err.Error())
+	}
+
+	log.Println("handler error:", err) // appears in CloudWatch Logs
+	return Error(http.StatusInternalServerError, "internal error")
+}
+
+// HandlerFunc handles one route. Returned errors are turned into responses by Fail.
+type HandlerFunc func(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
+
+// Router maps route keys, the "METHOD /path/{param}" API Gateway matched, to their
+// handler so one lambda can serve a group of routes.
+type Router map[string]HandlerFunc
+
+// OriginHeader is added by ClubEventApiCdn to every request it forwards, with the value
+// the lambdas get in API_ORIGIN_SECRET. Requests without it skipped CloudFront, and so
+// the web ACL, by calling the execute-api endpoint directly.
+const OriginHeader = "x-origin-verify"
+
+// CheckOrigin rejects requests that didn't come through ClubEventApiCdn. Without
+// API_ORIGIN_SECRET, e.g. in tests, every request is let through.
+func CheckOrigin(evt events.APIGatewayV2HTTPRequest) error {
+	want := os.Getenv("API_ORIGIN_SECRET")
+	if want == "" {
+		return nil
+	}
+	// API Gateway lowercases header names
+	if subtle.ConstantTimeCompare([]byte(evt.Headers[OriginHeader]), []byte(want)) != 1 {
+		return Errorf(http.StatusForbidden, "use the api url, not the execute-api endpoint")
+	}
+	return nil
+}
+
+// Handle is the lambda handler for the router's routes
+func (r Router) Handle(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	if err := CheckOrigin(evt); err != nil {
+		return Fail(err)
+	}
+
+	handler, ok := r[evt.RouteKey]
+	if !ok {
+		return Error(http.StatusNotFound, "no handler for "+evt.RouteKey)
+	}
+
+	resp, err := handler(ctx, evt)
+	if err != nil {
+		return Fail(err)
+	}
+	return resp, nil
+}
+
+// Decode reads the JSON body into v, a body that doesn't parse is a 400
+func Decode(evt events.APIGatewayV2HTTPRequest, v any) error {
+	body := []byte(evt.Body)
+	if evt.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(evt.Body)
+		if err != nil {
+			return Errorf(http.StatusBadRequest, "body is not valid base64")
+		}
+		body = decoded
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return Errorf(http.StatusBadRequest, "invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// PathID reads a numeric path parameter like {clubId}, anything else is a 400
+func PathID(evt events.APIGatewayV2HTTPRequest, name string) (int64, error) {
+	id, err := strconv.ParseInt(evt.PathParameters[name], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, Errorf(http.StatusBadRequest, "%s must be a positive integer", name)
+	}
+	return id, nil
+}
+
+// QueryInt reads an optional numeric query string parameter, returning def when it's missing
+func QueryInt(evt events.APIGatewayV2HTTPRequest, name string, def int64) (int64, error) {
+	value, ok := evt.QueryStringParameters[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, Errorf(http.StatusBadRequest, "%s must be an integer", name)
+	}
+	return number, nil
+}
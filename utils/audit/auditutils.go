@@ -0,0 +1,130 @@
+package auditutils
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// Entry is one row of AUDIT_LOG, a successful call that changed something
+type Entry struct {
+	ID int64 `json:"id"`
+	// ActorID is nil when the caller's account isn't linked to a student yet
+	ActorID  *int64  `json:"actorId"`
+	ActorSub *string `json:"actorSub"`
+	Action   string  `json:"action"`
+	Entity   string  `json:"entity"`
+	EntityID *int64  `json:"entityId"`
+	// Before and After are the entity as its Target loads it, nil when it didn't
+	// exist or the target has no loader
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Status    int             `json:"status"`
+	RequestID *string         `json:"requestId"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+const selectEntries = "SELECT `id`, `actor_id`, `actor_sub`, `action`, `entity`, `entity_id`, `before`, `after`, " +
+	"`status`, `request_id`, `created_at` FROM `AUDIT_LOG` "
+
+func scanEntry(row interface{ Scan(...any) error }) (*Entry, error) {
+	var e Entry
+	var before, after []byte
+	err := row.Scan(&e.ID, &e.ActorID, &e.ActorSub, &e.Action, &e.Entity, &e.EntityID, &before, &after,
+		&e.Status, &e.RequestID, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	// copied, the driver reuses the buffers for the next row
+	if before != nil {
+		e.Before = append(json.RawMessage{}, before...)
+	}
+	if after != nil {
+		e.After = append(json.RawMessage{}, after...)
+	}
+	return &e, nil
+}
+
+// Record adds the entry to AUDIT_LOG, ID and CreatedAt are filled in
+func Record(ctx context.Context, q databaseutils.Querier, e *Entry) error {
+	e.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO `AUDIT_LOG` (`actor_id`, `actor_sub`, `action`, `entity`, `entity_id`, `before`, `after`, "+
+			"`status`, `request_id`, `created_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.ActorID, e.ActorSub, e.Action, e.Entity, e.EntityID, nullJSON(e.Before), nullJSON(e.After),
+		e.Status, e.RequestID, e.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// nullJSON keeps a missing value NULL instead of an empty string, which isn't JSON
+func nullJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
+
+// Filter narrows Entries, zero values are ignored
+type Filter struct {
+	ActorID  int64
+	Entity   string
+	EntityID int64
+	// From is inclusive and To exclusive
+	From, To time.Time
+	Limit    int64
+	Offset   int64
+}
+
+// Entries lists the log newest first
+func Entries(ctx context.Context, q databaseutils.Querier, filter Filter) ([]*Entry, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	if filter.ActorID != 0 {
+		where = append(where, "`actor_id` = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Entity != "" {
+		where = append(where, "`entity` = ?")
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		where = append(where, "`entity_id` = ?")
+		args = append(args, filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "`created_at` >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "`created_at` < ?")
+		args = append(args, filter.To.UTC())
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := q.QueryContext(ctx,
+		selectEntries+"WHERE "+strings.Join(where, " AND ")+" ORDER BY `id` DESC LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*Entry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,127 @@
+package auditutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	apiutils "cdk-infrastructure/utils/api"
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+)
+
+func TestWrap(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+	connect = func(context.Context) (*sql.DB, error) { return db, nil }
+	t.Cleanup(func() { connect = databaseutils.Connect })
+
+	result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`, `email`, `cognito_sub`) VALUES ('Ada', 'ada@myhunter.cuny.edu', 'sub-ada')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ada, _ := result.LastInsertId()
+	if _, err := db.Exec("INSERT INTO `CLUBS` (`id`, `club_name`) VALUES (3, 'GWC')"); err != nil {
+		t.Fatal(err)
+	}
+
+	loadClub := func(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, id int64) (any, error) {
+		var name string
+		err := q.QueryRowContext(ctx, "SELECT `club_name` FROM `CLUBS` WHERE `id` = ?", id).Scan(&name)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return map[string]string{"name": name}, err
+	}
+	rename := func(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		if evt.Body == "" {
+			return apiutils.Error(http.StatusBadRequest, "name is required")
+		}
+		if _, err := db.Exec("UPDATE `CLUBS` SET `club_name` = ? WHERE `id` = 3", evt.Body); err != nil {
+			return apiutils.Fail(err)
+		}
+		return apiutils.JSON(http.StatusOK, map[string]any{"id": 3})
+	}
+	create := func(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		result, err := db.Exec("INSERT INTO `CLUBS` (`club_name`) VALUES ('New')")
+		if err != nil {
+			return apiutils.Fail(err)
+		}
+		id, _ := result.LastInsertId()
+		return apiutils.JSON(http.StatusCreated, map[string]any{"id": id})
+	}
+	get := func(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		return apiutils.JSON(http.StatusOK, nil)
+	}
+
+	router := Wrap(apiutils.Router{
+		"GET /clubs/{clubId}":   get,
+		"PATCH /clubs/{clubId}": rename,
+		"POST /clubs":           create,
+		"DELETE /thing":         get,
+	}, map[string]Target{
+		"PATCH /clubs/{clubId}": {Entity: "club", Param: "clubId", Load: loadClub},
+		"POST /clubs":           {Entity: "club", Load: loadClub},
+	})
+
+	call := func(routeKey, body string) {
+		t.Helper()
+		evt := events.APIGatewayV2HTTPRequest{
+			RouteKey:       routeKey,
+			Body:           body,
+			PathParameters: map[string]string{"clubId": "3"},
+		}
+		evt.RequestContext.RequestID = "req-" + body
+		evt.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"sub": "sub-ada"}},
+		}
+		if _, err := router.Handle(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	call("GET /clubs/{clubId}", "")
+	call("PATCH /clubs/{clubId}", "")
+	call("PATCH /clubs/{clubId}", "Girls Who Code")
+	call("POST /clubs", "")
+	call("DELETE /thing", "")
+
+	entries, err := Entries(ctx, db, Filter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Entries = %d entries, want the rename, the create and the delete", len(entries))
+	}
+
+	deleted, created, renamed := entries[0], entries[1], entries[2]
+	if renamed.Action != "PATCH /clubs/{clubId}" || renamed.ActorID == nil || *renamed.ActorID != ada ||
+		*renamed.ActorSub != "sub-ada" || *renamed.RequestID != "req-Girls Who Code" || renamed.Status != http.StatusOK {
+		t.Errorf("rename = %+v", renamed)
+	}
+	var before, after map[string]string
+	if err := json.Unmarshal(renamed.Before, &before); err != nil || before["name"] != "GWC" {
+		t.Errorf("Before = %s, %v", renamed.Before, err)
+	}
+	if err := json.Unmarshal(renamed.After, &after); err != nil || after["name"] != "Girls Who Code" {
+		t.Errorf("After = %s, %v", renamed.After, err)
+	}
+	if created.EntityID == nil || created.Before != nil || created.After == nil || created.Status != http.StatusCreated {
+		t.Errorf("create = %+v, want the new id and no before", created)
+	}
+	if deleted.Entity != "thing" || deleted.EntityID != nil || deleted.Before != nil || deleted.After != nil {
+		t.Errorf("route without a target = %+v", deleted)
+	}
+
+	filtered, err := Entries(ctx, db, Filter{ActorID: ada, Entity: "club", EntityID: 3, From: time.Now().Add(-time.Hour), Limit: 10})
+	if err != nil || len(filtered) != 1 || filtered[0].ID != renamed.ID {
+		t.Errorf("filtered Entries = %v, %v, want the rename", filtered, err)
+	}
+	if none, err := Entries(ctx, db, Filter{To: time.Now().Add(-time.Hour), Limit: 10}); err != nil || len(none) != 0 {
+		t.Errorf("Entries before the calls = %v, %v, want none", none, err)
+	}
+}
@@ -0,0 +1,163 @@
+package auditutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	apiutils "cdk-infrastructure/utils/api"
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+	metricutils "cdk-infrastructure/utils/metrics"
+)
+
+// ParamMe is Target.Param for routes on the caller's own rows, like PATCH /students/me
+const ParamMe = "me"
+
+// FailureMetric counts the calls that went through without an audit entry
+const FailureMetric = "AuditWriteFailures"
+
+// connect is databaseutils.Connect, tests point it at their database
+var connect = databaseutils.Connect
+
+// LoadFunc reads the entity with the id as it's stored. It returns nil when there's
+// nothing there, other errors only mean the entry goes without that side.
+type LoadFunc func(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, id int64) (any, error)
+
+// Target is what a route changes
+type Target struct {
+	// Entity names what's changed, like "club", Entries can be filtered on it
+	Entity string
+	// Param is the path parameter with the entity's id, or ParamMe. Creates leave it
+	// empty, their id is the "id" of the response.
+	Param string
+	// Load is called before and after the handler for Entry.Before and After
+	Load LoadFunc
+}
+
+// Wrap audits every route of the router that isn't a GET. Each successful call adds
+// an AUDIT_LOG entry with its Target in targets, keyed by route key like the router.
+// Routes without one are logged under the first segment of their path with no id.
+//
+// The entry is written after the handler's own transaction, and Before and After
+// are read outside it, so they're what was stored just before and after the call
+// rather than what the handler saw. A failed write doesn't undo the call, it's logged
+// and counted in the AuditWriteFailures metric, which ApiStack alarms on.
+func Wrap(router apiutils.Router, targets map[string]Target) apiutils.Router {
+	wrapped := apiutils.Router{}
+	for routeKey, handler := range router {
+		method, path, _ := strings.Cut(routeKey, " ")
+		if method == http.MethodGet {
+			wrapped[routeKey] = handler
+			continue
+		}
+
+		target, ok := targets[routeKey]
+		if !ok {
+			target = Target{Entity: strings.Split(strings.TrimPrefix(path, "/"), "/")[0]}
+		}
+		wrapped[routeKey] = audited(routeKey, target, handler)
+	}
+	return wrapped
+}
+
+func audited(routeKey string, target Target, handler apiutils.HandlerFunc) apiutils.HandlerFunc {
+	return func(ctx context.Context, evt events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		db, err := connect(ctx)
+		if err != nil {
+			return apiutils.Fail(err)
+		}
+
+		entry := Entry{Action: routeKey, Entity: target.Entity}
+		if evt.RequestContext.RequestID != "" {
+			entry.RequestID = &evt.RequestContext.RequestID
+		}
+		// without a caller the handler answers 401 and there's nothing to record
+		if c, err := authutils.FromRequest(evt, authutils.NewSQLStore(db)); err == nil {
+			entry.ActorSub = &c.Subject
+			id, err := c.StudentID(ctx)
+			if err != nil && !errors.Is(err, authutils.ErrNoStudent) {
+				return apiutils.Fail(err)
+			}
+			if err == nil {
+				entry.ActorID = &id
+			}
+		}
+
+		entry.EntityID = target.id(evt, entry.ActorID)
+		entry.Before = target.load(ctx, db, evt, entry.EntityID)
+
+		resp, err := handler(ctx, evt)
+		if err != nil {
+			resp, err = apiutils.Fail(err)
+		}
+		if err != nil || resp.StatusCode >= 400 {
+			return resp, err
+		}
+
+		if entry.EntityID == nil && target.Param == "" {
+			entry.EntityID = responseID(resp)
+		}
+		entry.After = target.load(ctx, db, evt, entry.EntityID)
+		entry.Status = resp.StatusCode
+		if err := Record(ctx, db, &entry); err != nil {
+			log.Printf("failed to audit %s (request %s): %v", routeKey, evt.RequestContext.RequestID, err)
+			if err := metricutils.Emit(nil, map[string]float64{FailureMetric: 1}); err != nil {
+				log.Printf("failed to emit %s: %v", FailureMetric, err)
+			}
+		}
+		return resp, nil
+	}
+}
+
+// id is the entity's id from the path, nil for creates and bad ids the handler rejects
+func (t Target) id(evt events.APIGatewayV2HTTPRequest, actorID *int64) *int64 {
+	switch t.Param {
+	case "":
+		return nil
+	case ParamMe:
+		return actorID
+	}
+	id, err := strconv.ParseInt(evt.PathParameters[t.Param], 10, 64)
+	if err != nil || id <= 0 {
+		return nil
+	}
+	return &id
+}
+
+func (t Target) load(ctx context.Context, q databaseutils.Querier, evt events.APIGatewayV2HTTPRequest, id *int64) json.RawMessage {
+	if t.Load == nil || id == nil {
+		return nil
+	}
+	v, err := t.Load(ctx, q, evt, *id)
+	if err != nil {
+		log.Printf("failed to load %s %d for the audit log: %v", t.Entity, *id, err)
+		return nil
+	}
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("failed to marshal %s %d for the audit log: %v", t.Entity, *id, err)
+		return nil
+	}
+	return raw
+}
+
+// responseID reads the id of a created entity from the response
+func responseID(resp events.APIGatewayV2HTTPResponse) *int64 {
+	var body struct {
+		ID int64 `json:"id"`
+	}
+	if json.Unmarshal([]byte(resp.Body), &body) != nil || body.ID == 0 {
+		return nil
+	}
+	return &body.ID
+}
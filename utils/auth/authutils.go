@@ -0,0 +1,342 @@
+package authutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Role is a student's role in one club, CLUB_MEMBERS.role
+type Role string
+
+const (
+	RoleMember Role = "member"
+	RoleEboard Role = "eboard"
+)
+
+// user pool groups, see AuthStack
+const (
+	GroupAdmin  = "admin"
+	GroupEboard = "eboard"
+	GroupMember = "member"
+)
+
+var (
+	// ErrUnauthenticated means the request had no verified token, should be a 401
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden means the caller failed a check, should be a 403
+	ErrForbidden = errors.New("not allowed")
+	// ErrNoStudent means the caller's account isn't linked to a STUDENTS row yet
+	ErrNoStudent = errors.New("no student is linked to this account")
+)
+
+// Store loads what the checks need to know about a caller. SQLStore is the real one,
+// tests use a fake.
+type Store interface {
+	// StudentIDBySubject returns ErrNoStudent when no student has the cognito sub
+	StudentIDBySubject(ctx context.Context, sub string) (int64, error)
+	// ClubRoles maps club id to the student's role in it
+	ClubRoles(ctx context.Context, studentID int64) (map[int64]Role, error)
+	// EventClubIDs returns the clubs hosting an event, EVENTS_TO_CLUBS
+	EventClubIDs(ctx context.Context, eventID int64) ([]int64, error)
+}
+
+// Caller is whoever made the request. The student id and club roles are only loaded
+// from the store the first time a check needs them.
+type Caller struct {
+	Subject string
+	Email   string
+	Groups  []string
+
+	store     Store
+	studentID int64
+	roles     map[int64]Role
+}
+
+// FromRequest reads the caller from the claims the JWT authorizer verified. It returns
+// ErrUnauthenticated for routes without the authorizer or requests without a token.
+func FromRequest(evt events.APIGatewayV2HTTPRequest, store Store) (*Caller, error) {
+	if evt.RequestContext.Authorizer == nil || evt.RequestContext.Authorizer.JWT == nil {
+		return nil, ErrUnauthenticated
+	}
+
+	claims := evt.RequestContext.Authorizer.JWT.Claims
+	if claims["sub"] == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	return &Caller{
+		Subject: claims["sub"],
+		Email:   claims["email"],
+		Groups:  parseGroups(claims["cognito:groups"]),
+		store:   store,
+	}, nil
+}
+
+// parseGroups reads cognito:groups, which API Gateway flattens from a JSON array
+// into a string like "[admin eboard]"
+func parseGroups(claim string) []string {
+	claim = strings.Trim(claim, "[]")
+	return strings.FieldsFunc(claim, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '"'
+	})
+}
+
+// InGroup reports whether the caller is in the cognito group
+func (c *Caller) InGroup(group string) bool {
+	for _, g := range c.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the caller is in the admin group
+func (c *Caller) IsAdmin() bool {
+	return c.InGroup(GroupAdmin)
+}
+
+// StudentID returns the id of the caller's STUDENTS row
+func (c *Caller) StudentID(ctx context.Context) (int64, error) {
+	if c.studentID != 0 {
+		return c.studentID, nil
+	}
+	if c.store == nil {
+		return 0, errors.New("authutils: caller has no store to load the student from")
+	}
+
+	id, err := c.store.StudentIDBySubject(ctx, c.Subject)
+	if err != nil {
+		return 0, err
+	}
+	c.studentID = id
+	return id, nil
+}
+
+// Roles returns the caller's role in every club they're part of, keyed by club id
+func (c *Caller) Roles(ctx context.Context) (map[int64]Role, error) {
+	if c.roles != nil {
+		return c.roles, nil
+	}
+
+	studentID, err := c.StudentID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := c.store.ClubRoles(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if roles == nil {
+		roles = map[int64]Role{}
+	}
+	c.roles = roles
+	return roles, nil
+}
+
+// Require returns nil if the caller passes every check, ErrForbidden if one fails, or
+// the error a check ran into. Admins pass every check.
+func (c *Caller) Require(ctx context.Context, checks ...Check) error {
+	if c.IsAdmin() {
+		return nil
+	}
+
+	for _, check := range checks {
+		ok, err := check(ctx, c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// Can is Require for optional extras, like showing drafts to eboard members, it reports
+// whether the caller passes instead of returning ErrForbidden
+func (c *Caller) Can(ctx context.Context, checks ...Check) (bool, error) {
+	err := c.Require(ctx, checks...)
+	if errors.Is(err, ErrForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Check is one condition on the caller, combine them with AnyOf and pass them to Require.
+type Check func(ctx context.Context, c *Caller) (bool, error)
+
+// Authenticated passes for any caller, for routes that only need a signed in user
+func Authenticated() Check {
+	return func(ctx context.Context, c *Caller) (bool, error) {
+		return true, nil
+	}
+}
+
+// Admin passes for callers in the admin group
+func Admin() Check {
+	return Group(GroupAdmin)
+}
+
+// Group passes for callers in the cognito group
+func Group(group string) Check {
+	return func(ctx context.Context, c *Caller) (bool, error) {
+		return c.InGroup(group), nil
+	}
+}
+
+// Self passes when the caller is the student
+func Self(studentID int64) Check {
+	return func(ctx context.Context, c *Caller) (bool, error) {
+		id, err := c.StudentID(ctx)
+		if errors.Is(err, ErrNoStudent) {
+			return false, nil
+		}
+		return id == studentID, err
+	}
+}
+
+// MemberOf passes for members and eboard of the club
+func MemberOf(clubID int64) Check {
+	return hasRole(func(roles map[int64]Role) bool {
+		_, ok := roles[clubID]
+		return ok
+	})
+}
+
+// EboardOf passes for eboard members of the club
+func EboardOf(clubID int64) Check {
+	return hasRole(func(roles map[int64]Role) bool {
+		return roles[clubID] == RoleEboard
+	})
+}
+
+// EboardOfAnyClub passes for students on the eboard of at least one club
+func EboardOfAnyClub() Check {
+	return hasRole(func(roles map[int64]Role) bool {
+		for _, role := range roles {
+			if role == RoleEboard {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// EboardOfEventHost passes for eboard members of any club hosting the event
+func EboardOfEventHost(eventID int64) Check {
+	return func(ctx context.Context, c *Caller) (bool, error) {
+		roles, err := c.Roles(ctx)
+		if errors.Is(err, ErrNoStudent) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		clubIDs, err := c.store.EventClubIDs(ctx, eventID)
+		if err != nil {
+			return false, err
+		}
+		for _, clubID := range clubIDs {
+			if roles[clubID] == RoleEboard {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// AnyOf passes when at least one of the checks does
+func AnyOf(checks ...Check) Check {
+	return func(ctx context.Context, c *Caller) (bool, error) {
+		for _, check := range checks {
+			ok, err := check(ctx, c)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// hasRole loads the caller's roles and passes them to match, callers without a
+// student row have no roles
+func hasRole(match func(roles map[int64]Role) bool) Check {
+	return func(ctx context.Context, c *Caller) (bool, error) {
+		roles, err := c.Roles(ctx)
+		if errors.Is(err, ErrNoStudent) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return match(roles), nil
+	}
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLStore reads callers from the club database
+type SQLStore struct {
+	db Querier
+}
+
+func NewSQLStore(db Querier) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) StudentIDBySubject(ctx context.Context, sub string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, "SELECT `id` FROM `STUDENTS` WHERE `cognito_sub` = ?", sub).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoStudent
+	}
+	return id, err
+}
+
+func (s *SQLStore) ClubRoles(ctx context.Context, studentID int64) (map[int64]Role, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT `club_id`, `role` FROM `CLUB_MEMBERS` WHERE `student_id` = ?", studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := map[int64]Role{}
+	for rows.Next() {
+		var clubID int64
+		var role Role
+		if err := rows.Scan(&clubID, &role); err != nil {
+			return nil, err
+		}
+		roles[clubID] = role
+	}
+	return roles, rows.Err()
+}
+
+func (s *SQLStore) EventClubIDs(ctx context.Context, eventID int64) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT `club_id` FROM `EVENTS_TO_CLUBS` WHERE `event_id` = ?", eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clubIDs []int64
+	for rows.Next() {
+		var clubID int64
+		if err := rows.Scan(&clubID); err != nil {
+			return nil, err
+		}
+		clubIDs = append(clubIDs, clubID)
+	}
+	return clubIDs, rows.Err()
+}
@@ -0,0 +1,245 @@
+package authutils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// fakeStore is an in memory Store that counts how often it's asked for things
+type fakeStore struct {
+	students map[string]int64         // cognito sub -> student id
+	roles    map[int64]map[int64]Role // student id -> club id -> role
+	hosts    map[int64][]int64        // event id -> club ids
+	calls    map[string]int
+	err      error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		students: map[string]int64{
+			"sub-member": 1,
+			"sub-eboard": 2,
+			"sub-admin":  3,
+		},
+		roles: map[int64]map[int64]Role{
+			1: {10: RoleMember},
+			2: {10: RoleMember, 20: RoleEboard},
+		},
+		hosts: map[int64][]int64{
+			100: {10},     // hosted by club 10 only
+			200: {10, 20}, // co-hosted
+		},
+		calls: map[string]int{},
+	}
+}
+
+func (f *fakeStore) StudentIDBySubject(ctx context.Context, sub string) (int64, error) {
+	f.calls["student"]++
+	if f.err != nil {
+		return 0, f.err
+	}
+	id, ok := f.students[sub]
+	if !ok {
+		return 0, ErrNoStudent
+	}
+	return id, nil
+}
+
+func (f *fakeStore) ClubRoles(ctx context.Context, studentID int64) (map[int64]Role, error) {
+	f.calls["roles"]++
+	return f.roles[studentID], f.err
+}
+
+func (f *fakeStore) EventClubIDs(ctx context.Context, eventID int64) ([]int64, error) {
+	f.calls["hosts"]++
+	return f.hosts[eventID], f.err
+}
+
+func request(claims map[string]string) events.APIGatewayV2HTTPRequest {
+	var evt events.APIGatewayV2HTTPRequest
+	evt.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: claims},
+	}
+	return evt
+}
+
+func caller(t *testing.T, store Store, sub string, groups string) *Caller {
+	t.Helper()
+	c, err := FromRequest(request(map[string]string{"sub": sub, "cognito:groups": groups}), store)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	return c
+}
+
+func TestFromRequest(t *testing.T) {
+	c, err := FromRequest(request(map[string]string{
+		"sub":            "sub-eboard",
+		"email":          "someone@myhunter.cuny.edu",
+		"cognito:groups": "[eboard member]",
+	}), nil)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+
+	if c.Subject != "sub-eboard" || c.Email != "someone@myhunter.cuny.edu" {
+		t.Errorf("got subject %q email %q", c.Subject, c.Email)
+	}
+	if want := []string{"eboard", "member"}; !reflect.DeepEqual(c.Groups, want) {
+		t.Errorf("groups = %v, want %v", c.Groups, want)
+	}
+	if !c.InGroup(GroupEboard) || c.IsAdmin() {
+		t.Errorf("InGroup(eboard) = %v, IsAdmin() = %v", c.InGroup(GroupEboard), c.IsAdmin())
+	}
+}
+
+func TestFromRequestUnauthenticated(t *testing.T) {
+	tests := map[string]events.APIGatewayV2HTTPRequest{
+		"no authorizer": {},
+		"no sub":        request(map[string]string{"email": "someone@myhunter.cuny.edu"}),
+	}
+
+	for name, evt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := FromRequest(evt, nil); !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("err = %v, want ErrUnauthenticated", err)
+			}
+		})
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	tests := map[string][]string{
+		"":                   {},
+		"[]":                 {},
+		"[admin]":            {"admin"},
+		"[admin eboard]":     {"admin", "eboard"},
+		`["admin","eboard"]`: {"admin", "eboard"},
+		"[member, eboard]":   {"member", "eboard"},
+	}
+
+	for claim, want := range tests {
+		got := parseGroups(claim)
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseGroups(%q) = %v, want %v", claim, got, want)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		name   string
+		sub    string
+		groups string
+		check  Check
+		want   error
+	}{
+		{"authenticated", "sub-member", "", Authenticated(), nil},
+		{"admin group", "sub-member", "", Admin(), ErrForbidden},
+		{"admin passes everything", "sub-admin", "[admin]", EboardOf(10), nil},
+		{"group from token", "sub-eboard", "[eboard]", Group(GroupEboard), nil},
+
+		{"self", "sub-member", "", Self(1), nil},
+		{"someone else", "sub-member", "", Self(2), ErrForbidden},
+		{"self without student", "sub-unlinked", "", Self(1), ErrForbidden},
+
+		{"member of club", "sub-member", "", MemberOf(10), nil},
+		{"eboard is a member too", "sub-eboard", "", MemberOf(20), nil},
+		{"not a member", "sub-member", "", MemberOf(20), ErrForbidden},
+		{"member is not eboard", "sub-member", "", EboardOf(10), ErrForbidden},
+		{"eboard of club", "sub-eboard", "", EboardOf(20), nil},
+		{"eboard of any club", "sub-eboard", "", EboardOfAnyClub(), nil},
+		{"member of any club", "sub-member", "", EboardOfAnyClub(), ErrForbidden},
+		{"unlinked has no roles", "sub-unlinked", "", MemberOf(10), ErrForbidden},
+
+		{"eboard of cohost", "sub-eboard", "", EboardOfEventHost(200), nil},
+		{"eboard of other club", "sub-eboard", "", EboardOfEventHost(100), ErrForbidden},
+		{"member of host", "sub-member", "", EboardOfEventHost(100), ErrForbidden},
+		{"event without hosts", "sub-eboard", "", EboardOfEventHost(300), ErrForbidden},
+
+		{"any of", "sub-member", "", AnyOf(EboardOf(10), Self(1)), nil},
+		{"none of", "sub-member", "", AnyOf(EboardOf(10), Self(2)), ErrForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := caller(t, newFakeStore(), test.sub, test.groups)
+			if err := c.Require(context.Background(), test.check); !errors.Is(err, test.want) {
+				t.Errorf("Require = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestRequireAllChecks(t *testing.T) {
+	c := caller(t, newFakeStore(), "sub-eboard", "")
+
+	if err := c.Require(context.Background(), EboardOf(20), MemberOf(10)); err != nil {
+		t.Errorf("Require(eboard 20, member 10) = %v, want nil", err)
+	}
+	if err := c.Require(context.Background(), EboardOf(20), EboardOf(10)); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Require(eboard 20, eboard 10) = %v, want ErrForbidden", err)
+	}
+}
+
+func TestRequireStoreError(t *testing.T) {
+	store := newFakeStore()
+	store.err = errors.New("connection refused")
+	c := caller(t, store, "sub-eboard", "")
+
+	err := c.Require(context.Background(), EboardOf(20))
+	if !errors.Is(err, store.err) {
+		t.Errorf("Require = %v, want the store's error", err)
+	}
+}
+
+func TestCan(t *testing.T) {
+	ctx := context.Background()
+
+	if ok, err := caller(t, newFakeStore(), "sub-eboard", "").Can(ctx, EboardOf(20)); !ok || err != nil {
+		t.Errorf("Can(eboard 20) = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := caller(t, newFakeStore(), "sub-member", "").Can(ctx, EboardOf(20)); ok || err != nil {
+		t.Errorf("Can(eboard 20) for a member = %v, %v, want false, nil", ok, err)
+	}
+
+	store := newFakeStore()
+	store.err = errors.New("connection refused")
+	if _, err := caller(t, store, "sub-eboard", "").Can(ctx, EboardOf(20)); !errors.Is(err, store.err) {
+		t.Errorf("Can = %v, want the store's error", err)
+	}
+}
+
+func TestCallerCachesLookups(t *testing.T) {
+	store := newFakeStore()
+	c := caller(t, store, "sub-eboard", "")
+	ctx := context.Background()
+
+	for range 3 {
+		if err := c.Require(ctx, MemberOf(10), EboardOf(20), EboardOfEventHost(200)); err != nil {
+			t.Fatalf("Require = %v", err)
+		}
+	}
+
+	if store.calls["student"] != 1 || store.calls["roles"] != 1 {
+		t.Errorf("store calls = %v, want the student and roles loaded once", store.calls)
+	}
+}
+
+func TestChecksWithoutStore(t *testing.T) {
+	c := caller(t, nil, "sub-member", "")
+
+	if err := c.Require(context.Background(), Authenticated()); err != nil {
+		t.Errorf("Require(Authenticated) = %v, want nil", err)
+	}
+	if err := c.Require(context.Background(), MemberOf(10)); err == nil {
+		t.Errorf("Require(MemberOf) without a store should fail")
+	}
+}
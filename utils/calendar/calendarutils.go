@@ -0,0 +1,160 @@
+package calendarutils
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+)
+
+// Feeds are built from EVENT_VERSIONS so a calendar only ever sees what was posted.
+// An event shows up once it has a posted version, with the fields of the latest one.
+// When it's deleted or taken back to a draft it stays in the feed as cancelled, so
+// calendars that already have it remove it instead of keeping a stale copy.
+
+// History is how long events stay in a feed after they've ended
+const History = 90 * 24 * time.Hour
+
+// Entry is one event in a feed
+type Entry struct {
+	EventID int64
+	// Fields are the latest posted version's
+	eventutils.Fields
+	// Created is when the event was first posted, Updated when its latest version was made
+	Created, Updated time.Time
+	// Sequence counts the versions since the event was first posted, so every change
+	// (including a cancellation) is newer to calendars than the last
+	Sequence  int
+	Cancelled bool
+	// Tentative is set in a student's feed for maybe and waitlisted RSVPs
+	Tentative bool
+}
+
+// ClubEntries lists the posted events the club hosts or co-hosts that haven't ended
+// before from, soonest first
+func ClubEntries(ctx context.Context, q databaseutils.Querier, clubID int64, from time.Time) ([]*Entry, error) {
+	return entries(ctx, q,
+		"EXISTS (SELECT 1 FROM `EVENTS_TO_CLUBS` ec WHERE ec.`event_id` = e.`id` AND ec.`club_id` = ?)",
+		[]any{clubID}, from,
+	)
+}
+
+// StudentEntries lists the posted events the student is going to or might go to that
+// haven't ended before from, soonest first
+func StudentEntries(ctx context.Context, q databaseutils.Querier, studentID int64, from time.Time) ([]*Entry, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT `event_id`, `status` = 'maybe' OR `waitlisted` FROM `EVENT_RSVPS` "+
+			"WHERE `student_id` = ? AND `status` IN ('going', 'maybe')",
+		studentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tentative := map[int64]bool{}
+	for rows.Next() {
+		var eventID int64
+		var maybe bool
+		if err := rows.Scan(&eventID, &maybe); err != nil {
+			return nil, err
+		}
+		tentative[eventID] = maybe
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	feed, err := entries(ctx, q,
+		"EXISTS (SELECT 1 FROM `EVENT_RSVPS` r WHERE r.`event_id` = e.`id` AND r.`student_id` = ? "+
+			"AND r.`status` IN ('going', 'maybe'))",
+		[]any{studentID}, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range feed {
+		entry.Tentative = tentative[entry.EventID]
+	}
+	return feed, nil
+}
+
+// entries builds the feed of the events matching where. Every version of those events
+// is read, the feed is small and the versions are what SEQUENCE is counted from.
+func entries(ctx context.Context, q databaseutils.Querier, where string, args []any, from time.Time) ([]*Entry, error) {
+	args = append(args, from.UTC())
+	rows, err := q.QueryContext(ctx,
+		"SELECT v.`event_id`, v.`type`, v.`timestamp`, v.`event_name`, v.`event_img`, v.`event_status`, "+
+			"v.`event_date`, v.`event_end`, v.`location`, v.`description` "+
+			"FROM `EVENT_VERSIONS` v JOIN `EVENTS` e ON e.`id` = v.`event_id` "+
+			"WHERE "+where+" AND EXISTS (SELECT 1 FROM `EVENT_VERSIONS` p WHERE p.`event_id` = e.`id` "+
+			"AND p.`type` <> 'delete' AND p.`event_status` = 'posted' AND COALESCE(p.`event_end`, p.`event_date`) >= ?) "+
+			"ORDER BY v.`event_id`, v.`id`",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feed := []*Entry{}
+	var entry *Entry
+	for rows.Next() {
+		var v eventutils.Version
+		err := rows.Scan(&v.EventID, &v.Type, &v.Timestamp, &v.Name, &v.Image, &v.Status,
+			&v.Start, &v.End, &v.Location, &v.Description)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry == nil || entry.EventID != v.EventID {
+			entry = &Entry{EventID: v.EventID}
+			feed = append(feed, entry)
+		}
+		apply(entry, &v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	upcoming := []*Entry{}
+	for _, entry := range feed {
+		if entry.Created.IsZero() || end(entry).Before(from) {
+			continue // never posted, or posted long ago and changed since
+		}
+		upcoming = append(upcoming, entry)
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].Start.Before(*upcoming[j].Start)
+	})
+	return upcoming, nil
+}
+
+// apply adds the next version of the event to its entry
+func apply(entry *Entry, v *eventutils.Version) {
+	posted := v.Type != eventutils.TypeDelete && v.Status == eventutils.StatusPosted
+	if entry.Created.IsZero() {
+		if !posted {
+			return // drafts before the first post were never in a feed
+		}
+		entry.Created = v.Timestamp
+	} else {
+		entry.Sequence++
+	}
+
+	entry.Updated = v.Timestamp
+	entry.Cancelled = !posted
+	if posted {
+		entry.Fields = v.Fields
+	}
+}
+
+// end is when the entry's event is over, its start when it has no end
+func end(entry *Entry) time.Time {
+	if entry.End != nil {
+		return *entry.End
+	}
+	return *entry.Start
+}
@@ -0,0 +1,206 @@
+package calendarutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+	eventutils "cdk-infrastructure/utils/events"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestICS(t *testing.T) {
+	// 6pm in New York on both sides of the November change
+	summer := time.Date(2026, 10, 30, 22, 0, 0, 0, time.UTC)
+	winter := time.Date(2026, 11, 6, 23, 0, 0, 0, time.UTC)
+	stamp := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	ics := Calendar{Name: "Girls Who Code", Entries: []*Entry{
+		{
+			EventID: 7,
+			Fields: eventutils.Fields{
+				Name:        strPtr("Intro to Go; bring a laptop, charger"),
+				Start:       &summer,
+				Description: strPtr("Line one\nLine two " + strings.Repeat("é", 40)),
+			},
+			Created: stamp, Updated: stamp, Sequence: 2,
+		},
+		{EventID: 8, Fields: eventutils.Fields{Name: strPtr("Hack night"), Start: &winter}, Created: stamp, Updated: stamp, Cancelled: true},
+	}}.ICS()
+
+	for _, want := range []string{
+		"UID:event-7@club-event-api\r\n",
+		"SEQUENCE:2\r\nSTATUS:CONFIRMED\r\n",
+		"DTSTART;TZID=America/New_York:20261030T180000\r\nDTEND;TZID=America/New_York:20261030T190000\r\n",
+		`SUMMARY:Intro to Go\; bring a laptop\, charger` + "\r\n",
+		"STATUS:CANCELLED\r\n",
+		"DTSTART;TZID=America/New_York:20261106T180000\r\n",
+		"DTSTAMP:20261001T120000Z\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("ICS is missing %q:\n%s", want, ics)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is %d octets: %q", len(line), line)
+		}
+		if strings.ContainsRune(line, '\n') {
+			t.Errorf("bare newline in %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	if !strings.Contains(unfolded, `DESCRIPTION:Line one\nLine two `+strings.Repeat("é", 40)+"\r\n") {
+		t.Errorf("description didn't unfold back to itself:\n%s", unfolded)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	token := Sign(testKey, 42, 3)
+	studentID, version, err := Verify(testKey, token)
+	if err != nil || studentID != 42 || version != 3 {
+		t.Fatalf("Verify = %d, %d, %v, want 42, 3, nil", studentID, version, err)
+	}
+
+	payload, _, _ := strings.Cut(token, ".")
+	_, signature, _ := strings.Cut(Sign(testKey, 43, 3), ".")
+	for _, bad := range []string{"", "no-dot", payload + ".", payload + "." + signature, token + "x"} {
+		if _, _, err := Verify(testKey, bad); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify(%q) = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+	if _, _, err := Verify([]byte("another key, another key, another"), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify with another key = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestResetToken(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`, `email`) VALUES ('Ada', 'ada@myhunter.cuny.edu')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ada, _ := result.LastInsertId()
+
+	// tokens from before versions have none, which is version 0
+	old := Sign(testKey, ada, 0)
+	if studentID, err := Authorize(ctx, db, testKey, old); err != nil || studentID != ada {
+		t.Fatalf("Authorize = %d, %v, want %d", studentID, err, ada)
+	}
+
+	version, err := ResetToken(ctx, db, ada)
+	if err != nil || version != 1 {
+		t.Fatalf("ResetToken = %d, %v, want 1", version, err)
+	}
+	if _, err := Authorize(ctx, db, testKey, old); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authorize after reset = %v, want ErrInvalidToken", err)
+	}
+	if studentID, err := Authorize(ctx, db, testKey, Sign(testKey, ada, version)); err != nil || studentID != ada {
+		t.Errorf("Authorize new token = %d, %v, want %d", studentID, err, ada)
+	}
+	if _, err := Authorize(ctx, db, testKey, Sign(testKey, ada+100, 0)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authorize for a missing student = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	result, err := db.Exec("INSERT INTO `CLUBS` (`club_name`) VALUES ('Girls Who Code')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clubID, _ := result.LastInsertId()
+	result, err = db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES ('Ada')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	studentID, _ := result.LastInsertId()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	start := now.Add(48 * time.Hour)
+	var eventID int64
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := eventutils.Create(ctx, tx, studentID, []int64{clubID}, eventutils.Fields{
+			Name: strPtr("Intro to Go"), Status: eventutils.StatusDrafted, Start: &start,
+		})
+		eventID = event.ID
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO `EVENT_RSVPS` (`event_id`, `student_id`, `status`, `waitlisted`, `responded_at`) "+
+		"VALUES (?, ?, 'maybe', FALSE, ?)", eventID, studentID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendVersion := func(versionType eventutils.VersionType, change func(*eventutils.Fields)) {
+		t.Helper()
+		err := databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			event, err := eventutils.Lock(ctx, tx, eventID)
+			if err != nil {
+				return err
+			}
+			fields := event.Current.Fields
+			change(&fields)
+			_, err = eventutils.Append(ctx, tx, event, studentID, versionType, nil, fields)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	clubFeed := func() []*Entry {
+		t.Helper()
+		feed, err := ClubEntries(ctx, db, clubID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return feed
+	}
+
+	if feed := clubFeed(); len(feed) != 0 {
+		t.Fatalf("draft is in the feed: %+v", feed[0])
+	}
+
+	appendVersion(eventutils.TypeEdit, func(f *eventutils.Fields) { f.Status = eventutils.StatusPosted })
+	appendVersion(eventutils.TypeEdit, func(f *eventutils.Fields) { f.Name = strPtr("Intro to Go, part 1") })
+	feed := clubFeed()
+	if len(feed) != 1 || feed[0].Sequence != 1 || feed[0].Cancelled || *feed[0].Name != "Intro to Go, part 1" {
+		t.Fatalf("after posting and renaming, feed = %+v", feed)
+	}
+
+	appendVersion(eventutils.TypeDelete, func(f *eventutils.Fields) { f.Name = nil })
+	feed = clubFeed()
+	if len(feed) != 1 || feed[0].Sequence != 2 || !feed[0].Cancelled || *feed[0].Name != "Intro to Go, part 1" {
+		t.Fatalf("after deleting, feed = %+v", feed)
+	}
+
+	mine, err := StudentEntries(ctx, db, studentID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 1 || mine[0].EventID != eventID || !mine[0].Tentative || !mine[0].Cancelled {
+		t.Fatalf("student feed = %+v", mine)
+	}
+
+	if later, err := ClubEntries(ctx, db, clubID, start.Add(2*time.Hour)); err != nil || len(later) != 0 {
+		t.Errorf("feed after the event ended = %+v, %v, want nothing", later, err)
+	}
+}
@@ -0,0 +1,158 @@
+package calendarutils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// lambdas run on images without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// Zone is where events happen. Times are stored in UTC and written in this zone so
+// calendars keep them at the same wall clock time across daylight saving changes.
+const Zone = "America/New_York"
+
+// Location is Zone loaded, for the other packages that write times in it
+var Location = mustLoadLocation(Zone)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// vtimezone describes Zone, the US rules that have applied since 2007
+const vtimezone = "BEGIN:VTIMEZONE\r\n" +
+	"TZID:" + Zone + "\r\n" +
+	"BEGIN:DAYLIGHT\r\n" +
+	"TZOFFSETFROM:-0500\r\n" +
+	"TZOFFSETTO:-0400\r\n" +
+	"TZNAME:EDT\r\n" +
+	"DTSTART:20070311T020000\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\n" +
+	"END:DAYLIGHT\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"TZOFFSETFROM:-0400\r\n" +
+	"TZOFFSETTO:-0500\r\n" +
+	"TZNAME:EST\r\n" +
+	"DTSTART:20071104T020000\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n"
+
+const (
+	// uidDomain makes the UIDs unique beyond this api, see RFC 5545 3.8.4.7
+	uidDomain = "club-event-api"
+	// defaultDuration is used for events without an end
+	defaultDuration = time.Hour
+	// refreshInterval is how often calendar apps are asked to fetch the feed again
+	refreshInterval = "PT1H"
+)
+
+// Calendar is an iCalendar (RFC 5545) feed
+type Calendar struct {
+	Name    string
+	Entries []*Entry
+}
+
+// ICS writes the calendar as a text/calendar document
+func (c Calendar) ICS() string {
+	var b strings.Builder
+	w := func(name, value string) {
+		b.WriteString(fold(name + ":" + value))
+	}
+
+	w("BEGIN", "VCALENDAR")
+	w("VERSION", "2.0")
+	w("PRODID", "-//ClubEventApi//Calendar feeds//EN")
+	w("CALSCALE", "GREGORIAN")
+	w("METHOD", "PUBLISH")
+	w("X-WR-CALNAME", escape(c.Name))
+	w("X-WR-TIMEZONE", Zone)
+	w("REFRESH-INTERVAL;VALUE=DURATION", refreshInterval)
+	w("X-PUBLISHED-TTL", refreshInterval)
+	b.WriteString(vtimezone)
+
+	for _, entry := range c.Entries {
+		start := *entry.Start
+		end := start.Add(defaultDuration)
+		if entry.End != nil {
+			end = *entry.End
+		}
+
+		status := "CONFIRMED"
+		switch {
+		case entry.Cancelled:
+			status = "CANCELLED"
+		case entry.Tentative:
+			status = "TENTATIVE"
+		}
+
+		w("BEGIN", "VEVENT")
+		w("UID", fmt.Sprintf("event-%d@%s", entry.EventID, uidDomain))
+		w("DTSTAMP", utc(entry.Updated))
+		w("CREATED", utc(entry.Created))
+		w("LAST-MODIFIED", utc(entry.Updated))
+		w("SEQUENCE", fmt.Sprint(entry.Sequence))
+		w("STATUS", status)
+		w("DTSTART;TZID="+Zone, local(start))
+		w("DTEND;TZID="+Zone, local(end))
+		w("SUMMARY", escape(deref(entry.Name)))
+		if entry.Location != nil {
+			w("LOCATION", escape(*entry.Location))
+		}
+		if entry.Description != nil {
+			w("DESCRIPTION", escape(*entry.Description))
+		}
+		w("END", "VEVENT")
+	}
+
+	w("END", "VCALENDAR")
+	return b.String()
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func local(t time.Time) string {
+	return t.In(Location).Format("20060102T150405")
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape makes text safe for a TEXT property value
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// fold ends the content line with CRLF, breaking it so no line is longer than 75
+// octets. Continuation lines start with a space and UTF-8 characters aren't split.
+func fold(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package calendarutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	tokenutils "cdk-infrastructure/utils/token"
+)
+
+// A student's feed is fetched by calendar apps, which can't sign in, so its URL holds
+// a token naming the student signed with a key only the api knows (see tokenutils).
+// Tokens don't expire, subscriptions are meant to keep working. Each one carries the
+// student's STUDENTS.calendar_token_version, ResetToken bumps it so a leaked URL stops
+// working. Rotating the key cuts off every feed.
+
+var ErrInvalidToken = errors.New("invalid calendar token")
+
+type payload struct {
+	StudentID int64 `json:"s"`
+	// Version is 0 in tokens from before versions, which is also where they start
+	Version int64 `json:"v,omitempty"`
+}
+
+// Sign returns the token for the student's feed at the token version
+func Sign(key []byte, studentID, version int64) string {
+	return tokenutils.Sign(key, payload{StudentID: studentID, Version: version})
+}
+
+// Verify checks the token's signature and returns the student and token version it's
+// for. Whether the version is still current is up to Authorize.
+func Verify(key []byte, token string) (studentID, version int64, err error) {
+	var p payload
+	if err := tokenutils.Verify(key, token, &p); err != nil || p.StudentID <= 0 {
+		return 0, 0, ErrInvalidToken
+	}
+	return p.StudentID, p.Version, nil
+}
+
+// Authorize returns the student whose feed the token is for, ErrInvalidToken if it
+// isn't signed or has been reset since
+func Authorize(ctx context.Context, q databaseutils.Querier, key []byte, token string) (int64, error) {
+	studentID, version, err := Verify(key, token)
+	if err != nil {
+		return 0, err
+	}
+	current, err := TokenVersion(ctx, q, studentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if current != version {
+		return 0, ErrInvalidToken
+	}
+	return studentID, nil
+}
+
+// TokenVersion is the version the student's feed tokens are signed with
+func TokenVersion(ctx context.Context, q databaseutils.Querier, studentID int64) (int64, error) {
+	var version int64
+	err := q.QueryRowContext(ctx,
+		"SELECT `calendar_token_version` FROM `STUDENTS` WHERE `id` = ?", studentID,
+	).Scan(&version)
+	return version, err
+}
+
+// ResetToken revokes every feed url the student was given and returns the version
+// the new one is signed with
+func ResetToken(ctx context.Context, q databaseutils.Querier, studentID int64) (int64, error) {
+	_, err := q.ExecContext(ctx,
+		"UPDATE `STUDENTS` SET `calendar_token_version` = `calendar_token_version` + 1 WHERE `id` = ?", studentID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return TokenVersion(ctx, q, studentID)
+}
+
+var key = tokenutils.NewKey("CALENDAR_SECRET_ARN")
+
+// Key loads the signing key from the secret in CALENDAR_SECRET_ARN
+func Key(ctx context.Context) ([]byte, error) {
+	return key.Load(ctx)
+}
@@ -0,0 +1,122 @@
+package checkinutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+type CheckIn struct {
+	EventID      int64     `json:"eventId"`
+	StudentID    int64     `json:"studentId"`
+	CheckedInAt  time.Time `json:"checkedInAt"`
+	PointsEarned *int64    `json:"pointsEarned"`
+
+	// AlreadyCheckedIn is set when the student scanned the code before, nothing is awarded again
+	AlreadyCheckedIn bool `json:"alreadyCheckedIn"`
+}
+
+// Record checks the student in and awards the event's point source the first time.
+// The event has to have been loaded with eventutils.Lock so the check-in and the award
+// happen together or not at all.
+func Record(ctx context.Context, q databaseutils.Querier, event *eventutils.Event, studentID int64) (*CheckIn, error) {
+	existing, err := get(ctx, q, event.ID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.AlreadyCheckedIn = true
+		return existing, nil
+	}
+
+	checkIn := CheckIn{EventID: event.ID, StudentID: studentID, CheckedInAt: time.Now().UTC().Truncate(time.Second)}
+	if event.PointSourceID != nil {
+		key := fmt.Sprintf("checkin:%d:%d", event.ID, studentID)
+		entry, _, err := pointutils.Award(ctx, q, studentID, *event.PointSourceID, key)
+		if err != nil {
+			return nil, err
+		}
+		checkIn.PointsEarned = &entry.Points
+	}
+
+	// the primary key makes a second check-in fail even if the event lock was skipped
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO `EVENT_CHECKINS` (`event_id`, `student_id`, `checked_in_at`, `points_earned`) VALUES (?, ?, ?, ?)",
+		checkIn.EventID, checkIn.StudentID, checkIn.CheckedInAt, checkIn.PointsEarned,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &checkIn, nil
+}
+
+func get(ctx context.Context, q databaseutils.Querier, eventID, studentID int64) (*CheckIn, error) {
+	checkIn := CheckIn{EventID: eventID, StudentID: studentID}
+	err := q.QueryRowContext(ctx,
+		"SELECT `checked_in_at`, `points_earned` FROM `EVENT_CHECKINS` WHERE `event_id` = ? AND `student_id` = ?",
+		eventID, studentID,
+	).Scan(&checkIn.CheckedInAt, &checkIn.PointsEarned)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkIn, nil
+}
+
+type Attendance struct {
+	StudentID    int64     `json:"studentId"`
+	FirstName    *string   `json:"firstName"`
+	LastName     *string   `json:"lastName"`
+	Email        *string   `json:"email"`
+	CheckedInAt  time.Time `json:"checkedInAt"`
+	PointsEarned *int64    `json:"pointsEarned"`
+}
+
+// List returns everyone who checked in to the event, in the order they arrived
+func List(ctx context.Context, q databaseutils.Querier, eventID int64) ([]Attendance, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT s.`id`, s.`first_name`, s.`last_name`, s.`email`, c.`checked_in_at`, c.`points_earned` "+
+			"FROM `EVENT_CHECKINS` c JOIN `STUDENTS` s ON s.`id` = c.`student_id` "+
+			"WHERE c.`event_id` = ? ORDER BY c.`checked_in_at`, s.`id`",
+		eventID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendance := []Attendance{}
+	for rows.Next() {
+		var a Attendance
+		if err := rows.Scan(&a.StudentID, &a.FirstName, &a.LastName, &a.Email, &a.CheckedInAt, &a.PointsEarned); err != nil {
+			return nil, err
+		}
+		attendance = append(attendance, a)
+	}
+	return attendance, rows.Err()
+}
+
+// SetPointSource changes what checking in to the event awards, nil for nothing.
+// Students that already checked in keep what they got.
+func SetPointSource(ctx context.Context, q databaseutils.Querier, event *eventutils.Event, sourceID *int64) error {
+	if sourceID != nil {
+		if _, err := pointutils.GetSource(ctx, q, *sourceID); err != nil {
+			return err
+		}
+	}
+
+	_, err := q.ExecContext(ctx, "UPDATE `EVENTS` SET `point_source_id` = ? WHERE `id` = ?", sourceID, event.ID)
+	if err != nil {
+		return err
+	}
+	event.PointSourceID = sourceID
+	return nil
+}
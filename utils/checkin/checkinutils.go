@@ -0,0 +1,47 @@
+package checkinutils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	tokenutils "cdk-infrastructure/utils/token"
+)
+
+// Check-in tokens are what the QR code shown at an event encodes. They're signed with a
+// key only the api knows, so students can't make their own, and expire so a photo of
+// the code doesn't work after the event. See tokenutils for the format.
+
+var (
+	ErrInvalidToken = errors.New("invalid check-in token")
+	ErrExpiredToken = errors.New("check-in token has expired")
+)
+
+type payload struct {
+	EventID int64 `json:"e"`
+	Expires int64 `json:"x"` // unix seconds
+}
+
+// Sign returns a token for the event that's valid until expires
+func Sign(key []byte, eventID int64, expires time.Time) string {
+	return tokenutils.Sign(key, payload{EventID: eventID, Expires: expires.Unix()})
+}
+
+// Verify checks the token's signature and expiry and returns the event it's for
+func Verify(key []byte, token string, now time.Time) (int64, error) {
+	var p payload
+	if err := tokenutils.Verify(key, token, &p); err != nil || p.EventID <= 0 {
+		return 0, ErrInvalidToken
+	}
+	if now.Unix() >= p.Expires {
+		return 0, ErrExpiredToken
+	}
+	return p.EventID, nil
+}
+
+var key = tokenutils.NewKey("CHECKIN_SECRET_ARN")
+
+// Key loads the signing key from the secret in CHECKIN_SECRET_ARN
+func Key(ctx context.Context) ([]byte, error) {
+	return key.Load(ctx)
+}
@@ -0,0 +1,123 @@
+package checkinutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+	eventutils "cdk-infrastructure/utils/events"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2026, 11, 2, 22, 0, 0, 0, time.UTC)
+	token := Sign(testKey, 42, now.Add(15*time.Minute))
+
+	eventID, err := Verify(testKey, token, now)
+	if err != nil || eventID != 42 {
+		t.Fatalf("Verify = %d, %v, want 42, nil", eventID, err)
+	}
+
+	if _, err := Verify(testKey, token, now.Add(15*time.Minute)); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify after expiry = %v, want ErrExpiredToken", err)
+	}
+	if _, err := Verify([]byte("another key, another key, another"), token, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify with another key = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	now := time.Now()
+	token := Sign(testKey, 42, now.Add(time.Hour))
+	other := Sign(testKey, 43, now.Add(time.Hour))
+
+	payload, _, _ := strings.Cut(token, ".")
+	_, signature, _ := strings.Cut(other, ".")
+
+	for _, bad := range []string{
+		"",
+		"no-dot",
+		payload,
+		payload + ".",
+		payload + "." + signature, // event 42 with event 43's signature
+		token + "x",
+	} {
+		if _, err := Verify(testKey, bad, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify(%q) = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+}
+
+func TestRecordAwardsOnce(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	result, err := db.Exec("INSERT INTO `CLUBS` (`club_name`) VALUES ('Girls Who Code')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clubID, _ := result.LastInsertId()
+	result, err = db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES ('Ada')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	studentID, _ := result.LastInsertId()
+
+	var eventID int64
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		name := "General meeting"
+		event, err := eventutils.Create(ctx, tx, studentID, []int64{clubID}, eventutils.Fields{Name: &name, Status: eventutils.StatusDrafted})
+		if err != nil {
+			return err
+		}
+		eventID = event.ID
+		source, err := pointutils.CreateSource(ctx, tx, "General meeting", 10)
+		if err != nil {
+			return err
+		}
+		return SetPointSource(ctx, tx, event, &source.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkIn := func() *CheckIn {
+		t.Helper()
+		var record *CheckIn
+		err := databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			event, err := eventutils.Lock(ctx, tx, eventID)
+			if err != nil {
+				return err
+			}
+			record, err = Record(ctx, tx, event, studentID)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+		return record
+	}
+
+	first := checkIn()
+	if first.AlreadyCheckedIn || first.PointsEarned == nil || *first.PointsEarned != 10 {
+		t.Errorf("first check-in = %+v, want 10 points", first)
+	}
+	if second := checkIn(); !second.AlreadyCheckedIn {
+		t.Errorf("second check-in = %+v, want AlreadyCheckedIn", second)
+	}
+
+	balance, err := pointutils.Balance(ctx, db, studentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 10 {
+		t.Errorf("balance = %d, want 10", balance)
+	}
+}
@@ -0,0 +1,230 @@
+package clubutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	authutils "cdk-infrastructure/utils/auth"
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+var (
+	ErrNotFound = errors.New("club not found")
+	ErrInvalid  = errors.New("invalid")
+	// ErrConflict is returned when a change would leave the club in a bad state,
+	// e.g. with no eboard members
+	ErrConflict = errors.New("conflict")
+)
+
+type Club struct {
+	ID      int64   `json:"id"`
+	Name    *string `json:"name"`
+	Icon    *string `json:"icon"` // key in the image bucket
+	Members int64   `json:"members"`
+	Eboard  int64   `json:"eboard"`
+	MyRole  *string `json:"myRole,omitempty"`
+}
+
+type Member struct {
+	StudentID int64          `json:"studentId"`
+	FirstName *string        `json:"firstName"`
+	LastName  *string        `json:"lastName"`
+	Email     *string        `json:"email,omitempty"`
+	Role      authutils.Role `json:"role"`
+}
+
+const selectClubs = "SELECT c.`id`, c.`club_name`, c.`club_icon`, " +
+	"(SELECT COUNT(*) FROM `CLUB_MEMBERS` m WHERE m.`club_id` = c.`id`), " +
+	"(SELECT COUNT(*) FROM `CLUB_MEMBERS` m WHERE m.`club_id` = c.`id` AND m.`role` = 'eboard') " +
+	"FROM `CLUBS` c "
+
+func scanClub(row interface{ Scan(...any) error }) (*Club, error) {
+	var club Club
+	if err := row.Scan(&club.ID, &club.Name, &club.Icon, &club.Members, &club.Eboard); err != nil {
+		return nil, err
+	}
+	return &club, nil
+}
+
+// Get loads one club with its member counts
+func Get(ctx context.Context, q databaseutils.Querier, clubID int64) (*Club, error) {
+	club, err := scanClub(q.QueryRowContext(ctx, selectClubs+"WHERE c.`id` = ?", clubID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return club, err
+}
+
+// List returns every club ordered by name
+func List(ctx context.Context, q databaseutils.Querier) ([]*Club, error) {
+	rows, err := q.QueryContext(ctx, selectClubs+"ORDER BY c.`club_name`, c.`id`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clubs := []*Club{}
+	for rows.Next() {
+		club, err := scanClub(rows)
+		if err != nil {
+			return nil, err
+		}
+		clubs = append(clubs, club)
+	}
+	return clubs, rows.Err()
+}
+
+// Create adds a club, eboardID (if not 0) becomes its first eboard member
+func Create(ctx context.Context, q databaseutils.Querier, name string, eboardID int64) (int64, error) {
+	result, err := q.ExecContext(ctx, "INSERT INTO `CLUBS` (`club_name`) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	clubID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if eboardID != 0 {
+		_, err = q.ExecContext(ctx,
+			"INSERT INTO `CLUB_MEMBERS` (`student_id`, `club_id`, `role`) VALUES (?, ?, ?)",
+			eboardID, clubID, authutils.RoleEboard,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return clubID, nil
+}
+
+// Update writes the club's name and icon
+func Update(ctx context.Context, q databaseutils.Querier, club *Club) error {
+	_, err := q.ExecContext(ctx,
+		"UPDATE `CLUBS` SET `club_name` = ?, `club_icon` = ? WHERE `id` = ?",
+		club.Name, club.Icon, club.ID,
+	)
+	return err
+}
+
+// Members lists the club's members, eboard first
+func Members(ctx context.Context, q databaseutils.Querier, clubID int64) ([]Member, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT s.`id`, s.`first_name`, s.`last_name`, s.`email`, m.`role` FROM `CLUB_MEMBERS` m "+
+			"JOIN `STUDENTS` s ON s.`id` = m.`student_id` WHERE m.`club_id` = ? "+
+			"ORDER BY m.`role` = 'eboard' DESC, s.`last_name`, s.`first_name`",
+		clubID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.StudentID, &member.FirstName, &member.LastName, &member.Email, &member.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// Join adds the student as a member, joining a club twice does nothing
+func Join(ctx context.Context, q databaseutils.Querier, clubID, studentID int64) error {
+	if _, err := lockClub(ctx, q, clubID); err != nil {
+		return err
+	}
+
+	_, err := q.ExecContext(ctx,
+		"INSERT IGNORE INTO `CLUB_MEMBERS` (`student_id`, `club_id`, `role`) VALUES (?, ?, ?)",
+		studentID, clubID, authutils.RoleMember,
+	)
+	return err
+}
+
+// Remove takes the student out of the club. The last eboard member can't leave,
+// someone else has to be promoted first.
+func Remove(ctx context.Context, q databaseutils.Querier, clubID, studentID int64) error {
+	eboard, err := lockClub(ctx, q, clubID)
+	if err != nil {
+		return err
+	}
+	if eboard[studentID] && len(eboard) == 1 {
+		return fmt.Errorf("%w: the last eboard member can't leave the club", ErrConflict)
+	}
+
+	_, err = q.ExecContext(ctx,
+		"DELETE FROM `CLUB_MEMBERS` WHERE `club_id` = ? AND `student_id` = ?", clubID, studentID,
+	)
+	return err
+}
+
+// SetRole promotes or demotes a member. Demoting the last eboard member is not allowed.
+func SetRole(ctx context.Context, q databaseutils.Querier, clubID, studentID int64, role authutils.Role) error {
+	if role != authutils.RoleMember && role != authutils.RoleEboard {
+		return fmt.Errorf("%w: role must be %q or %q", ErrInvalid, authutils.RoleMember, authutils.RoleEboard)
+	}
+
+	eboard, err := lockClub(ctx, q, clubID)
+	if err != nil {
+		return err
+	}
+	if role == authutils.RoleMember && eboard[studentID] && len(eboard) == 1 {
+		return fmt.Errorf("%w: the club needs at least one eboard member", ErrConflict)
+	}
+
+	result, err := q.ExecContext(ctx,
+		"UPDATE `CLUB_MEMBERS` SET `role` = ? WHERE `club_id` = ? AND `student_id` = ?",
+		role, clubID, studentID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		var member bool
+		err := q.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM `CLUB_MEMBERS` WHERE `club_id` = ? AND `student_id` = ?)", clubID, studentID,
+		).Scan(&member)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return fmt.Errorf("%w: student %d is not a member of the club", ErrInvalid, studentID)
+		}
+	}
+	return nil
+}
+
+// lockClub locks the club row so membership changes to one club happen one at a time,
+// and returns the ids of its eboard members
+func lockClub(ctx context.Context, q databaseutils.Querier, clubID int64) (map[int64]bool, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, "SELECT `id` FROM `CLUBS` WHERE `id` = ? FOR UPDATE", clubID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx,
+		"SELECT `student_id` FROM `CLUB_MEMBERS` WHERE `club_id` = ? AND `role` = ?", clubID, authutils.RoleEboard,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eboard := map[int64]bool{}
+	for rows.Next() {
+		var studentID int64
+		if err := rows.Scan(&studentID); err != nil {
+			return nil, err
+		}
+		eboard[studentID] = true
+	}
+	return eboard, rows.Err()
+}
@@ -0,0 +1,198 @@
+package cryptoutils
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// version is the first byte of every blob, so the format can change without a
+// migration
+const version byte = 1
+
+const (
+	// a data key encrypts at most this many values, or for this long, before a new one
+	// is generated. AES-GCM with random nonces is safe for far more.
+	maxDataKeyUses  = 100_000
+	dataKeyLifetime = time.Hour
+)
+
+var ErrCorrupt = errors.New("encrypted value is corrupt")
+
+// KeySource hands out AES-256 data keys and unwraps them again, KMS in the lambdas
+type KeySource interface {
+	// GenerateDataKey returns a new key in plaintext and wrapped by the master key
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	// Unwrap returns the plaintext of a key GenerateDataKey wrapped
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Cipher does envelope encryption: each value is sealed with AES-GCM under a data key,
+// and the wrapped data key is stored next to it. Data keys are reused for a while and
+// unwrapped keys are cached so most calls never reach the KeySource.
+type Cipher struct {
+	keys     KeySource
+	indexKey []byte
+
+	mu        sync.Mutex
+	current   *dataKey
+	unwrapped map[string]cipher.AEAD
+}
+
+type dataKey struct {
+	aead    cipher.AEAD
+	wrapped []byte
+	uses    int
+	expires time.Time
+}
+
+// New returns a Cipher that gets its data keys from keys. indexKey is the HMAC key
+// for BlindIndex, it has to stay the same for the indexes to keep matching.
+func New(keys KeySource, indexKey []byte) *Cipher {
+	return &Cipher{keys: keys, indexKey: indexKey, unwrapped: map[string]cipher.AEAD{}}
+}
+
+// Encrypt seals plaintext. label says what the value is, e.g. "emplid", and has to be
+// passed to Decrypt again, so a value copied into another column won't decrypt.
+//
+// The blob is version | wrapped key length (2 bytes) | wrapped key | nonce | sealed.
+func (c *Cipher) Encrypt(ctx context.Context, plaintext, label string) ([]byte, error) {
+	key, err := c.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, 0, 3+len(key.wrapped)+len(nonce)+len(plaintext)+key.aead.Overhead())
+	blob = append(blob, version)
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(key.wrapped)))
+	blob = append(blob, key.wrapped...)
+	blob = append(blob, nonce...)
+	return key.aead.Seal(blob, nonce, []byte(plaintext), []byte(label)), nil
+}
+
+// Decrypt opens a blob from Encrypt that was sealed with the same label
+func (c *Cipher) Decrypt(ctx context.Context, blob []byte, label string) (string, error) {
+	if len(blob) < 3 || blob[0] != version {
+		return "", ErrCorrupt
+	}
+	wrappedLen := int(binary.BigEndian.Uint16(blob[1:3]))
+	if len(blob) < 3+wrappedLen {
+		return "", ErrCorrupt
+	}
+	wrapped, rest := blob[3:3+wrappedLen], blob[3+wrappedLen:]
+
+	aead, err := c.unwrap(ctx, wrapped)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) < aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(label))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plaintext), nil
+}
+
+// EncryptNullable is Encrypt for nullable columns, nil and blank values stay NULL
+func (c *Cipher) EncryptNullable(ctx context.Context, plaintext *string, label string) ([]byte, error) {
+	if plaintext == nil || strings.TrimSpace(*plaintext) == "" {
+		return nil, nil
+	}
+	return c.Encrypt(ctx, *plaintext, label)
+}
+
+// DecryptNullable is Decrypt for nullable columns, NULL comes back as nil
+func (c *Cipher) DecryptNullable(ctx context.Context, blob []byte, label string) (*string, error) {
+	if blob == nil {
+		return nil, nil
+	}
+	plaintext, err := c.Decrypt(ctx, blob, label)
+	if err != nil {
+		return nil, err
+	}
+	return &plaintext, nil
+}
+
+// BlindIndex is a keyed hash of the value that can be stored and searched on in place
+// of it, equal values (ignoring case and surrounding spaces) have equal indexes. Blank
+// values have no index.
+func (c *Cipher) BlindIndex(value, label string) []byte {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return nil
+	}
+	h := hmac.New(sha256.New, c.indexKey)
+	h.Write([]byte(label))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// dataKey returns the key to encrypt with, generating a new one when the current one
+// has been used enough
+func (c *Cipher) dataKey(ctx context.Context) (*dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current == nil || c.current.uses >= maxDataKeyUses || time.Now().After(c.current.expires) {
+		plaintext, wrapped, err := c.keys.GenerateDataKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("generating data key: %w", err)
+		}
+		aead, err := newAEAD(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		c.current = &dataKey{aead: aead, wrapped: wrapped, expires: time.Now().Add(dataKeyLifetime)}
+		c.unwrapped[string(wrapped)] = aead
+	}
+	c.current.uses++
+	return c.current, nil
+}
+
+func (c *Cipher) unwrap(ctx context.Context, wrapped []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	aead, ok := c.unwrapped[string(wrapped)]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	plaintext, err := c.keys.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	aead, err = newAEAD(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.unwrapped[string(wrapped)] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
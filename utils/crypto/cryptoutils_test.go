@@ -0,0 +1,125 @@
+package cryptoutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingKeys counts how often the KeySource is reached
+type countingKeys struct {
+	StaticKeys
+	generated, unwrapped int
+}
+
+func (k *countingKeys) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	k.generated++
+	return k.StaticKeys.GenerateDataKey(ctx)
+}
+
+func (k *countingKeys) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	k.unwrapped++
+	return k.StaticKeys.Unwrap(ctx, wrapped)
+}
+
+func newTestCipher() (*Cipher, *countingKeys) {
+	keys := &countingKeys{StaticKeys: StaticKeys(bytes.Repeat([]byte{7}, 32))}
+	return New(keys, []byte("an index key that is long enough")), keys
+}
+
+func TestEncrypt(t *testing.T) {
+	ctx := context.Background()
+	c, keys := newTestCipher()
+
+	first, err := c.Encrypt(ctx, "12345678", "emplid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Encrypt(ctx, "12345678", "emplid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("encrypting twice gave the same blob, want a new nonce each time")
+	}
+	if keys.generated != 1 {
+		t.Errorf("generated %d data keys, want 1 reused", keys.generated)
+	}
+
+	if plaintext, err := c.Decrypt(ctx, first, "emplid"); err != nil || plaintext != "12345678" {
+		t.Errorf("Decrypt = %q, %v, want the emplid", plaintext, err)
+	}
+	if _, err := c.Decrypt(ctx, first, "dietary_restrictions"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Decrypt with another label = %v, want ErrCorrupt", err)
+	}
+	tampered := bytes.Clone(first)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := c.Decrypt(ctx, tampered, "emplid"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Decrypt of a changed blob = %v, want ErrCorrupt", err)
+	}
+	if _, err := c.Decrypt(ctx, first[:2], "emplid"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Decrypt of a short blob = %v, want ErrCorrupt", err)
+	}
+
+	// another container with the same master key unwraps the data key once
+	other := New(keys, c.indexKey)
+	for i := 0; i < 2; i++ {
+		if plaintext, err := other.Decrypt(ctx, second, "emplid"); err != nil || plaintext != "12345678" {
+			t.Errorf("Decrypt = %q, %v, want the emplid", plaintext, err)
+		}
+	}
+	if keys.unwrapped != 1 {
+		t.Errorf("unwrapped %d times, want 1", keys.unwrapped)
+	}
+}
+
+func TestEncryptNullable(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCipher()
+
+	blank := "  "
+	for _, value := range []*string{nil, &blank} {
+		if blob, err := c.EncryptNullable(ctx, value, "emplid"); err != nil || blob != nil {
+			t.Errorf("EncryptNullable(%v) = %v, %v, want NULL", value, blob, err)
+		}
+	}
+	if value, err := c.DecryptNullable(ctx, nil, "emplid"); err != nil || value != nil {
+		t.Errorf("DecryptNullable(nil) = %v, %v, want nil", value, err)
+	}
+
+	vegan := "vegan"
+	blob, err := c.EncryptNullable(ctx, &vegan, "diet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := c.DecryptNullable(ctx, blob, "diet"); err != nil || value == nil || *value != vegan {
+		t.Errorf("DecryptNullable = %v, %v, want %q", value, err, vegan)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	c, _ := newTestCipher()
+
+	index := c.BlindIndex("12345678", "emplid")
+	if len(index) != 32 {
+		t.Fatalf("len(BlindIndex) = %d, want 32", len(index))
+	}
+	if !bytes.Equal(index, c.BlindIndex(" 12345678 ", "emplid")) {
+		t.Error("surrounding spaces changed the index")
+	}
+	if bytes.Equal(index, c.BlindIndex("12345679", "emplid")) {
+		t.Error("different values have the same index")
+	}
+	if bytes.Equal(index, c.BlindIndex("12345678", "other")) {
+		t.Error("different labels have the same index")
+	}
+	if c.BlindIndex(" ", "emplid") != nil {
+		t.Error("blank value has an index")
+	}
+
+	other := New(StaticKeys(bytes.Repeat([]byte{7}, 32)), []byte("a different index key, also long"))
+	if bytes.Equal(index, other.BlindIndex("12345678", "emplid")) {
+		t.Error("different index keys give the same index")
+	}
+}
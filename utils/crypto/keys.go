@@ -0,0 +1,127 @@
+package cryptoutils
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// KMSKeys wraps data keys with a KMS key
+type KMSKeys struct {
+	Client *kms.Client
+	// KeyID is the id, arn or alias of the KMS key, only needed to generate keys. KMS
+	// finds the key of a wrapped data key on its own.
+	KeyID string
+}
+
+func (k KMSKeys) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	out, err := k.Client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(k.KeyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Plaintext, out.CiphertextBlob, nil
+}
+
+func (k KMSKeys) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	out, err := k.Client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// StaticKeys wraps data keys with a fixed AES key instead of KMS, for tests
+type StaticKeys []byte
+
+func (k StaticKeys) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := k.seal(plaintext)
+	return plaintext, wrapped, err
+}
+
+func (k StaticKeys) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	plaintext, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plaintext, nil
+}
+
+func (k StaticKeys) seal(plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(k)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// the cipher is kept for the life of the container like the database pool, so data
+// keys are reused across invocations
+var (
+	defaultMu     sync.Mutex
+	defaultCipher *Cipher
+)
+
+// Default returns the Cipher for the key in DATA_KEY_ARN, with the blind index key
+// from the secret in BLIND_INDEX_SECRET_ARN
+func Default(ctx context.Context) (*Cipher, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultCipher != nil {
+		return defaultCipher, nil
+	}
+
+	keyID, secretARN := os.Getenv("DATA_KEY_ARN"), os.Getenv("BLIND_INDEX_SECRET_ARN")
+	if keyID == "" || secretARN == "" {
+		return nil, fmt.Errorf("DATA_KEY_ARN and BLIND_INDEX_SECRET_ARN must be set")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &secretARN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading blind index secret: %w", err)
+	}
+	if out.SecretString == nil || len(*out.SecretString) < 32 {
+		return nil, fmt.Errorf("blind index secret is too short")
+	}
+
+	defaultCipher = New(KMSKeys{Client: kms.NewFromConfig(cfg), KeyID: keyID}, []byte(*out.SecretString))
+	return defaultCipher, nil
+}
+
+// SetDefault replaces the Cipher Default returns, tests use it with StaticKeys
+func SetDefault(c *Cipher) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultCipher = c
+}
@@ -0,0 +1,116 @@
+package databaseutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/go-sql-driver/mysql"
+)
+
+// the pool is kept for the life of the container so warm invocations reuse it,
+// see lambda/database/test for the reasoning
+var (
+	once    sync.Once
+	pool    *sql.DB
+	poolErr error
+)
+
+// Connect returns a connection pool to the club database through the RDS proxy.
+//
+// It reads DB_SECRET_ARN (the instance's generated secret), DB_HOST (the proxy endpoint)
+// and DB_NAME from the environment, these are set by newDatabaseFunction in the stack package.
+func Connect(ctx context.Context) (*sql.DB, error) {
+	once.Do(func() {
+		pool, poolErr = open(ctx)
+	})
+	return pool, poolErr
+}
+
+func open(ctx context.Context) (*sql.DB, error) {
+	arn := os.Getenv("DB_SECRET_ARN")
+	host := os.Getenv("DB_HOST")
+	if arn == "" || host == "" {
+		return nil, fmt.Errorf("DB_SECRET_ARN and DB_HOST must be set")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &arn,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading database secret: %w", err)
+	}
+
+	var creds struct {
+		User string `json:"username"`
+		Pass string `json:"password"`
+		Port int    `json:"port"`
+	}
+	if err := json.Unmarshal([]byte(*out.SecretString), &creds); err != nil {
+		return nil, fmt.Errorf("parsing database secret: %w", err)
+	}
+	if creds.Port == 0 {
+		creds.Port = 3306
+	}
+
+	dsn := mysql.NewConfig()
+	dsn.User = creds.User
+	dsn.Passwd = creds.Pass
+	dsn.Net = "tcp"
+	dsn.Addr = fmt.Sprintf("%s:%d", host, creds.Port)
+	dsn.DBName = os.Getenv("DB_NAME")
+	dsn.TLSConfig = "true"
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+
+	db, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	// the proxy does the real pooling, a handful per container is plenty
+	db.SetMaxOpenConns(5)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	return db, nil
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so helpers can run inside or
+// outside a transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Beginner is satisfied by *sql.DB and by a single *sql.Conn, for work that has to
+// stay on one connection like holding a named lock
+type Beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling back otherwise.
+func WithTx(ctx context.Context, db Beginner, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
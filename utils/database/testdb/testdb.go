@@ -0,0 +1,99 @@
+// Package testdb gives tests a scratch MySQL database with the migrations applied.
+package testdb
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	cryptoutils "cdk-infrastructure/utils/crypto"
+	migrationutils "cdk-infrastructure/utils/migration"
+)
+
+// Migrations are the tables the init lambda creates, in the order it creates them.
+// Keep in sync with initTableMigrationFiles in lambda/database/init/main.go.
+var Migrations = []string{
+	"07_11_2025_create_core_tables_up.sql",
+	"07_11_2025_create_member_form_migration_table_up.sql",
+	"19_10_2026_link_students_to_cognito_up.sql",
+	"19_10_2026_version_events_up.sql",
+	"19_10_2026_create_cohost_invitations_up.sql",
+	"19_10_2026_create_event_rsvps_up.sql",
+	"19_10_2026_create_event_checkins_up.sql",
+	"19_10_2026_points_ledger_up.sql",
+	"19_10_2026_create_rewards_up.sql",
+	"19_10_2026_import_member_forms_up.sql",
+	"19_10_2026_create_student_merges_up.sql",
+	"19_10_2026_create_student_erasures_up.sql",
+	"19_10_2026_encrypt_student_info_up.sql",
+	"19_10_2026_create_audit_log_up.sql",
+	"19_10_2026_calendar_token_version_up.sql",
+	"19_10_2026_clear_imported_form_answers_up.sql",
+}
+
+// Open creates a scratch database on the MySQL server in TEST_MYSQL_DSN, e.g.
+//
+//	docker run -d -p 3306:3306 -e MYSQL_ROOT_PASSWORD=test mysql:8
+//	TEST_MYSQL_DSN='root:test@tcp(localhost:3306)/' go test ./utils/...
+//
+// and applies the migrations to it. The test is skipped when TEST_MYSQL_DSN isn't set
+// and the database is dropped when it ends. Encrypted columns use a fixed local key
+// instead of KMS.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN not set, skipping MySQL test")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("parsing TEST_MYSQL_DSN: %v", err)
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	server, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("gwc_test_%d", time.Now().UnixNano())
+	if _, err := server.Exec("CREATE DATABASE `" + name + "`"); err != nil {
+		t.Fatalf("creating test database: %v", err)
+	}
+	t.Cleanup(func() {
+		server.Exec("DROP DATABASE `" + name + "`")
+		server.Close()
+	})
+
+	cfg.DBName = name
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, file := range Migrations {
+		if err := migrationutils.RunMigrationFrom(db, migrationsDir(), file); err != nil {
+			t.Fatalf("applying %s: %v", file, err)
+		}
+	}
+
+	cryptoutils.SetDefault(cryptoutils.New(cryptoutils.StaticKeys(testKey), testKey))
+	return db
+}
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// migrationsDir finds lambda/database/init/migrations from this file, tests run in
+// their own package's folder
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "..", "lambda", "database", "init", "migrations")
+}
@@ -0,0 +1,218 @@
+package eventutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// Co-hosting: an eboard member of a hosting club invites another club, and once an
+// eboard member of that club accepts it's added to EVENTS_TO_CLUBS. From then on the
+// club's eboard can edit the event like the original hosts (see authutils.EboardOfEventHost).
+
+type InvitationStatus string
+
+const (
+	InvitationPending   InvitationStatus = "pending"
+	InvitationAccepted  InvitationStatus = "accepted"
+	InvitationDeclined  InvitationStatus = "declined"
+	InvitationCancelled InvitationStatus = "cancelled"
+)
+
+// ErrConflict is returned for changes that don't fit the current state, e.g. inviting a
+// club that already hosts the event
+var ErrConflict = errors.New("conflict")
+
+type Invitation struct {
+	ID          int64            `json:"id"`
+	EventID     int64            `json:"eventId"`
+	ClubID      int64            `json:"clubId"`
+	InvitedBy   *int64           `json:"invitedBy"`
+	Status      InvitationStatus `json:"status"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	RespondedBy *int64           `json:"respondedBy"`
+	RespondedAt *time.Time       `json:"respondedAt"`
+
+	// EventName is the current name of the event, for showing the invitation
+	EventName *string `json:"eventName"`
+}
+
+const selectInvitations = "SELECT i.`id`, i.`event_id`, i.`club_id`, i.`invited_by`, i.`status`, i.`created_at`, " +
+	"i.`responded_by`, i.`responded_at`, v.`event_name` FROM `EVENT_COHOST_INVITATIONS` i " +
+	"JOIN `EVENTS` e ON e.`id` = i.`event_id` JOIN `EVENT_VERSIONS` v ON v.`id` = e.`current_version_id` "
+
+func scanInvitation(row interface{ Scan(...any) error }) (*Invitation, error) {
+	var i Invitation
+	err := row.Scan(&i.ID, &i.EventID, &i.ClubID, &i.InvitedBy, &i.Status, &i.CreatedAt,
+		&i.RespondedBy, &i.RespondedAt, &i.EventName)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func queryInvitations(ctx context.Context, q databaseutils.Querier, where string, args ...any) ([]*Invitation, error) {
+	rows, err := q.QueryContext(ctx, selectInvitations+"WHERE "+where+" ORDER BY i.`created_at` DESC, i.`id` DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// EventInvitations lists every invitation sent for the event
+func EventInvitations(ctx context.Context, q databaseutils.Querier, eventID int64) ([]*Invitation, error) {
+	return queryInvitations(ctx, q, "i.`event_id` = ?", eventID)
+}
+
+// ClubInvitations lists the club's invitations, only pending ones unless all is set
+func ClubInvitations(ctx context.Context, q databaseutils.Querier, clubID int64, all bool) ([]*Invitation, error) {
+	if all {
+		return queryInvitations(ctx, q, "i.`club_id` = ?", clubID)
+	}
+	return queryInvitations(ctx, q, "i.`club_id` = ? AND i.`status` = 'pending'", clubID)
+}
+
+// Invite invites the club to co-host the event. A declined or cancelled invitation to
+// the same club is sent again. The event has to have been loaded with Lock.
+func Invite(ctx context.Context, q databaseutils.Querier, event *Event, clubID, invitedBy int64) (*Invitation, error) {
+	if event.Deleted() {
+		return nil, ErrDeleted
+	}
+	for _, host := range event.ClubIDs {
+		if host == clubID {
+			return nil, fmt.Errorf("%w: club %d already hosts the event", ErrConflict, clubID)
+		}
+	}
+
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM `CLUBS` WHERE `id` = ?)", clubID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: club %d doesn't exist", ErrInvalid, clubID)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := q.ExecContext(ctx,
+		"INSERT INTO `EVENT_COHOST_INVITATIONS` (`event_id`, `club_id`, `invited_by`, `status`, `created_at`) "+
+			"VALUES (?, ?, ?, 'pending', ?) ON DUPLICATE KEY UPDATE "+
+			"`invited_by` = VALUES(`invited_by`), `status` = 'pending', `created_at` = VALUES(`created_at`), "+
+			"`responded_by` = NULL, `responded_at` = NULL",
+		event.ID, clubID, invitedBy, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanInvitation(q.QueryRowContext(ctx, selectInvitations+"WHERE i.`event_id` = ? AND i.`club_id` = ?", event.ID, clubID))
+}
+
+// LockInvitation loads a pending invitation sent to the club and locks its event, so
+// responding can't race with the hosts cancelling it
+func LockInvitation(ctx context.Context, q databaseutils.Querier, clubID, invitationID int64) (*Invitation, *Event, error) {
+	var eventID int64
+	err := q.QueryRowContext(ctx,
+		"SELECT `event_id` FROM `EVENT_COHOST_INVITATIONS` WHERE `id` = ? AND `club_id` = ?", invitationID, clubID,
+	).Scan(&eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%w: invitation %d", ErrNotFound, invitationID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// event first, the same order Invite and RemoveHost take their locks in
+	event, err := Lock(ctx, q, eventID)
+	if err != nil {
+		return nil, nil, err
+	}
+	invitation, err := scanInvitation(q.QueryRowContext(ctx, selectInvitations+"WHERE i.`id` = ? FOR UPDATE", invitationID))
+	if err != nil {
+		return nil, nil, err
+	}
+	if invitation.Status != InvitationPending {
+		return nil, nil, fmt.Errorf("%w: invitation is already %s", ErrConflict, invitation.Status)
+	}
+	return invitation, event, nil
+}
+
+// Respond accepts or declines an invitation from LockInvitation, accepting makes the
+// club a host of the event
+func Respond(ctx context.Context, q databaseutils.Querier, invitation *Invitation, event *Event, accept bool, studentID int64) error {
+	status := InvitationDeclined
+	if accept {
+		if event.Deleted() {
+			return ErrDeleted
+		}
+		status = InvitationAccepted
+
+		_, err := q.ExecContext(ctx,
+			"INSERT IGNORE INTO `EVENTS_TO_CLUBS` (`event_id`, `club_id`) VALUES (?, ?)", event.ID, invitation.ClubID,
+		)
+		if err != nil {
+			return err
+		}
+		event.ClubIDs = append(event.ClubIDs, invitation.ClubID)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := q.ExecContext(ctx,
+		"UPDATE `EVENT_COHOST_INVITATIONS` SET `status` = ?, `responded_by` = ?, `responded_at` = ? WHERE `id` = ?",
+		status, studentID, now, invitation.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	invitation.Status = status
+	invitation.RespondedBy = &studentID
+	invitation.RespondedAt = &now
+	return nil
+}
+
+// RemoveHost takes the club off the event, or cancels its pending invitation. The last
+// host can't be removed. The event has to have been loaded with Lock.
+func RemoveHost(ctx context.Context, q databaseutils.Querier, event *Event, clubID int64) error {
+	hosts := false
+	for _, host := range event.ClubIDs {
+		hosts = hosts || host == clubID
+	}
+
+	if hosts {
+		if len(event.ClubIDs) == 1 {
+			return fmt.Errorf("%w: an event needs at least one hosting club", ErrConflict)
+		}
+		_, err := q.ExecContext(ctx, "DELETE FROM `EVENTS_TO_CLUBS` WHERE `event_id` = ? AND `club_id` = ?", event.ID, clubID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// accepted invitations are cancelled too so the club can be invited again later
+	result, err := q.ExecContext(ctx,
+		"UPDATE `EVENT_COHOST_INVITATIONS` SET `status` = 'cancelled' "+
+			"WHERE `event_id` = ? AND `club_id` = ? AND `status` IN ('pending', 'accepted')",
+		event.ID, clubID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 && !hosts {
+		return fmt.Errorf("%w: club %d doesn't host and isn't invited to the event", ErrNotFound, clubID)
+	}
+	return nil
+}
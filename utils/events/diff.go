@@ -0,0 +1,57 @@
+package eventutils
+
+import "time"
+
+// Change is one field that differs between two versions
+type Change struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// Diff lists the fields that changed going from a to b, in a fixed order
+func Diff(a, b Fields) []Change {
+	from := a.values()
+	to := b.values()
+
+	changes := []Change{}
+	for i := range from {
+		if from[i].value != to[i].value {
+			changes = append(changes, Change{Field: from[i].field, From: from[i].value, To: to[i].value})
+		}
+	}
+	return changes
+}
+
+type fieldValue struct {
+	field string
+	value any // nil, string or Status, always comparable with ==
+}
+
+// values flattens the fields, names match the JSON ones
+func (f Fields) values() []fieldValue {
+	return []fieldValue{
+		{"name", str(f.Name)},
+		{"image", str(f.Image)},
+		{"status", f.Status},
+		{"start", timestamp(f.Start)},
+		{"end", timestamp(f.End)},
+		{"location", str(f.Location)},
+		{"description", str(f.Description)},
+	}
+}
+
+func str(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// timestamp compares times by instant, *time.Time can't be compared with ==
+func timestamp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
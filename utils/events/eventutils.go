@@ -0,0 +1,429 @@
+package eventutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// Every change to an event is a new EVENT_VERSIONS row, EVENTS only points at the
+// first (original_version_id) and latest (current_version_id) one. Nothing is ever
+// updated in place, so the whole history can be listed, diffed and reverted to.
+
+type Status string
+
+const (
+	StatusDrafted Status = "drafted"
+	StatusPosted  Status = "posted"
+)
+
+type VersionType string
+
+const (
+	TypeCreate VersionType = "create"
+	TypeEdit   VersionType = "edit"
+	TypeDelete VersionType = "delete" // tombstone, the event is gone but its history isn't
+)
+
+var (
+	ErrNotFound = errors.New("event not found")
+	ErrDeleted  = errors.New("event has been deleted")
+	ErrInvalid  = errors.New("invalid")
+)
+
+// Fields are the parts of an event that are versioned
+type Fields struct {
+	Name        *string    `json:"name"`
+	Image       *string    `json:"image"` // key in the image bucket
+	Status      Status     `json:"status"`
+	Start       *time.Time `json:"start"`
+	End         *time.Time `json:"end"`
+	Location    *string    `json:"location"`
+	Description *string    `json:"description"`
+}
+
+// Validate checks the fields fit their columns, posted events also need a name and start
+func (f Fields) Validate() error {
+	limits := []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"name", f.Name, 255},
+		{"image", f.Image, 255},
+		{"location", f.Location, 255},
+		{"description", f.Description, 65535},
+	}
+	for _, limit := range limits {
+		if limit.value != nil && len(*limit.value) > limit.max {
+			return fmt.Errorf("%w: %s can be at most %d characters", ErrInvalid, limit.name, limit.max)
+		}
+	}
+
+	if f.Status != StatusDrafted && f.Status != StatusPosted {
+		return fmt.Errorf("%w: status must be %q or %q", ErrInvalid, StatusDrafted, StatusPosted)
+	}
+	if f.Start != nil && f.End != nil && f.End.Before(*f.Start) {
+		return fmt.Errorf("%w: end can't be before start", ErrInvalid)
+	}
+	if f.Status == StatusPosted && (f.Name == nil || strings.TrimSpace(*f.Name) == "" || f.Start == nil) {
+		return fmt.Errorf("%w: a posted event needs a name and a start", ErrInvalid)
+	}
+	return nil
+}
+
+type Version struct {
+	ID             int64       `json:"id"`
+	EventID        int64       `json:"eventId"`
+	AuthorID       *int64      `json:"authorId"`
+	Type           VersionType `json:"type"`
+	RevertedFromID *int64      `json:"revertedFromId,omitempty"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Fields
+}
+
+// Event is an event with its current version
+type Event struct {
+	ID                int64   `json:"id"`
+	OriginalVersionID int64   `json:"originalVersionId"`
+	ClubIDs           []int64 `json:"clubIds"`
+	Current           Version `json:"current"`
+	// Capacity is how many students can be going, nil for no limit. It isn't versioned,
+	// see rsvputils.
+	Capacity *int64 `json:"capacity"`
+	// PointSourceID is awarded to students that check in, see checkinutils
+	PointSourceID *int64 `json:"pointSourceId"`
+}
+
+func (e *Event) Deleted() bool {
+	return e.Current.Type == TypeDelete
+}
+
+// Visible is true for events anyone signed in can see, the rest are only for the hosting eboards
+func (e *Event) Visible() bool {
+	return !e.Deleted() && e.Current.Status == StatusPosted
+}
+
+const selectVersions = "SELECT `id`, `event_id`, `author_id`, `type`, `reverted_from_id`, `timestamp`, " +
+	"`event_name`, `event_img`, `event_status`, `event_date`, `event_end`, `location`, `description` " +
+	"FROM `EVENT_VERSIONS` "
+
+func scanVersion(row interface{ Scan(...any) error }) (*Version, error) {
+	var v Version
+	err := row.Scan(&v.ID, &v.EventID, &v.AuthorID, &v.Type, &v.RevertedFromID, &v.Timestamp,
+		&v.Name, &v.Image, &v.Status, &v.Start, &v.End, &v.Location, &v.Description)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Create inserts a new event hosted by clubIDs with a create version holding fields
+func Create(ctx context.Context, q databaseutils.Querier, authorID int64, clubIDs []int64, fields Fields) (*Event, error) {
+	if len(clubIDs) == 0 {
+		return nil, fmt.Errorf("%w: an event needs at least one hosting club", ErrInvalid)
+	}
+	if err := fields.Validate(); err != nil {
+		return nil, err
+	}
+
+	// EVENTS and EVENT_VERSIONS point at each other, so the event is inserted first
+	// and pointed at its version once that exists
+	result, err := q.ExecContext(ctx, "INSERT INTO `EVENTS` (`current_version_id`, `original_version_id`) VALUES (NULL, NULL)")
+	if err != nil {
+		return nil, err
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, clubID := range clubIDs {
+		_, err := q.ExecContext(ctx, "INSERT IGNORE INTO `EVENTS_TO_CLUBS` (`event_id`, `club_id`) VALUES (?, ?)", eventID, clubID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := insertVersion(ctx, q, eventID, authorID, TypeCreate, nil, fields)
+	if err != nil {
+		return nil, err
+	}
+	_, err = q.ExecContext(ctx,
+		"UPDATE `EVENTS` SET `current_version_id` = ?, `original_version_id` = ? WHERE `id` = ?",
+		version.ID, version.ID, eventID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return Get(ctx, q, eventID)
+}
+
+// Get loads an event with its current version and hosting clubs
+func Get(ctx context.Context, q databaseutils.Querier, eventID int64) (*Event, error) {
+	return get(ctx, q, eventID, "")
+}
+
+// Lock is Get with the EVENTS row locked until the transaction ends, every change to an
+// event goes through it so two writers can't both append on top of the same version
+func Lock(ctx context.Context, q databaseutils.Querier, eventID int64) (*Event, error) {
+	return get(ctx, q, eventID, " FOR UPDATE")
+}
+
+func get(ctx context.Context, q databaseutils.Querier, eventID int64, lock string) (*Event, error) {
+	event := Event{ID: eventID, ClubIDs: []int64{}}
+	var currentID sql.NullInt64
+	var originalID sql.NullInt64
+	err := q.QueryRowContext(ctx,
+		"SELECT `current_version_id`, `original_version_id`, `capacity`, `point_source_id` FROM `EVENTS` WHERE `id` = ?"+lock,
+		eventID,
+	).Scan(&currentID, &originalID, &event.Capacity, &event.PointSourceID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !currentID.Valid) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	event.OriginalVersionID = originalID.Int64
+
+	current, err := scanVersion(q.QueryRowContext(ctx, selectVersions+"WHERE `id` = ?", currentID.Int64))
+	if err != nil {
+		return nil, err
+	}
+	event.Current = *current
+
+	rows, err := q.QueryContext(ctx, "SELECT `club_id` FROM `EVENTS_TO_CLUBS` WHERE `event_id` = ? ORDER BY `club_id`", eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var clubID int64
+		if err := rows.Scan(&clubID); err != nil {
+			return nil, err
+		}
+		event.ClubIDs = append(event.ClubIDs, clubID)
+	}
+	return &event, rows.Err()
+}
+
+// StaleError is returned by CheckBase when a change was made on top of a version that
+// is no longer the current one, i.e. someone else changed the event in the meantime
+type StaleError struct {
+	BaseVersionID    int64 `json:"baseVersionId"`
+	CurrentVersionID int64 `json:"currentVersionId"`
+	// Changes are what happened between the base and the current version
+	Changes []Change `json:"changes"`
+	// Conflicts are the fields the rejected change touched that were also changed since
+	// the base, filled in by the caller since only it knows what it was changing
+	Conflicts []string `json:"conflicts"`
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("event has changed since version %d, the current version is %d", e.BaseVersionID, e.CurrentVersionID)
+}
+
+// CheckBase makes sure baseVersionID is still the event's current version, the event has
+// to have been loaded with Lock so nothing can move it on before the change is appended
+func CheckBase(ctx context.Context, q databaseutils.Querier, event *Event, baseVersionID int64) error {
+	if baseVersionID == event.Current.ID {
+		return nil
+	}
+
+	base, err := GetVersion(ctx, q, event.ID, baseVersionID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: version %d is not a version of event %d", ErrInvalid, baseVersionID, event.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return &StaleError{
+		BaseVersionID:    base.ID,
+		CurrentVersionID: event.Current.ID,
+		Changes:          Diff(base.Fields, event.Current.Fields),
+		Conflicts:        []string{},
+	}
+}
+
+// Append adds a version on top of the event's current one and makes it current.
+// The event has to have been loaded with Lock in the same transaction.
+func Append(ctx context.Context, q databaseutils.Querier, event *Event, authorID int64, versionType VersionType,
+	revertedFromID *int64, fields Fields) (*Version, error) {
+
+	if event.Deleted() && revertedFromID == nil {
+		// only a revert can bring a deleted event back
+		return nil, ErrDeleted
+	}
+	if versionType != TypeDelete {
+		if err := fields.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := insertVersion(ctx, q, event.ID, authorID, versionType, revertedFromID, fields)
+	if err != nil {
+		return nil, err
+	}
+	_, err = q.ExecContext(ctx, "UPDATE `EVENTS` SET `current_version_id` = ? WHERE `id` = ?", version.ID, event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Current = *version
+	return version, nil
+}
+
+func insertVersion(ctx context.Context, q databaseutils.Querier, eventID, authorID int64, versionType VersionType,
+	revertedFromID *int64, f Fields) (*Version, error) {
+
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO `EVENT_VERSIONS` (`event_id`, `author_id`, `type`, `reverted_from_id`, `timestamp`, "+
+			"`event_name`, `event_img`, `event_status`, `event_date`, `event_end`, `location`, `description`) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		eventID, authorID, versionType, revertedFromID, now,
+		f.Name, f.Image, f.Status, f.Start, f.End, f.Location, f.Description,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Version{
+		ID:             id,
+		EventID:        eventID,
+		AuthorID:       &authorID,
+		Type:           versionType,
+		RevertedFromID: revertedFromID,
+		Timestamp:      now,
+		Fields:         f,
+	}, nil
+}
+
+// Versions lists every version of the event, oldest first
+func Versions(ctx context.Context, q databaseutils.Querier, eventID int64) ([]*Version, error) {
+	rows, err := q.QueryContext(ctx, selectVersions+"WHERE `event_id` = ? ORDER BY `id`", eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*Version{}
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion loads one version, it has to belong to the event
+func GetVersion(ctx context.Context, q databaseutils.Querier, eventID, versionID int64) (*Version, error) {
+	version, err := scanVersion(q.QueryRowContext(ctx, selectVersions+"WHERE `id` = ? AND `event_id` = ?", versionID, eventID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: version %d", ErrNotFound, versionID)
+	}
+	return version, err
+}
+
+// Listed is an upcoming posted event as shown in listings
+type Listed struct {
+	ID      int64   `json:"id"`
+	ClubIDs []int64 `json:"clubIds"`
+	Version
+}
+
+// ListPosted returns posted events that haven't ended before from, soonest first.
+// With clubID only events that club hosts are returned.
+func ListPosted(ctx context.Context, q databaseutils.Querier, from time.Time, clubID int64, limit int64) ([]*Listed, error) {
+	where := "v.`type` <> 'delete' AND v.`event_status` = 'posted' AND COALESCE(v.`event_end`, v.`event_date`) >= ? "
+	args := []any{from.UTC()}
+	if clubID != 0 {
+		where += "AND " + hostedBy
+		args = append(args, clubID)
+	}
+	args = append(args, limit, 0)
+
+	return list(ctx, q, where, "v.`event_date`, e.`id`", args)
+}
+
+// ListForClub returns every event the club hosts or co-hosts, newest first. Drafts are
+// only included with drafts set, deleted events never are.
+func ListForClub(ctx context.Context, q databaseutils.Querier, clubID int64, drafts bool, limit, offset int64) ([]*Listed, error) {
+	where := "v.`type` <> 'delete' AND " + hostedBy
+	if !drafts {
+		where += "AND v.`event_status` = 'posted' "
+	}
+
+	return list(ctx, q, where, "v.`event_date` DESC, e.`id` DESC", []any{clubID, limit, offset})
+}
+
+const hostedBy = "EXISTS (SELECT 1 FROM `EVENTS_TO_CLUBS` ec WHERE ec.`event_id` = e.`id` AND ec.`club_id` = ?) "
+
+// list runs the listing query with where and order filled in, the last two args are
+// the limit and offset
+func list(ctx context.Context, q databaseutils.Querier, where, order string, args []any) ([]*Listed, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT v.`id`, v.`event_id`, v.`author_id`, v.`type`, v.`reverted_from_id`, v.`timestamp`, "+
+			"v.`event_name`, v.`event_img`, v.`event_status`, v.`event_date`, v.`event_end`, v.`location`, v.`description` "+
+			"FROM `EVENTS` e JOIN `EVENT_VERSIONS` v ON v.`id` = e.`current_version_id` "+
+			"WHERE "+where+"ORDER BY "+order+" LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	listed := []*Listed{}
+	byID := map[int64]*Listed{}
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		event := &Listed{ID: version.EventID, ClubIDs: []int64{}, Version: *version}
+		listed = append(listed, event)
+		byID[event.ID] = event
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(listed) == 0 {
+		return listed, nil
+	}
+
+	eventIDs := make([]any, 0, len(listed))
+	for _, event := range listed {
+		eventIDs = append(eventIDs, event.ID)
+	}
+	clubRows, err := q.QueryContext(ctx,
+		"SELECT `event_id`, `club_id` FROM `EVENTS_TO_CLUBS` WHERE `event_id` IN ("+
+			strings.TrimSuffix(strings.Repeat("?, ", len(eventIDs)), ", ")+") ORDER BY `club_id`",
+		eventIDs...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer clubRows.Close()
+	for clubRows.Next() {
+		var eventID, clubID int64
+		if err := clubRows.Scan(&eventID, &clubID); err != nil {
+			return nil, err
+		}
+		byID[eventID].ClubIDs = append(byID[eventID].ClubIDs, clubID)
+	}
+	return listed, clubRows.Err()
+}
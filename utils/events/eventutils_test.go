@@ -0,0 +1,339 @@
+package eventutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+)
+
+// seed adds a club and one eboard member per editor, returning the club and student ids
+func seed(t *testing.T, db *sql.DB, editors int) (int64, []int64) {
+	t.Helper()
+
+	result, err := db.Exec("INSERT INTO `CLUBS` (`club_name`) VALUES ('Girls Who Code')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clubID, _ := result.LastInsertId()
+
+	var studentIDs []int64
+	for i := 0; i < editors; i++ {
+		result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`, `email`) VALUES (?, ?)",
+			fmt.Sprintf("Editor %d", i), fmt.Sprintf("editor%d@myhunter.cuny.edu", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		studentIDs = append(studentIDs, id)
+	}
+	return clubID, studentIDs
+}
+
+func createEvent(t *testing.T, db *sql.DB, clubID, authorID int64) *Event {
+	t.Helper()
+
+	var event *Event
+	err := databaseutils.WithTx(context.Background(), db, func(tx *sql.Tx) (err error) {
+		event, err = Create(context.Background(), tx, authorID, []int64{clubID}, Fields{
+			Name:   strPtr("Intro to Go"),
+			Status: StatusDrafted,
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("creating event: %v", err)
+	}
+	return event
+}
+
+// edit is what the events lambda does for PATCH, lock, check the base and append
+func edit(ctx context.Context, db *sql.DB, eventID, authorID, base int64, change func(*Fields)) error {
+	return databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		event, err := Lock(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		if err := CheckBase(ctx, tx, event, base); err != nil {
+			return err
+		}
+		fields := event.Current.Fields
+		change(&fields)
+		_, err = Append(ctx, tx, event, authorID, TypeEdit, nil, fields)
+		return err
+	})
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestConcurrentEditorsOnlyOneWins(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	const editors = 5
+	clubID, students := seed(t, db, editors)
+	event := createEvent(t, db, clubID, students[0])
+	base := event.Current.ID
+
+	// every editor loaded the event at the same version and saves at the same time
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make([]error, editors)
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = edit(ctx, db, event.ID, students[i], base, func(f *Fields) {
+				f.Name = strPtr(fmt.Sprintf("Intro to Go (editor %d)", i))
+			})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		var stale *StaleError
+		switch {
+		case err == nil:
+			if winner != -1 {
+				t.Fatalf("editors %d and %d both saved on top of version %d", winner, i, base)
+			}
+			winner = i
+		case errors.As(err, &stale):
+			if stale.BaseVersionID != base {
+				t.Errorf("editor %d: stale base = %d, want %d", i, stale.BaseVersionID, base)
+			}
+			if len(stale.Changes) != 1 || stale.Changes[0].Field != "name" {
+				t.Errorf("editor %d: changes = %+v, want only name", i, stale.Changes)
+			}
+		default:
+			t.Fatalf("editor %d: %v", i, err)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("no editor saved")
+	}
+
+	current, err := Get(ctx, db, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("Intro to Go (editor %d)", winner)
+	if *current.Current.Name != want {
+		t.Errorf("name = %q, want the winner's %q", *current.Current.Name, want)
+	}
+
+	versions, err := Versions(ctx, db, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("got %d versions, want the create and one edit", len(versions))
+	}
+}
+
+func TestStaleEditGetsFieldDiff(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	clubID, students := seed(t, db, 2)
+	event := createEvent(t, db, clubID, students[0])
+	base := event.Current.ID
+
+	err := edit(ctx, db, event.ID, students[0], base, func(f *Fields) {
+		f.Location = strPtr("Hunter West 1001")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second editor still has the create version open
+	err = edit(ctx, db, event.ID, students[1], base, func(f *Fields) {
+		f.Name = strPtr("Intro to Go, again")
+	})
+	var stale *StaleError
+	if !errors.As(err, &stale) {
+		t.Fatalf("err = %v, want a *StaleError", err)
+	}
+	want := []Change{{Field: "location", From: nil, To: "Hunter West 1001"}}
+	if fmt.Sprint(stale.Changes) != fmt.Sprint(want) {
+		t.Errorf("changes = %+v, want %+v", stale.Changes, want)
+	}
+
+	// after reloading, the edit goes through on top of the first one
+	err = edit(ctx, db, event.ID, students[1], stale.CurrentVersionID, func(f *Fields) {
+		f.Name = strPtr("Intro to Go, again")
+	})
+	if err != nil {
+		t.Fatalf("edit on the current version: %v", err)
+	}
+	current, err := Get(ctx, db, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *current.Current.Name != "Intro to Go, again" || current.Current.Location == nil {
+		t.Errorf("current = %+v, want both edits", current.Current.Fields)
+	}
+}
+
+func TestLockWaitsForOtherWriter(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	clubID, students := seed(t, db, 2)
+	event := createEvent(t, db, clubID, students[0])
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := Lock(ctx, tx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second writer has to wait for the first to commit and then see its version
+	seen := make(chan int64)
+	go func() {
+		var current int64
+		databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			event, err := Lock(ctx, tx, event.ID)
+			if err == nil {
+				current = event.Current.ID
+			}
+			return err
+		})
+		seen <- current
+	}()
+
+	select {
+	case <-seen:
+		t.Fatal("second Lock returned while the first transaction held the row")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	fields := locked.Current.Fields
+	fields.Name = strPtr("Intro to Go, locked")
+	version, err := Append(ctx, tx, locked, students[0], TypeEdit, nil, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-seen; got != version.ID {
+		t.Errorf("second writer saw version %d, want %d", got, version.ID)
+	}
+}
+
+func TestCheckBaseRejectsOtherEventsVersion(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	clubID, students := seed(t, db, 1)
+	first := createEvent(t, db, clubID, students[0])
+	second := createEvent(t, db, clubID, students[0])
+
+	err := edit(ctx, db, second.ID, students[0], first.Current.ID, func(f *Fields) {})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	start := time.Date(2026, 11, 2, 22, 0, 0, 0, time.UTC)
+	sameInstant := start.In(time.FixedZone("EST", -5*60*60))
+
+	a := Fields{Name: strPtr("Intro to Go"), Status: StatusDrafted, Start: &start}
+	b := Fields{Name: strPtr("Intro to Go"), Status: StatusPosted, Start: &sameInstant, Location: strPtr("HW 1001")}
+
+	got := Diff(a, b)
+	want := []Change{
+		{Field: "status", From: StatusDrafted, To: StatusPosted},
+		{Field: "location", From: nil, To: "HW 1001"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Diff = %+v, want %+v", got, want)
+	}
+
+	if changes := Diff(a, a); len(changes) != 0 {
+		t.Errorf("Diff of equal fields = %+v, want none", changes)
+	}
+}
+
+func TestCohostInvitation(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	hostID, students := seed(t, db, 2)
+	result, err := db.Exec("INSERT INTO `CLUBS` (`club_name`) VALUES ('Hunter ACM')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestID, _ := result.LastInsertId()
+	event := createEvent(t, db, hostID, students[0])
+
+	var invitation *Invitation
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		locked, err := Lock(ctx, tx, event.ID)
+		if err != nil {
+			return err
+		}
+		invitation, err = Invite(ctx, tx, locked, guestID, students[0])
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+
+	accept := func() error {
+		return databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			invitation, locked, err := LockInvitation(ctx, tx, guestID, invitation.ID)
+			if err != nil {
+				return err
+			}
+			return Respond(ctx, tx, invitation, locked, true, students[1])
+		})
+	}
+	if err := accept(); err != nil {
+		t.Fatalf("accepting: %v", err)
+	}
+	if err := accept(); !errors.Is(err, ErrConflict) {
+		t.Errorf("accepting twice = %v, want ErrConflict", err)
+	}
+
+	cohosted, err := ListForClub(ctx, db, guestID, true, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cohosted) != 1 || fmt.Sprint(cohosted[0].ClubIDs) != fmt.Sprint([]int64{hostID, guestID}) {
+		t.Fatalf("guest club events = %+v, want the event hosted by both clubs", cohosted)
+	}
+
+	// the original host can leave now that there's another one, but the guest can't after that
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		locked, err := Lock(ctx, tx, event.ID)
+		if err != nil {
+			return err
+		}
+		if err := RemoveHost(ctx, tx, locked, hostID); err != nil {
+			return err
+		}
+		locked.ClubIDs = []int64{guestID}
+		return RemoveHost(ctx, tx, locked, guestID)
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("removing the last host = %v, want ErrConflict", err)
+	}
+}
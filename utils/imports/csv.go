@@ -0,0 +1,220 @@
+package importutils
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// uploads go under UploadPrefix in the imports bucket, the processing lambda writes
+// each one's report to ReportKey
+const (
+	UploadPrefix = "imports/"
+	ReportPrefix = "reports/"
+)
+
+// ReportKey is where the report for an uploaded file goes, e.g. imports/1-fall.csv is
+// reported in reports/1-fall.csv.json
+func ReportKey(uploadKey string) string {
+	return ReportPrefix + strings.TrimPrefix(uploadKey, UploadPrefix) + ".json"
+}
+
+// ErrHeader is returned when a CSV's header doesn't match MEMBER_FORM_DATA
+var ErrHeader = errors.New("invalid header")
+
+// Columns are the MEMBER_FORM_DATA columns a CSV can fill in, email is required
+var Columns = []string{"email", "full_name", "major", "emplid", "grad_year", "dietary_restrictions", "comments", "join_date"}
+
+// the layouts join_date is accepted in, the form exports use the US style
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"2006-01-02",
+	"1/2/2006",
+}
+
+// Rejected is a CSV line that couldn't be loaded
+type Rejected struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ParseCSV reads a member form export. The header has to name MEMBER_FORM_DATA columns,
+// in any order, and include email. Lines with a value that doesn't fit their column are
+// rejected, everything else is returned to be loaded.
+func ParseCSV(r io.Reader) ([]Row, []Rejected, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // checked below so the line can be reported
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("%w: the file is empty", ErrHeader)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := columnIndex(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := []Row{}
+	rejected := []Rejected{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rejected = append(rejected, Rejected{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			rejected = append(rejected, Rejected{Line: line, Message: fmt.Sprintf("has %d fields, the header has %d", len(record), len(header))})
+			continue
+		}
+		if blank(record) {
+			continue
+		}
+
+		row, err := parseRecord(record, index)
+		if err != nil {
+			rejected = append(rejected, Rejected{Line: line, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, *row)
+	}
+	return rows, rejected, nil
+}
+
+// columnIndex maps each column to its position in the header
+func columnIndex(header []string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, column := range Columns {
+		known[column] = true
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		// spreadsheet apps like to start the file with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !known[name] {
+			return nil, fmt.Errorf("%w: %q isn't one of %s", ErrHeader, name, strings.Join(Columns, ", "))
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("%w: %q is in it twice", ErrHeader, name)
+		}
+		index[name] = i
+	}
+	if _, ok := index["email"]; !ok {
+		return nil, fmt.Errorf("%w: email is required", ErrHeader)
+	}
+	return index, nil
+}
+
+func parseRecord(record []string, index map[string]int) (*Row, error) {
+	field := func(column string) *string {
+		i, ok := index[column]
+		if !ok {
+			return nil
+		}
+		return nullable(strings.TrimSpace(record[i]))
+	}
+
+	row := Row{
+		Email:               field("email"),
+		FullName:            field("full_name"),
+		Major:               field("major"),
+		Emplid:              field("emplid"),
+		DietaryRestrictions: field("dietary_restrictions"),
+		Comments:            field("comments"),
+	}
+	// every text column is VARCHAR(255)
+	for column, value := range map[string]*string{
+		"email": row.Email, "full_name": row.FullName, "major": row.Major, "emplid": row.Emplid,
+		"dietary_restrictions": row.DietaryRestrictions, "comments": row.Comments,
+	} {
+		if value != nil && len(*value) > 255 {
+			return nil, fmt.Errorf("%s can be at most 255 characters", column)
+		}
+	}
+
+	if gradYear := field("grad_year"); gradYear != nil {
+		year, err := strconv.ParseInt(*gradYear, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("grad_year %q isn't a number", *gradYear)
+		}
+		row.GradYear = &year
+	}
+	if joinDate := field("join_date"); joinDate != nil {
+		date, err := parseDate(*joinDate)
+		if err != nil {
+			return nil, err
+		}
+		row.JoinDate = &date
+	}
+	return &row, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("join_date %q isn't a date", value)
+}
+
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Load inserts the rows into MEMBER_FORM_DATA under source, ready for Run. A source
+// that was already loaded is skipped so a redelivered upload isn't loaded twice, the
+// bool reports whether the rows were inserted.
+func Load(ctx context.Context, q databaseutils.Querier, source string, rows []Row) (bool, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM `MEMBER_FORM_DATA` WHERE `source` = ?)", source,
+	).Scan(&exists)
+	if err != nil || exists {
+		return false, err
+	}
+
+	for _, row := range rows {
+		// forms without a date sort by when they were loaded
+		joinDate := time.Now().UTC().Truncate(time.Second)
+		if row.JoinDate != nil {
+			joinDate = *row.JoinDate
+		}
+		_, err := q.ExecContext(ctx,
+			"INSERT INTO `MEMBER_FORM_DATA` (`email`, `full_name`, `major`, `emplid`, `grad_year`, `dietary_restrictions`, `comments`, `join_date`, `source`) "+
+				"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			row.Email, row.FullName, row.Major, row.Emplid, row.GradYear, row.DietaryRestrictions, row.Comments, joinDate, source,
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
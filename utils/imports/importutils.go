@@ -0,0 +1,348 @@
+package importutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+// ErrBusy is returned when another import is already running
+var ErrBusy = errors.New("another import is running")
+
+// imports take this named lock so two of them can't both create the same student
+const importLock = "member_form_import"
+
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusUpdated   Status = "updated"
+	StatusUnchanged Status = "unchanged"
+	// StatusConflict rows need a person to look at them, see Result.Message
+	StatusConflict Status = "conflict"
+)
+
+// Row is a MEMBER_FORM_DATA row as it was submitted
+type Row struct {
+	ID                  int64
+	Email               *string
+	FullName            *string
+	Major               *string
+	Emplid              *string
+	GradYear            *int64
+	DietaryRestrictions *string
+	Comments            *string
+	JoinDate            *time.Time
+}
+
+// Result is what the import did with one row
+type Result struct {
+	RowID     int64  `json:"rowId"`
+	Email     string `json:"email"`
+	Status    Status `json:"status"`
+	StudentID *int64 `json:"studentId,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type Report struct {
+	Created   int      `json:"created"`
+	Updated   int      `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+	Conflicts int      `json:"conflicts"`
+	Rows      []Result `json:"rows"`
+}
+
+func (r *Report) add(result Result) {
+	switch result.Status {
+	case StatusCreated:
+		r.Created++
+	case StatusUpdated:
+		r.Updated++
+	case StatusUnchanged:
+		r.Unchanged++
+	case StatusConflict:
+		r.Conflicts++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+type Options struct {
+	// Source only imports rows from this source, "" imports every pending row
+	Source string `json:"source"`
+	// RetryConflicts looks at rows that were conflicts last time again, e.g. after
+	// they were fixed by hand
+	RetryConflicts bool `json:"retryConflicts"`
+}
+
+// Run imports the pending MEMBER_FORM_DATA rows into STUDENTS and STUDENT_INFO, oldest
+// form first so a newer form for the same student wins. Each row is imported in its
+// own transaction and marked with what happened, so running it again only picks up
+// new rows.
+func Run(ctx context.Context, db *sql.DB, opts Options) (*Report, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 10)", importLock).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if locked.Int64 != 1 {
+		return nil, ErrBusy
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", importLock)
+
+	ids, err := pending(ctx, conn, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := Report{Rows: []Result{}}
+	for _, id := range ids {
+		var result *Result
+		err := databaseutils.WithTx(ctx, conn, func(tx *sql.Tx) error {
+			result, err = importRow(ctx, tx, id, opts.RetryConflicts)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("importing member form row %d: %w", id, err)
+		}
+		if result != nil {
+			report.add(*result)
+		}
+	}
+	return &report, nil
+}
+
+// ImportEmail imports the pending forms with the email in the caller's transaction,
+// oldest first like Run, e.g. when the student signs up and shouldn't have to wait for
+// the next import. Conflicts are left for a person like they are in Run.
+func ImportEmail(ctx context.Context, tx *sql.Tx, email string) ([]Result, error) {
+	ids, err := matches(ctx, tx,
+		"SELECT `id` FROM `MEMBER_FORM_DATA` WHERE `import_status` IS NULL AND LOWER(TRIM(`email`)) = ? "+
+			"ORDER BY `join_date`, `id`", strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, id := range ids {
+		result, err := importRow(ctx, tx, id, false)
+		if err != nil {
+			return nil, fmt.Errorf("importing member form row %d: %w", id, err)
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
+func pending(ctx context.Context, q databaseutils.Querier, opts Options) ([]int64, error) {
+	where := "`import_status` IS NULL"
+	if opts.RetryConflicts {
+		where = "(`import_status` IS NULL OR `import_status` = 'conflict')"
+	}
+	args := []any{}
+	if opts.Source != "" {
+		where += " AND `source` = ?"
+		args = append(args, opts.Source)
+	}
+
+	rows, err := q.QueryContext(ctx,
+		"SELECT `id` FROM `MEMBER_FORM_DATA` WHERE "+where+" ORDER BY `join_date`, `id`", args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// importRow imports one form and records the result on it, nil if the row was handled
+// since it was listed
+func importRow(ctx context.Context, tx *sql.Tx, rowID int64, retryConflicts bool) (*Result, error) {
+	var row Row
+	var status *Status
+	err := tx.QueryRowContext(ctx,
+		"SELECT `id`, `email`, `full_name`, `major`, `emplid`, `grad_year`, `dietary_restrictions`, `comments`, `join_date`, `import_status` "+
+			"FROM `MEMBER_FORM_DATA` WHERE `id` = ? FOR UPDATE",
+		rowID,
+	).Scan(&row.ID, &row.Email, &row.FullName, &row.Major, &row.Emplid, &row.GradYear,
+		&row.DietaryRestrictions, &row.Comments, &row.JoinDate, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != nil && !(retryConflicts && *status == StatusConflict) {
+		return nil, nil
+	}
+
+	result, err := upsert(ctx, tx, &row)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE `MEMBER_FORM_DATA` SET `import_status` = ?, `import_message` = ?, `student_id` = ?, `imported_at` = ? WHERE `id` = ?",
+		result.Status, nullable(result.Message), result.StudentID, time.Now().UTC().Truncate(time.Second), row.ID,
+	)
+	if err != nil || result.Status == StatusConflict {
+		return result, err
+	}
+
+	// the student has the answers sealed now, conflicts keep theirs to be retried
+	_, err = tx.ExecContext(ctx,
+		"UPDATE `MEMBER_FORM_DATA` SET `emplid` = NULL, `dietary_restrictions` = NULL WHERE `id` = ?", row.ID,
+	)
+	return result, err
+}
+
+// upsert finds the row's student by email and emplid, then creates or updates them
+func upsert(ctx context.Context, tx *sql.Tx, row *Row) (*Result, error) {
+	result := Result{RowID: row.ID, Email: strings.TrimSpace(deref(row.Email))}
+	conflict := func(format string, args ...any) (*Result, error) {
+		result.Status, result.Message = StatusConflict, fmt.Sprintf(format, args...)
+		return &result, nil
+	}
+
+	f, err := normalize(row)
+	if err != nil {
+		return conflict("%v", err)
+	}
+	result.Email = f.Email
+
+	byEmail, err := matches(ctx, tx,
+		"SELECT `id` FROM `STUDENTS` WHERE LOWER(`email`) = ? ORDER BY `id` LIMIT 2 FOR UPDATE", f.Email)
+	if err != nil {
+		return nil, err
+	}
+	if len(byEmail) > 1 {
+		return conflict("students %d and %d both have this email", byEmail[0], byEmail[1])
+	}
+	var byEmplid []int64
+	if f.Emplid != nil {
+		index, err := studentutils.EmplidIndex(ctx, *f.Emplid)
+		if err != nil {
+			return nil, err
+		}
+		byEmplid, err = matches(ctx, tx,
+			"SELECT `student_id` FROM `STUDENT_INFO` WHERE `emplid_index` = ? OR `emplid` = ? "+
+				"ORDER BY `student_id` LIMIT 2 FOR UPDATE", index, *f.Emplid)
+		if err != nil {
+			return nil, err
+		}
+		if len(byEmplid) > 1 {
+			return conflict("students %d and %d both have this emplid", byEmplid[0], byEmplid[1])
+		}
+	}
+
+	switch {
+	case len(byEmail) == 0 && len(byEmplid) == 0:
+		return create(ctx, tx, f, result)
+	case len(byEmail) == 0:
+		// changing the email would break the student's sign in, which is matched by email
+		return conflict("emplid belongs to student %d, who has a different email", byEmplid[0])
+	case len(byEmplid) == 1 && byEmplid[0] != byEmail[0]:
+		return conflict("email belongs to student %d but emplid belongs to student %d", byEmail[0], byEmplid[0])
+	}
+
+	profile, err := studentutils.Get(ctx, tx, byEmail[0])
+	if err != nil {
+		return nil, err
+	}
+	result.StudentID = &profile.ID
+	if profile.Emplid != nil && f.Emplid != nil && *profile.Emplid != *f.Emplid {
+		return conflict("student %d already has a different emplid", profile.ID)
+	}
+
+	if !merge(profile, f) {
+		result.Status = StatusUnchanged
+		return &result, nil
+	}
+	if err := studentutils.Save(ctx, tx, profile); err != nil {
+		return nil, err
+	}
+	result.Status = StatusUpdated
+	return &result, nil
+}
+
+func create(ctx context.Context, tx *sql.Tx, f *form, result Result) (*Result, error) {
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO `STUDENTS` (`first_name`, `last_name`, `email`) VALUES (?, ?, ?)",
+		f.FirstName, f.LastName, f.Email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := studentutils.Profile{ID: id}
+	merge(&profile, f)
+	if err := studentutils.Save(ctx, tx, &profile); err != nil {
+		return nil, err
+	}
+	result.Status, result.StudentID = StatusCreated, &id
+	return &result, nil
+}
+
+// merge copies the form's answers onto the profile, blank answers leave what's there.
+// It reports whether anything changed.
+func merge(profile *studentutils.Profile, f *form) bool {
+	changed := false
+	set := func(dst **string, src *string) {
+		if src != nil && (*dst == nil || **dst != *src) {
+			*dst, changed = src, true
+		}
+	}
+	set(&profile.FirstName, f.FirstName)
+	set(&profile.LastName, f.LastName)
+	set(&profile.Major, f.Major)
+	set(&profile.Emplid, f.Emplid)
+	set(&profile.DietaryRestrictions, f.DietaryRestrictions)
+	set(&profile.Comments, f.Comments)
+	if f.GradYear != nil && (profile.GradYear == nil || *profile.GradYear != *f.GradYear) {
+		profile.GradYear, changed = f.GradYear, true
+	}
+	return changed
+}
+
+func matches(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
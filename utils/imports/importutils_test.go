@@ -0,0 +1,177 @@
+package importutils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"cdk-infrastructure/utils/database/testdb"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct{ in, first, last string }{
+		{"  ada   lovelace ", "Ada", "Lovelace"},
+		{"MARIA DE LA CRUZ", "Maria", "De La Cruz"},
+		{"shannon o'brien-smith", "Shannon", "O'Brien-Smith"},
+		{"Ronald McDonald", "Ronald", "McDonald"},
+		{"Cher", "Cher", ""},
+		{"   ", "", ""},
+	}
+	for _, tt := range tests {
+		first, last := SplitName(tt.in)
+		if first != tt.first || last != tt.last {
+			t.Errorf("SplitName(%q) = %q, %q, want %q, %q", tt.in, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if email, err := NormalizeEmail("  Ada.Lovelace@MyHunter.CUNY.edu "); err != nil || email != "ada.lovelace@myhunter.cuny.edu" {
+		t.Errorf("NormalizeEmail = %q, %v", email, err)
+	}
+	for _, bad := range []string{"", "not an email", "Ada <ada@example.com>"} {
+		if _, err := NormalizeEmail(bad); err == nil {
+			t.Errorf("NormalizeEmail(%q) should fail", bad)
+		}
+	}
+
+	if emplid, err := NormalizeEmplid(" 2345-6789 "); err != nil || emplid != "23456789" {
+		t.Errorf("NormalizeEmplid = %q, %v", emplid, err)
+	}
+	if _, err := NormalizeEmplid("2345678x"); err == nil {
+		t.Error("NormalizeEmplid should reject letters")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	csv := "\ufeffEmail, Full_Name,grad_year,join_date\n" +
+		"ada@example.com,Ada Lovelace,2027,9/1/2026 10:00:00\n" +
+		",,,\n" +
+		"grace@example.com,Grace Hopper,soon,\n" +
+		"katherine@example.com,Katherine Johnson\n" +
+		"mary@example.com,Mary Jackson,,2026-09-02\n"
+
+	rows, rejected, err := ParseCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || *rows[0].Email != "ada@example.com" || *rows[0].GradYear != 2027 || rows[1].GradYear != nil {
+		t.Errorf("rows = %+v", rows)
+	}
+	if rows[0].JoinDate == nil || rows[0].JoinDate.Format("2006-01-02 15:04") != "2026-09-01 10:00" {
+		t.Errorf("join date = %v", rows[0].JoinDate)
+	}
+	if len(rejected) != 2 || rejected[0].Line != 4 || rejected[1].Line != 5 {
+		t.Errorf("rejected = %+v, want lines 4 and 5", rejected)
+	}
+
+	for _, header := range []string{"", "full_name,major\n", "email,phone\n", "email,email\n"} {
+		if _, _, err := ParseCSV(strings.NewReader(header)); !errors.Is(err, ErrHeader) {
+			t.Errorf("ParseCSV(%q): err = %v, want ErrHeader", header, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	if _, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`, `last_name`, `email`) VALUES ('Grace', 'Hopper', 'grace@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec("INSERT INTO `MEMBER_FORM_DATA` (`email`, `full_name`, `major`, `emplid`, `grad_year`, `join_date`, `source`) VALUES " +
+		"('ADA@example.com ', 'ada lovelace', 'CS', '1234-5678', 2027, '2026-09-01 10:00:00', 'fall.csv'), " +
+		"('ada@example.com', 'Ada Lovelace', 'Math', NULL, NULL, '2026-09-02 10:00:00', 'fall.csv'), " +
+		"('grace@example.com', 'Grace Hopper', NULL, '12345678', NULL, '2026-09-03 10:00:00', 'fall.csv'), " +
+		"('grace@example.com', 'Grace Hopper', NULL, NULL, NULL, '2026-09-04 10:00:00', 'fall.csv'), " +
+		"('not-an-email', 'Someone', NULL, NULL, NULL, '2026-09-05 10:00:00', 'fall.csv'), " +
+		"('other@example.com', 'Other', NULL, NULL, NULL, '2026-09-05 10:00:00', 'spring.csv')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(ctx, db, Options{Source: "fall.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Status{StatusCreated, StatusUpdated, StatusConflict, StatusUnchanged, StatusConflict}
+	if len(report.Rows) != len(want) {
+		t.Fatalf("report has %d rows, want %d: %+v", len(report.Rows), len(want), report.Rows)
+	}
+	for i, status := range want {
+		if report.Rows[i].Status != status {
+			t.Errorf("row %d is %s (%s), want %s", i, report.Rows[i].Status, report.Rows[i].Message, status)
+		}
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Unchanged != 1 || report.Conflicts != 2 {
+		t.Errorf("counts = %+v", report)
+	}
+
+	// the emplid is sealed, so ada is read back through her profile
+	var adaID int64
+	if err := db.QueryRow("SELECT `id` FROM `STUDENTS` WHERE `email` = 'ada@example.com'").Scan(&adaID); err != nil {
+		t.Fatal(err)
+	}
+	ada, err := studentutils.Get(ctx, db, adaID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *ada.FirstName != "Ada" || *ada.Major != "Math" || ada.Emplid == nil || *ada.Emplid != "12345678" {
+		t.Errorf("ada = %s, %s, %v, want the newer form's major and the older form's emplid", *ada.FirstName, *ada.Major, ada.Emplid)
+	}
+
+	// the answers are on the students now, only conflicts keep theirs to be retried
+	var plaintext int
+	err = db.QueryRow("SELECT COUNT(*) FROM `MEMBER_FORM_DATA` WHERE `emplid` IS NOT NULL AND `import_status` <> 'conflict'").Scan(&plaintext)
+	if err != nil || plaintext != 0 {
+		t.Errorf("imported rows with an emplid = %d, %v, want 0", plaintext, err)
+	}
+	var kept string
+	err = db.QueryRow("SELECT `emplid` FROM `MEMBER_FORM_DATA` WHERE `import_status` = 'conflict' AND `emplid` IS NOT NULL").Scan(&kept)
+	if err != nil || kept != "12345678" {
+		t.Errorf("conflict emplid = %q, %v, want it kept", kept, err)
+	}
+
+	// handled rows are skipped the second time
+	report, err = Run(ctx, db, Options{Source: "fall.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 0 {
+		t.Errorf("second run imported %+v", report.Rows)
+	}
+	report, err = Run(ctx, db, Options{Source: "fall.csv", RetryConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Conflicts != 2 || len(report.Rows) != 2 {
+		t.Errorf("retrying conflicts = %+v", report)
+	}
+	// signing up imports the student's pending forms from any source
+	if _, err := db.Exec("INSERT INTO `STUDENTS` (`email`) VALUES ('other@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+	importEmail := func() []Result {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		results, err := ImportEmail(ctx, tx, " Other@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+	if results := importEmail(); len(results) != 1 || results[0].Status != StatusUpdated {
+		t.Errorf("ImportEmail = %+v, want the spring form to update the student", results)
+	}
+	if results := importEmail(); len(results) != 0 {
+		t.Errorf("ImportEmail again = %+v, want nothing pending", results)
+	}
+}
@@ -0,0 +1,145 @@
+package importutils
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// STUDENTS.first_name and last_name are VARCHAR(50)
+const maxNameLength = 50
+
+// form is a MEMBER_FORM_DATA row after normalizing, nil fields weren't filled in
+type form struct {
+	Email               string
+	FirstName           *string
+	LastName            *string
+	Major               *string
+	Emplid              *string
+	GradYear            *int64
+	DietaryRestrictions *string
+	Comments            *string
+}
+
+// normalize cleans up a row the way a person would before typing it in, the error
+// says why the row can't be imported
+func normalize(row *Row) (*form, error) {
+	email, err := NormalizeEmail(deref(row.Email))
+	if err != nil {
+		return nil, err
+	}
+	f := form{
+		Email:               email,
+		Major:               clean(row.Major),
+		DietaryRestrictions: clean(row.DietaryRestrictions),
+		Comments:            clean(row.Comments),
+	}
+
+	first, last := SplitName(deref(row.FullName))
+	if utf8.RuneCountInString(first) > maxNameLength || utf8.RuneCountInString(last) > maxNameLength {
+		return nil, fmt.Errorf("names can be at most %d characters", maxNameLength)
+	}
+	f.FirstName, f.LastName = nullable(first), nullable(last)
+
+	if row.Emplid != nil {
+		emplid, err := NormalizeEmplid(*row.Emplid)
+		if err != nil {
+			return nil, err
+		}
+		f.Emplid = nullable(emplid)
+	}
+
+	if row.GradYear != nil {
+		if *row.GradYear < 1900 || *row.GradYear > 2100 {
+			return nil, fmt.Errorf("grad year %d isn't a year", *row.GradYear)
+		}
+		f.GradYear = row.GradYear
+	}
+	return &f, nil
+}
+
+// NormalizeEmail trims and lowercases the address, it has to be a bare address
+// without a display name
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", fmt.Errorf("email is required")
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("%q isn't an email address", email)
+	}
+	return email, nil
+}
+
+// NormalizeEmplid strips the spaces and dashes people type into an emplid, what's
+// left has to be digits. An empty emplid is returned as "".
+func NormalizeEmplid(emplid string) (string, error) {
+	emplid = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return r
+	}, emplid)
+	for _, r := range emplid {
+		if r < '0' || r > '9' {
+			return "", errors.New("emplids can only have digits")
+		}
+	}
+	return emplid, nil
+}
+
+// SplitName splits a full name into a first name and everything after it, e.g.
+// "maria  de la cruz" is "Maria" and "De La Cruz". Names typed in one case are
+// capitalized, mixed case is left alone so "McDonald" stays as it is.
+func SplitName(fullName string) (first, last string) {
+	words := strings.Fields(fullName)
+	if len(words) == 0 {
+		return "", ""
+	}
+
+	name := strings.Join(words, " ")
+	if name == strings.ToLower(name) || name == strings.ToUpper(name) {
+		for i, word := range words {
+			words[i] = capitalize(word)
+		}
+	}
+	return words[0], strings.Join(words[1:], " ")
+}
+
+// capitalize uppercases the first letter of the word and of each part after a hyphen
+// or apostrophe, e.g. o'brien-smith is O'Brien-Smith
+func capitalize(word string) string {
+	runes := []rune(strings.ToLower(word))
+	for i := range runes {
+		if i == 0 || runes[i-1] == '-' || runes[i-1] == '\'' {
+			runes[i] = unicode.ToUpper(runes[i])
+		}
+	}
+	return string(runes)
+}
+
+// clean collapses the whitespace in a free text field, blank is nil
+func clean(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	return nullable(strings.Join(strings.Fields(*s), " "))
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,57 @@
+package metricutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Namespace is where every metric from this app goes in CloudWatch
+const Namespace = "GWC"
+
+// Emit writes the values as one CloudWatch embedded metric format log line. Lambda
+// sends stdout to CloudWatch Logs, which turns the line into metrics, so there's no
+// PutMetricData call or permission needed. Every value is a Count.
+func Emit(dimensions map[string]string, values map[string]float64) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, map[string]string{"Name": name, "Unit": "Count"})
+	}
+	dimensionNames := make([]string, 0, len(dimensions))
+	for name := range dimensions {
+		dimensionNames = append(dimensionNames, name)
+	}
+	sort.Strings(dimensionNames)
+
+	line := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]any{{
+				"Namespace":  Namespace,
+				"Dimensions": [][]string{dimensionNames},
+				"Metrics":    metrics,
+			}},
+		},
+	}
+	for name, value := range dimensions {
+		line[name] = value
+	}
+	for name, value := range values {
+		line[name] = value
+	}
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(b))
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -11,7 +12,13 @@ import (
 //
 // It assumes that your migration files are under a folder "migrations" in the current working directory.
 func RunMigration(db *sql.DB, filename string) error {
-	fileBytes, err := os.ReadFile("migrations/" + filename)
+	return RunMigrationFrom(db, "migrations", filename)
+}
+
+// RunMigrationFrom is RunMigration with the migrations folder given, e.g. for tests that
+// apply lambda/database/init/migrations from another package.
+func RunMigrationFrom(db *sql.DB, dir string, filename string) error {
+	fileBytes, err := os.ReadFile(filepath.Join(dir, filename))
 	if err != nil {
 		log.Printf("Failed to read migration file %s: %v", filename, err)
 		return err
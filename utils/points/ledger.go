@@ -0,0 +1,153 @@
+package pointutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+const (
+	maxReasonLength = 500
+	// the idempotency_key column is VARCHAR(191), leave room for the prefix Adjust adds
+	maxKeyLength = 128
+)
+
+var (
+	ErrInsufficient = errors.New("not enough points")
+	ErrConflict     = errors.New("idempotency key was already used for a different change")
+)
+
+// Entry is one row of a student's points ledger. Amounts are append only, a mistake is
+// fixed with another entry. A merge does rewrite rows: member_id moves to the survivor
+// and points_after_gain is recomputed by Rebalance.
+type Entry struct {
+	ID            int64     `json:"id"`
+	StudentID     int64     `json:"studentId"`
+	Points        int64     `json:"points"`
+	BalanceAfter  int64     `json:"balanceAfter"`
+	PointSourceID *int64    `json:"pointSourceId"`
+	Reason        *string   `json:"reason"`
+	ActorID       *int64    `json:"actorId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Posting is a change to a student's balance
+type Posting struct {
+	StudentID     int64
+	Points        int64
+	PointSourceID *int64
+	Reason        string
+	ActorID       *int64
+	// IdempotencyKey makes retries safe, posting a key that's already in the ledger
+	// returns that entry instead of adding another one
+	IdempotencyKey string
+}
+
+// Post appends to the student's ledger and reports whether a new entry was added. q
+// should be a transaction, the student's row stays locked until it ends. A posting
+// that would take the balance below zero fails with ErrInsufficient.
+func Post(ctx context.Context, q databaseutils.Querier, p Posting) (*Entry, bool, error) {
+	if err := lockStudent(ctx, q, p.StudentID); err != nil {
+		return nil, false, err
+	}
+
+	if p.IdempotencyKey != "" {
+		existing, err := byKey(ctx, q, p.IdempotencyKey)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			if existing.StudentID != p.StudentID || existing.Points != p.Points {
+				return nil, false, ErrConflict
+			}
+			return existing, false, nil
+		}
+	}
+
+	balance, err := Balance(ctx, q, p.StudentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if p.Points < 0 && balance+p.Points < 0 {
+		return nil, false, fmt.Errorf("%w: the balance is %d", ErrInsufficient, balance)
+	}
+
+	entry := Entry{
+		StudentID:     p.StudentID,
+		Points:        p.Points,
+		BalanceAfter:  balance + p.Points,
+		PointSourceID: p.PointSourceID,
+		Reason:        nullable(p.Reason),
+		ActorID:       p.ActorID,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO `POINT_HISTORIES` "+
+			"(`member_id`, `point_source_id`, `points_earned`, `points_after_gain`, `timestamp`, `idempotency_key`, `reason`, `actor_id`) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.StudentID, entry.PointSourceID, entry.Points, entry.BalanceAfter, entry.CreatedAt,
+		nullable(p.IdempotencyKey), entry.Reason, entry.ActorID,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return nil, false, err
+	}
+	return &entry, true, nil
+}
+
+// History returns the student's ledger, newest first
+func History(ctx context.Context, q databaseutils.Querier, studentID, limit, offset int64) ([]Entry, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT "+entryColumns+" FROM `POINT_HISTORIES` WHERE `member_id` = ? ORDER BY `id` DESC LIMIT ? OFFSET ?",
+		studentID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+const entryColumns = "`id`, `member_id`, `points_earned`, `points_after_gain`, `point_source_id`, `reason`, `actor_id`, `timestamp`"
+
+func scanEntry(row interface{ Scan(...any) error }) (*Entry, error) {
+	var entry Entry
+	err := row.Scan(&entry.ID, &entry.StudentID, &entry.Points, &entry.BalanceAfter,
+		&entry.PointSourceID, &entry.Reason, &entry.ActorID, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func byKey(ctx context.Context, q databaseutils.Querier, key string) (*Entry, error) {
+	entry, err := scanEntry(q.QueryRowContext(ctx,
+		"SELECT "+entryColumns+" FROM `POINT_HISTORIES` WHERE `idempotency_key` = ?", key,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,157 @@
+package pointutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+var (
+	ErrNotFound = errors.New("point source not found")
+	ErrInvalid  = errors.New("invalid")
+)
+
+type Source struct {
+	ID     int64   `json:"id"`
+	Title  *string `json:"title"`
+	Points int64   `json:"points"`
+}
+
+// Sources lists every point source
+func Sources(ctx context.Context, q databaseutils.Querier) ([]Source, error) {
+	rows, err := q.QueryContext(ctx, "SELECT `id`, `title`, COALESCE(`points`, 0) FROM `POINT_SOURCES` ORDER BY `title`, `id`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []Source{}
+	for rows.Next() {
+		var source Source
+		if err := rows.Scan(&source.ID, &source.Title, &source.Points); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// GetSource loads one point source
+func GetSource(ctx context.Context, q databaseutils.Querier, sourceID int64) (*Source, error) {
+	var source Source
+	err := q.QueryRowContext(ctx,
+		"SELECT `id`, `title`, COALESCE(`points`, 0) FROM `POINT_SOURCES` WHERE `id` = ?", sourceID,
+	).Scan(&source.ID, &source.Title, &source.Points)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return &source, err
+}
+
+// CreateSource adds a point source, e.g. "General meeting" worth 10 points
+func CreateSource(ctx context.Context, q databaseutils.Querier, title string, points int64) (*Source, error) {
+	if title == "" || len(title) > 255 {
+		return nil, fmt.Errorf("%w: title is required and can be at most 255 characters", ErrInvalid)
+	}
+	if points <= 0 {
+		return nil, fmt.Errorf("%w: points must be positive", ErrInvalid)
+	}
+
+	result, err := q.ExecContext(ctx, "INSERT INTO `POINT_SOURCES` (`title`, `points`) VALUES (?, ?)", title, points)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Source{ID: id, Title: &title, Points: points}, nil
+}
+
+// Balance is the sum of the student's ledger
+func Balance(ctx context.Context, q databaseutils.Querier, studentID int64) (int64, error) {
+	var balance int64
+	err := q.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(`points_earned`), 0) FROM `POINT_HISTORIES` WHERE `member_id` = ?", studentID,
+	).Scan(&balance)
+	return balance, err
+}
+
+// lockStudent locks the student's STUDENTS row, everything that changes a balance
+// takes this lock first so points_after_gain is right even with concurrent writes
+func lockStudent(ctx context.Context, q databaseutils.Querier, studentID int64) error {
+	var id int64
+	err := q.QueryRowContext(ctx, "SELECT `id` FROM `STUDENTS` WHERE `id` = ? FOR UPDATE", studentID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: student %d doesn't exist", ErrInvalid, studentID)
+	}
+	return err
+}
+
+// Award gives the student the source's points. The key should identify why, e.g.
+// "checkin:<eventId>:<studentId>", so awarding twice for the same reason is a no-op.
+func Award(ctx context.Context, q databaseutils.Querier, studentID, sourceID int64, key string) (*Entry, bool, error) {
+	source, err := GetSource(ctx, q, sourceID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reason := ""
+	if source.Title != nil {
+		reason = *source.Title
+	}
+	return Post(ctx, q, Posting{
+		StudentID:      studentID,
+		Points:         source.Points,
+		PointSourceID:  &source.ID,
+		Reason:         reason,
+		IdempotencyKey: key,
+	})
+}
+
+// Adjust is an admin correcting a balance, points is negative to take points away.
+// key comes from the client so a retried request doesn't adjust twice.
+func Adjust(ctx context.Context, q databaseutils.Querier, studentID, actorID, points int64, reason, key string) (*Entry, bool, error) {
+	if points == 0 {
+		return nil, false, fmt.Errorf("%w: points can't be 0", ErrInvalid)
+	}
+	if reason == "" || len(reason) > maxReasonLength {
+		return nil, false, fmt.Errorf("%w: a reason is required and can be at most %d characters", ErrInvalid, maxReasonLength)
+	}
+	if key == "" || len(key) > maxKeyLength {
+		return nil, false, fmt.Errorf("%w: an idempotency key is required and can be at most %d characters", ErrInvalid, maxKeyLength)
+	}
+
+	return Post(ctx, q, Posting{
+		StudentID: studentID,
+		Points:    points,
+		Reason:    reason,
+		ActorID:   &actorID,
+		// namespaced so a client key can't collide with one of ours or another student's
+		IdempotencyKey: fmt.Sprintf("adjust:%d:%s", studentID, key),
+	})
+}
+
+// Rebalance rewrites the student's points_after_gain chain, and the balance stored on
+// the purchases paid from it, after entries were moved onto the student from someone
+// else's ledger. q should be a transaction that already locked the student.
+func Rebalance(ctx context.Context, q databaseutils.Querier, studentID int64) error {
+	_, err := q.ExecContext(ctx,
+		"UPDATE `POINT_HISTORIES` AS `h` JOIN ("+running+" WHERE `member_id` = ?) AS `r` ON `r`.`id` = `h`.`id` "+
+			"SET `h`.`points_after_gain` = `r`.`expected`",
+		studentID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx,
+		"UPDATE `PURCHASES` AS p JOIN `POINT_HISTORIES` AS h ON h.`id` = p.`ledger_entry_id` "+
+			"SET p.`points_after_purchase` = h.`points_after_gain` WHERE p.`member_id` = ?",
+		studentID,
+	)
+	return err
+}
@@ -0,0 +1,159 @@
+package pointutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+)
+
+func TestLedger(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES ('Ada')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	studentID, _ := result.LastInsertId()
+	result, err = db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES ('Grace')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminID, _ := result.LastInsertId()
+	source, err := CreateSource(ctx, db, "General meeting", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inTx := func(fn func(tx *sql.Tx) error) error {
+		return databaseutils.WithTx(ctx, db, fn)
+	}
+
+	// the same source can be earned for different reasons, but each reason only once
+	for _, key := range []string{"checkin:1:1", "checkin:2:1", "checkin:1:1"} {
+		if err := inTx(func(tx *sql.Tx) error {
+			_, _, err := Award(ctx, tx, studentID, source.ID, key)
+			return err
+		}); err != nil {
+			t.Fatalf("Award(%s): %v", key, err)
+		}
+	}
+	if balance, _ := Balance(ctx, db, studentID); balance != 20 {
+		t.Fatalf("balance = %d, want 20", balance)
+	}
+
+	err = inTx(func(tx *sql.Tx) error {
+		_, _, err := Adjust(ctx, tx, studentID, adminID, -25, "Typo in the sign in sheet", "a")
+		return err
+	})
+	if !errors.Is(err, ErrInsufficient) {
+		t.Errorf("overdrawing adjustment: err = %v, want ErrInsufficient", err)
+	}
+
+	var added bool
+	for range 2 {
+		if err := inTx(func(tx *sql.Tx) error {
+			_, added, err = Adjust(ctx, tx, studentID, adminID, -5, "Typo in the sign in sheet", "b")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if added {
+		t.Error("retried adjustment was added again")
+	}
+
+	err = inTx(func(tx *sql.Tx) error {
+		_, _, err := Adjust(ctx, tx, studentID, adminID, 5, "Different change", "b")
+		return err
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("reused key: err = %v, want ErrConflict", err)
+	}
+
+	history, err := History(ctx, db, studentID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ points, after int64 }{{-5, 15}, {10, 20}, {10, 10}}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		if history[i].Points != w.points || history[i].BalanceAfter != w.after {
+			t.Errorf("history[%d] = %+d -> %d, want %+d -> %d", i, history[i].Points, history[i].BalanceAfter, w.points, w.after)
+		}
+	}
+	if history[0].ActorID == nil || *history[0].ActorID != adminID {
+		t.Errorf("adjustment actor = %v, want %d", history[0].ActorID, adminID)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES ('Ada')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	studentID, _ := result.LastInsertId()
+	for i, points := range []int64{10, 5, -3} {
+		err := databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			_, _, err := Adjust(ctx, tx, studentID, studentID, points, "Setup", string(rune('a'+i)))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Verify(ctx, db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entries != 3 || len(report.Discrepancies) != 0 {
+		t.Fatalf("clean ledger: report = %+v", report)
+	}
+
+	// drift the middle row and add a purchase nothing paid for
+	if _, err := db.Exec("UPDATE `POINT_HISTORIES` SET `points_after_gain` = 99 WHERE `member_id` = ? AND `points_earned` = 5", studentID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO `PURCHASES` (`member_id`, `item_title`, `points_cost`, `points_after_purchase`, `timestamp`) VALUES (?, 'Mug', 4, 8, NOW())", studentID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Verify(ctx, db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]Discrepancy{}
+	for _, d := range report.Discrepancies {
+		kinds[d.Kind] = d
+	}
+	if len(report.Discrepancies) != 2 {
+		t.Fatalf("discrepancies = %+v, want 2", report.Discrepancies)
+	}
+	drift, ok := kinds[KindLedgerBalance]
+	if !ok || drift.Stored != 99 || drift.Expected != 15 || drift.Repair == "" {
+		t.Errorf("ledger drift = %+v, want 99 stored, 15 expected and a repair", drift)
+	}
+	if _, ok := kinds[KindUnpaidPurchase]; !ok {
+		t.Errorf("unpaid purchase wasn't reported: %+v", report.Discrepancies)
+	}
+
+	if _, err := db.Exec(drift.Repair); err != nil {
+		t.Fatalf("repair %q: %v", drift.Repair, err)
+	}
+	if report, err = Verify(ctx, db, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Repair != "" {
+		t.Errorf("after repair = %+v, want just the unpaid purchase without a repair", report.Discrepancies)
+	}
+}
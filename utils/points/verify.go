@@ -0,0 +1,137 @@
+package pointutils
+
+import (
+	"context"
+	"fmt"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// Kinds of Discrepancy
+const (
+	// KindLedgerBalance is a POINT_HISTORIES row whose points_after_gain isn't the running sum
+	KindLedgerBalance = "ledger_balance"
+	// KindNegativeBalance is a ledger row that left the student below zero
+	KindNegativeBalance = "negative_balance"
+	// KindPurchaseBalance is a purchase whose points_after_purchase doesn't match its ledger entry
+	KindPurchaseBalance = "purchase_balance"
+	// KindPurchaseCost is a purchase that cost a different amount than its ledger entry took
+	KindPurchaseCost = "purchase_cost"
+	// KindUnpaidPurchase is a purchase with no ledger entry paying for it
+	KindUnpaidPurchase = "unpaid_purchase"
+)
+
+// Discrepancy is one stored value that doesn't match what the ledger adds up to
+type Discrepancy struct {
+	Kind       string `json:"kind"`
+	StudentID  int64  `json:"studentId"`
+	EntryID    int64  `json:"entryId,omitempty"`
+	PurchaseID int64  `json:"purchaseId,omitempty"`
+	Stored     int64  `json:"stored"`
+	Expected   int64  `json:"expected"`
+	// Repair is the statement that would fix the stored value, empty when it needs a
+	// person to look at it. Verify never runs it.
+	Repair string `json:"repair,omitempty"`
+}
+
+// Report is what Verify found
+type Report struct {
+	Students      int64         `json:"students"`
+	Entries       int64         `json:"entries"`
+	Purchases     int64         `json:"purchases"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// running recomputes every student's balance chain, in the same order the ledger
+// migration used, so each row has the balance it should have been written with
+const running = "SELECT `id`, `member_id`, `points_earned`, `points_after_gain`, " +
+	"SUM(`points_earned`) OVER (PARTITION BY `member_id` ORDER BY `timestamp`, `id`) AS `expected` " +
+	"FROM `POINT_HISTORIES`"
+
+// Verify checks the stored balances in POINT_HISTORIES and PURCHASES against the
+// ledger. It only reads, withRepairs fills in Discrepancy.Repair for a dry run.
+func Verify(ctx context.Context, q databaseutils.Querier, withRepairs bool) (*Report, error) {
+	report := Report{Discrepancies: []Discrepancy{}}
+	err := q.QueryRowContext(ctx,
+		"SELECT COUNT(DISTINCT `member_id`), COUNT(*), (SELECT COUNT(*) FROM `PURCHASES`) FROM `POINT_HISTORIES`",
+	).Scan(&report.Students, &report.Entries, &report.Purchases)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ledgerDiscrepancies(ctx, q, withRepairs, &report); err != nil {
+		return nil, err
+	}
+	if err := purchaseDiscrepancies(ctx, q, withRepairs, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ledgerDiscrepancies finds the ledger rows with the wrong running balance
+func ledgerDiscrepancies(ctx context.Context, q databaseutils.Querier, withRepairs bool, report *Report) error {
+	rows, err := q.QueryContext(ctx,
+		"SELECT `id`, `member_id`, `points_after_gain`, `expected` FROM ("+running+") AS `l` "+
+			"WHERE `points_after_gain` <> `expected` OR `expected` < 0 ORDER BY `member_id`, `id`",
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := Discrepancy{Kind: KindLedgerBalance}
+		if err := rows.Scan(&d.EntryID, &d.StudentID, &d.Stored, &d.Expected); err != nil {
+			return err
+		}
+		if d.Stored == d.Expected {
+			// the stored value is right, the ledger itself went below zero
+			d.Kind = KindNegativeBalance
+		} else if withRepairs {
+			d.Repair = fmt.Sprintf("UPDATE `POINT_HISTORIES` SET `points_after_gain` = %d WHERE `id` = %d;", d.Expected, d.EntryID)
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+	return rows.Err()
+}
+
+// purchaseDiscrepancies finds purchases that don't agree with the ledger entry that paid for them
+func purchaseDiscrepancies(ctx context.Context, q databaseutils.Querier, withRepairs bool, report *Report) error {
+	purchases, err := q.QueryContext(ctx,
+		"SELECT p.`id`, p.`member_id`, COALESCE(p.`points_cost`, 0), COALESCE(p.`points_after_purchase`, 0), "+
+			"l.`id` IS NOT NULL, COALESCE(-l.`points_earned`, 0), COALESCE(l.`expected`, 0) "+
+			"FROM `PURCHASES` p LEFT JOIN ("+running+") AS `l` ON `l`.`id` = p.`ledger_entry_id` "+
+			"WHERE l.`id` IS NULL OR p.`points_cost` <> -l.`points_earned` OR p.`points_after_purchase` <> l.`expected` "+
+			"ORDER BY p.`member_id`, p.`id`",
+	)
+	if err != nil {
+		return err
+	}
+	defer purchases.Close()
+	for purchases.Next() {
+		var purchaseID, studentID, cost, after, paid, expected int64
+		var linked bool
+		if err := purchases.Scan(&purchaseID, &studentID, &cost, &after, &linked, &paid, &expected); err != nil {
+			return err
+		}
+
+		switch {
+		case !linked:
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind: KindUnpaidPurchase, StudentID: studentID, PurchaseID: purchaseID, Stored: cost,
+			})
+			continue
+		case cost != paid:
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind: KindPurchaseCost, StudentID: studentID, PurchaseID: purchaseID, Stored: cost, Expected: paid,
+			})
+		}
+		if after != expected {
+			d := Discrepancy{Kind: KindPurchaseBalance, StudentID: studentID, PurchaseID: purchaseID, Stored: after, Expected: expected}
+			if withRepairs {
+				d.Repair = fmt.Sprintf("UPDATE `PURCHASES` SET `points_after_purchase` = %d WHERE `id` = %d;", expected, purchaseID)
+			}
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+	}
+	return purchases.Err()
+}
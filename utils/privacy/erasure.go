@@ -0,0 +1,180 @@
+package privacyutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+var (
+	ErrNotFound = errors.New("student not found")
+	ErrConflict = errors.New("conflict")
+
+	// ErrAlreadyErased is the ErrConflict returned by Erase for a student that was
+	// erased before
+	ErrAlreadyErased = fmt.Errorf("%w: the student was already erased", ErrConflict)
+)
+
+// Erasure is a request to erase a student, pending until ErasedAt is set
+type Erasure struct {
+	ID          int64            `json:"id"`
+	StudentID   int64            `json:"studentId"`
+	RequestedAt time.Time        `json:"requestedAt"`
+	RequestedBy *int64           `json:"requestedBy"`
+	ErasedAt    *time.Time       `json:"erasedAt"`
+	ErasedBy    *int64           `json:"erasedBy"`
+	Details     map[string]int64 `json:"details,omitempty"`
+
+	// CognitoSub is only set by Erase, it's the sign in account to delete from the
+	// user pool. It isn't stored anywhere.
+	CognitoSub *string `json:"cognitoSub,omitempty"`
+}
+
+const selectErasures = "SELECT `id`, `student_id`, `requested_at`, `requested_by`, `erased_at`, `erased_by`, `details` FROM `STUDENT_ERASURES` "
+
+func scanErasure(row interface{ Scan(...any) error }) (*Erasure, error) {
+	var e Erasure
+	var details []byte
+	if err := row.Scan(&e.ID, &e.StudentID, &e.RequestedAt, &e.RequestedBy, &e.ErasedAt, &e.ErasedBy, &details); err != nil {
+		return nil, err
+	}
+	if details != nil {
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &e, nil
+}
+
+// RequestErasure records that the student asked to be erased and reports whether the
+// request is new, asking again returns the first request
+func RequestErasure(ctx context.Context, q databaseutils.Querier, studentID, requestedBy int64) (*Erasure, bool, error) {
+	result, err := q.ExecContext(ctx,
+		"INSERT IGNORE INTO `STUDENT_ERASURES` (`student_id`, `requested_at`, `requested_by`) VALUES (?, ?, ?)",
+		studentID, time.Now().UTC().Truncate(time.Second), requestedBy,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	erasure, err := scanErasure(q.QueryRowContext(ctx, selectErasures+"WHERE `student_id` = ?", studentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, ErrNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return erasure, inserted == 1, nil
+}
+
+// Erasures lists requests oldest first, only the ones still pending unless all is set
+func Erasures(ctx context.Context, q databaseutils.Querier, all bool, limit, offset int64) ([]*Erasure, error) {
+	query := selectErasures
+	if !all {
+		query += "WHERE `erased_at` IS NULL "
+	}
+	rows, err := q.QueryContext(ctx, query+"ORDER BY `requested_at`, `id` LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	erasures := []*Erasure{}
+	for rows.Next() {
+		erasure, err := scanErasure(rows)
+		if err != nil {
+			return nil, err
+		}
+		erasures = append(erasures, erasure)
+	}
+	return erasures, rows.Err()
+}
+
+// erasures are the statements that remove the student's personal data, keyed by what
+// goes in Erasure.Details. Each ? is the student id. The ledger, purchases and
+// check-ins stay, they only hold the student's id and the balances have to add up.
+var erasures = []struct{ name, query string }{
+	// matched on email too, like Export, so responses that were never imported go as well
+	{"MEMBER_FORM_DATA", "UPDATE `MEMBER_FORM_DATA` SET `email` = NULL, `full_name` = NULL, `major` = NULL, `emplid` = NULL, " +
+		"`grad_year` = NULL, `dietary_restrictions` = NULL, `comments` = NULL, `import_message` = 'erased' " +
+		"WHERE `student_id` = ? OR (`student_id` IS NULL AND " +
+		"LOWER(TRIM(`email`)) = (SELECT LOWER(TRIM(`email`)) FROM `STUDENTS` WHERE `id` = ?))"},
+	{"STUDENT_INFO", "DELETE FROM `STUDENT_INFO` WHERE `student_id` = ?"},
+	{"STUDENTS_TO_INTERESTS", "DELETE FROM `STUDENTS_TO_INTERESTS` WHERE `student_id` = ?"},
+	{"CLUB_MEMBERS", "DELETE FROM `CLUB_MEMBERS` WHERE `student_id` = ?"},
+	{"EVENT_RSVPS", "DELETE FROM `EVENT_RSVPS` WHERE `student_id` = ?"},
+	// the snapshots of merged duplicates are the student's data too
+	{"STUDENT_MERGES", "UPDATE `STUDENT_MERGES` SET `details` = '{\"erased\": true}' WHERE `survivor_id` = ? OR `merged_id` = ?"},
+	// the student's entries keep the actor id, like the ledger
+	{"AUDIT_LOG", "UPDATE `AUDIT_LOG` SET `before` = NULL, `after` = NULL WHERE `entity` = 'student' AND `entity_id` IN " +
+		"(SELECT `id` FROM `STUDENTS` WHERE `id` = ? OR `merged_into_id` = ?)"},
+	{"AUDIT_LOG.actor_sub", "UPDATE `AUDIT_LOG` SET `actor_sub` = NULL WHERE `actor_id` IN " +
+		"(SELECT `id` FROM `STUDENTS` WHERE `id` = ? OR `merged_into_id` = ?)"},
+	{"STUDENTS", "UPDATE `STUDENTS` SET `first_name` = NULL, `last_name` = NULL, `email` = NULL, `cognito_sub` = NULL, " +
+		"`erased_at` = UTC_TIMESTAMP() WHERE `id` = ? OR `merged_into_id` = ?"},
+}
+
+// Erase anonymizes the student, with or without a request from them. q should be a
+// transaction. Removing a confirmed RSVP doesn't promote anyone, the waitlist moves
+// the next time someone answers.
+func Erase(ctx context.Context, q databaseutils.Querier, studentID, actorID int64) (*Erasure, error) {
+	var cognitoSub *string
+	var erasedAt *time.Time
+	err := q.QueryRowContext(ctx,
+		"SELECT `cognito_sub`, `erased_at` FROM `STUDENTS` WHERE `id` = ? FOR UPDATE", studentID,
+	).Scan(&cognitoSub, &erasedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if erasedAt != nil {
+		return nil, ErrAlreadyErased
+	}
+
+	details := map[string]int64{}
+	for _, erasure := range erasures {
+		args := make([]any, strings.Count(erasure.query, "?"))
+		for i := range args {
+			args[i] = studentID
+		}
+		result, err := q.ExecContext(ctx, erasure.query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("erasing %s: %w", erasure.name, err)
+		}
+		details[erasure.name], _ = result.RowsAffected()
+	}
+
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO `STUDENT_ERASURES` (`student_id`, `requested_at`, `requested_by`, `erased_at`, `erased_by`, `details`) "+
+			"VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE `erased_at` = VALUES(`erased_at`), "+
+			"`erased_by` = VALUES(`erased_by`), `details` = VALUES(`details`)",
+		studentID, now, actorID, now, actorID, string(encoded),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	erasure, err := scanErasure(q.QueryRowContext(ctx, selectErasures+"WHERE `student_id` = ?", studentID))
+	if err != nil {
+		return nil, err
+	}
+	erasure.CognitoSub = cognitoSub
+	return erasure, nil
+}
@@ -0,0 +1,132 @@
+package privacyutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+// ExportPrefix is where archives go in the exports bucket, one folder per student
+const ExportPrefix = "exports/"
+
+// ArchiveKey is where the student's archive exported at t is stored
+func ArchiveKey(studentID int64, t time.Time) string {
+	return fmt.Sprintf("%s%d/%s.json", ExportPrefix, studentID, t.UTC().Format("20060102T150405Z"))
+}
+
+// Archive is everything the database holds about one student
+type Archive struct {
+	StudentID  int64                 `json:"studentId"`
+	ExportedAt time.Time             `json:"exportedAt"`
+	Profile    *studentutils.Profile `json:"profile"`
+	// Tables has the student's rows of every table that refers to them, with every
+	// column, keyed by table name
+	Tables map[string][]map[string]any `json:"tables"`
+}
+
+// exports are the queries behind Archive.Tables. Most select every column so one
+// added later shows up in the export without touching this. Each ? is the student id.
+var exports = []struct{ name, query string }{
+	{"STUDENTS", "SELECT * FROM `STUDENTS` WHERE `id` = ? OR `merged_into_id` = ?"},
+	{"STUDENT_INFO", "SELECT * FROM `STUDENT_INFO` WHERE `student_id` = ?"},
+	{"STUDENTS_TO_INTERESTS", "SELECT si.*, i.`label` FROM `STUDENTS_TO_INTERESTS` si JOIN `INTERESTS` i ON i.`id` = si.`interest_id` WHERE si.`student_id` = ?"},
+	{"CLUB_MEMBERS", "SELECT m.*, c.`club_name` FROM `CLUB_MEMBERS` m JOIN `CLUBS` c ON c.`id` = m.`club_id` WHERE m.`student_id` = ?"},
+	{"EVENT_RSVPS", "SELECT * FROM `EVENT_RSVPS` WHERE `student_id` = ? ORDER BY `responded_at`"},
+	{"EVENT_CHECKINS", "SELECT * FROM `EVENT_CHECKINS` WHERE `student_id` = ? ORDER BY `checked_in_at`"},
+	{"POINT_HISTORIES", "SELECT * FROM `POINT_HISTORIES` WHERE `member_id` = ? ORDER BY `id`"},
+	{"PURCHASES", "SELECT * FROM `PURCHASES` WHERE `member_id` = ? ORDER BY `id`"},
+	{"EVENT_VERSIONS", "SELECT * FROM `EVENT_VERSIONS` WHERE `author_id` = ? ORDER BY `id`"},
+	{"EVENT_COHOST_INVITATIONS", "SELECT * FROM `EVENT_COHOST_INVITATIONS` WHERE `invited_by` = ? OR `responded_by` = ? ORDER BY `id`"},
+	// form responses that were never imported are matched on email
+	{"MEMBER_FORM_DATA", "SELECT * FROM `MEMBER_FORM_DATA` WHERE `student_id` = ? OR (`student_id` IS NULL AND " +
+		"LOWER(TRIM(`email`)) = (SELECT LOWER(TRIM(`email`)) FROM `STUDENTS` WHERE `id` = ?)) ORDER BY `id`"},
+	{"STUDENT_MERGES", "SELECT * FROM `STUDENT_MERGES` WHERE `survivor_id` = ? OR `merged_id` = ? ORDER BY `id`"},
+	{"STUDENT_ERASURES", "SELECT * FROM `STUDENT_ERASURES` WHERE `student_id` = ?"},
+	// what they did, but not the before and after, which is mostly other people's data
+	{"AUDIT_LOG", "SELECT `id`, `action`, `entity`, `entity_id`, `status`, `created_at` FROM `AUDIT_LOG` " +
+		"WHERE `actor_id` = ? ORDER BY `id`"},
+}
+
+// Export collects the student's archive
+func Export(ctx context.Context, q databaseutils.Querier, studentID int64) (*Archive, error) {
+	profile, err := studentutils.Get(ctx, q, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := Archive{
+		StudentID:  studentID,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Profile:    profile,
+		Tables:     map[string][]map[string]any{},
+	}
+	for _, export := range exports {
+		args := make([]any, strings.Count(export.query, "?"))
+		for i := range args {
+			args[i] = studentID
+		}
+		rows, err := queryMaps(ctx, q, export.query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", export.name, err)
+		}
+		archive.Tables[export.name] = rows
+	}
+
+	// the profile has the decrypted values of the sealed columns
+	for _, row := range archive.Tables["STUDENT_INFO"] {
+		row["emplid"], row["dietary_restrictions"] = nullable(profile.Emplid), nullable(profile.DietaryRestrictions)
+		for _, column := range []string{"emplid_ciphertext", "emplid_index", "dietary_restrictions_ciphertext"} {
+			delete(row, column)
+		}
+	}
+	return &archive, nil
+}
+
+// queryMaps returns each row as a map of column name to value
+func queryMaps(ctx context.Context, q databaseutils.Querier, query string, args ...any) ([]map[string]any, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	maps := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			// text comes back as bytes, which would be base64 in the json
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		maps = append(maps, row)
+	}
+	return maps, rows.Err()
+}
+
+// nullable is the value queryMaps would have for the column
+func nullable(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
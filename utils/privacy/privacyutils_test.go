@@ -0,0 +1,114 @@
+package privacyutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+	pointutils "cdk-infrastructure/utils/points"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+func TestExportAndErase(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	insert := func(query string, args ...any) int64 {
+		t.Helper()
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+	student := "INSERT INTO `STUDENTS` (`first_name`, `last_name`, `email`, `cognito_sub`) VALUES (?, ?, ?, ?)"
+	ada := insert(student, "Ada", "Lovelace", "ada@myhunter.cuny.edu", "sub-ada")
+	admin := insert(student, "Admin", "Istrator", "admin@myhunter.cuny.edu", "sub-admin")
+	insert("INSERT INTO `STUDENT_INFO` (`student_id`, `emplid`, `dietary_restrictions`) VALUES (?, '12345678', 'vegan')", ada)
+	club := insert("INSERT INTO `CLUBS` (`club_name`) VALUES ('GWC')")
+	insert("INSERT INTO `CLUB_MEMBERS` (`student_id`, `club_id`, `role`) VALUES (?, ?, 'member')", ada, club)
+	insert("INSERT INTO `MEMBER_FORM_DATA` (`email`, `full_name`, `emplid`, `source`) VALUES ('ADA@myhunter.cuny.edu', 'Ada Lovelace', '12345678', 'test')")
+
+	inTx := func(fn func(tx *sql.Tx) error) error {
+		return databaseutils.WithTx(ctx, db, fn)
+	}
+	if err := inTx(func(tx *sql.Tx) error {
+		_, _, err := pointutils.Adjust(ctx, tx, ada, admin, 25, "Welcome bonus", "welcome")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := Export(ctx, db, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *archive.Profile.Email != "ada@myhunter.cuny.edu" {
+		t.Errorf("Profile = %+v", archive.Profile)
+	}
+	for table, want := range map[string]int{"STUDENT_INFO": 1, "CLUB_MEMBERS": 1, "POINT_HISTORIES": 1, "MEMBER_FORM_DATA": 1, "PURCHASES": 0} {
+		if got := len(archive.Tables[table]); got != want {
+			t.Errorf("len(Tables[%s]) = %d, want %d", table, got, want)
+		}
+	}
+	if got := archive.Tables["STUDENT_INFO"][0]["dietary_restrictions"]; got != "vegan" {
+		t.Errorf("dietary_restrictions = %#v, want the text", got)
+	}
+
+	request, added, err := RequestErasure(ctx, db, ada, ada)
+	if err != nil || !added {
+		t.Fatalf("RequestErasure = %v, %v, want a new request", added, err)
+	}
+	if again, added, err := RequestErasure(ctx, db, ada, ada); err != nil || added || again.ID != request.ID {
+		t.Errorf("RequestErasure again = %+v, %v, %v, want the first request", again, added, err)
+	}
+	pending, err := Erasures(ctx, db, false, 10, 0)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Erasures = %v, %v, want the pending request", pending, err)
+	}
+
+	var erasure *Erasure
+	if err := inTx(func(tx *sql.Tx) error {
+		erasure, err = Erase(ctx, tx, ada, admin)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if erasure.ErasedAt == nil || erasure.CognitoSub == nil || *erasure.CognitoSub != "sub-ada" || erasure.RequestedBy == nil || *erasure.RequestedBy != ada {
+		t.Errorf("Erase = %+v, want the request completed with the cognito sub", erasure)
+	}
+	if erasure.Details["STUDENT_INFO"] != 1 || erasure.Details["MEMBER_FORM_DATA"] != 1 {
+		t.Errorf("Details = %v", erasure.Details)
+	}
+
+	profile, err := studentutils.Get(ctx, db, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.FirstName != nil || profile.Email != nil || profile.Emplid != nil {
+		t.Errorf("profile = %+v, want everything gone", profile)
+	}
+	var forms int
+	if err := db.QueryRow("SELECT COUNT(*) FROM `MEMBER_FORM_DATA` WHERE `emplid` IS NOT NULL OR `email` IS NOT NULL").Scan(&forms); err != nil || forms != 0 {
+		t.Errorf("member forms with pii = %d, %v, want 0", forms, err)
+	}
+
+	// the ledger is still there and still adds up
+	if balance, err := pointutils.Balance(ctx, db, ada); err != nil || balance != 25 {
+		t.Errorf("Balance = %d, %v, want 25", balance, err)
+	}
+
+	if err := inTx(func(tx *sql.Tx) error {
+		_, err := Erase(ctx, tx, ada, admin)
+		return err
+	}); !errors.Is(err, ErrConflict) {
+		t.Errorf("erasing twice = %v, want ErrConflict", err)
+	}
+	if pending, err := Erasures(ctx, db, false, 10, 0); err != nil || len(pending) != 0 {
+		t.Errorf("Erasures = %v, %v, want none pending", pending, err)
+	}
+}
@@ -0,0 +1,61 @@
+package publicutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// The lambdas that change events are in the vpc, which has no route to CloudFront.
+// They hand invalidations to the function in PUBLIC_INVALIDATOR_NAME, which runs
+// outside it, through the lambda vpc endpoint.
+
+// InvalidateRequest is the payload of the invalidator function
+type InvalidateRequest struct {
+	// Reason ends up in the invalidator's logs, e.g. "event 7 published"
+	Reason string `json:"reason"`
+}
+
+// the client is kept for the life of the container like the database pool
+var (
+	once      sync.Once
+	client    *lambda.Client
+	clientErr error
+)
+
+// Invalidate asks the invalidator to clear Paths from the cache. It doesn't wait for
+// it, so it returns as soon as the request is queued. Without PUBLIC_INVALIDATOR_NAME
+// it does nothing, the cache then catches up within its max TTL.
+func Invalidate(ctx context.Context, reason string) error {
+	name := os.Getenv("PUBLIC_INVALIDATOR_NAME")
+	if name == "" {
+		return nil
+	}
+
+	once.Do(func() {
+		var cfg aws.Config
+		cfg, clientErr = config.LoadDefaultConfig(ctx)
+		client = lambda.NewFromConfig(cfg)
+	})
+	if clientErr != nil {
+		return clientErr
+	}
+
+	payload, _ := json.Marshal(InvalidateRequest{Reason: reason})
+	_, err := client.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName:   aws.String(name),
+		InvocationType: types.InvocationTypeEvent,
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("invoking %s: %w", name, err)
+	}
+	return nil
+}
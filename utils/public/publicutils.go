@@ -0,0 +1,145 @@
+package publicutils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	calendarutils "cdk-infrastructure/utils/calendar"
+	eventutils "cdk-infrastructure/utils/events"
+)
+
+// The public feeds are for partner sites to embed, nobody signs in to read them. They
+// only have posted events and leave out everything that isn't on the event's page, like
+// authors and version ids.
+
+// Paths is what ClubEventApiCdn caches, and what Invalidate clears
+const Paths = "/public/*"
+
+// Host is a club hosting a public event
+type Host struct {
+	ID   int64   `json:"id"`
+	Name *string `json:"name"`
+}
+
+// Event is a posted event as the public feeds show it
+type Event struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end"`
+	Location    *string    `json:"location"`
+	Description *string    `json:"description"`
+	Hosts       []Host     `json:"hosts"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// Events turns listed events into public ones, with the hosts' names from clubNames
+func Events(listed []*eventutils.Listed, clubNames map[int64]*string) []Event {
+	public := make([]Event, 0, len(listed))
+	for _, l := range listed {
+		if l.Type == eventutils.TypeDelete || l.Status != eventutils.StatusPosted || l.Name == nil || l.Start == nil {
+			continue // ListPosted doesn't return these, this keeps it that way
+		}
+		event := Event{
+			ID:          l.ID,
+			Name:        *l.Name,
+			Start:       *l.Start,
+			End:         l.End,
+			Location:    l.Location,
+			Description: l.Description,
+			Hosts:       []Host{},
+			UpdatedAt:   l.Timestamp,
+		}
+		for _, clubID := range l.ClubIDs {
+			event.Hosts = append(event.Hosts, Host{ID: clubID, Name: clubNames[clubID]})
+		}
+		public = append(public, event)
+	}
+	return public
+}
+
+type rss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel channel  `xml:"channel"`
+}
+
+type channel struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	TTL         int    `xml:"ttl"`
+	Items       []item `xml:"item"`
+}
+
+type item struct {
+	Title       string   `xml:"title"`
+	Description string   `xml:"description"`
+	GUID        guid     `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+}
+
+type guid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS writes the events as an RSS 2.0 feed, link is where the feed is read from. Each
+// item says when and where the event is ahead of its description, feed readers only
+// show the item.
+func RSS(link string, events []Event) ([]byte, error) {
+	feed := rss{Version: "2.0", Channel: channel{
+		Title:       "Upcoming club events",
+		Link:        link,
+		Description: "Posted events hosted by our clubs",
+		TTL:         5,
+		Items:       []item{},
+	}}
+	for _, event := range events {
+		it := item{
+			Title:       event.Name,
+			Description: summary(event),
+			GUID:        guid{Value: fmt.Sprintf("event-%d", event.ID)},
+			PubDate:     event.UpdatedAt.UTC().Format(time.RFC1123Z),
+		}
+		for _, host := range event.Hosts {
+			if host.Name != nil {
+				it.Categories = append(it.Categories, *host.Name)
+			}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, it)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// summary is e.g. "Fri, Oct 30, 6:00 PM to 8:00 PM at Room 1001\n\nBring a laptop"
+func summary(event Event) string {
+	start := event.Start.In(calendarutils.Location)
+	when := start.Format("Mon, Jan 2, 3:04 PM")
+	if event.End != nil {
+		end := event.End.In(calendarutils.Location)
+		if end.YearDay() == start.YearDay() && end.Year() == start.Year() {
+			when += " to " + end.Format("3:04 PM")
+		} else {
+			when += " to " + end.Format("Mon, Jan 2, 3:04 PM")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(when)
+	if event.Location != nil && *event.Location != "" {
+		b.WriteString(" at " + *event.Location)
+	}
+	if event.Description != nil && *event.Description != "" {
+		b.WriteString("\n\n" + *event.Description)
+	}
+	return b.String()
+}
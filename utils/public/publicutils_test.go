@@ -0,0 +1,75 @@
+package publicutils
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	eventutils "cdk-infrastructure/utils/events"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestEvents(t *testing.T) {
+	start := time.Date(2026, 10, 30, 22, 0, 0, 0, time.UTC)
+	posted := eventutils.Fields{Name: strPtr("Intro to Go"), Status: eventutils.StatusPosted, Start: &start}
+	draft := posted
+	draft.Status = eventutils.StatusDrafted
+
+	listed := []*eventutils.Listed{
+		{ID: 7, ClubIDs: []int64{3, 4}, Version: eventutils.Version{Type: eventutils.TypeEdit, Fields: posted}},
+		{ID: 8, ClubIDs: []int64{3}, Version: eventutils.Version{Type: eventutils.TypeEdit, Fields: draft}},
+		{ID: 9, ClubIDs: []int64{3}, Version: eventutils.Version{Type: eventutils.TypeDelete, Fields: posted}},
+	}
+	public := Events(listed, map[int64]*string{3: strPtr("Girls Who Code")})
+
+	if len(public) != 1 || public[0].ID != 7 {
+		t.Fatalf("Events = %+v, want only event 7", public)
+	}
+	hosts := public[0].Hosts
+	if len(hosts) != 2 || *hosts[0].Name != "Girls Who Code" || hosts[1].ID != 4 || hosts[1].Name != nil {
+		t.Errorf("hosts = %+v", hosts)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	start := time.Date(2026, 11, 6, 23, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	body, err := RSS("https://example.cloudfront.net/public/events", []Event{{
+		ID:          7,
+		Name:        "Hack night <3 & pizza",
+		Start:       start,
+		End:         &end,
+		Location:    strPtr("Room 1001"),
+		Description: strPtr("Bring a laptop"),
+		Hosts:       []Host{{ID: 3, Name: strPtr("Girls Who Code")}},
+		UpdatedAt:   updated,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feed rss
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("feed doesn't parse: %v\n%s", err, body)
+	}
+	if feed.Version != "2.0" || len(feed.Channel.Items) != 1 {
+		t.Fatalf("feed = %+v", feed)
+	}
+	got := feed.Channel.Items[0]
+	want := item{
+		Title:       "Hack night <3 & pizza",
+		Description: "Fri, Nov 6, 6:00 PM to 8:00 PM at Room 1001\n\nBring a laptop",
+		GUID:        guid{Value: "event-7"},
+		PubDate:     "Thu, 01 Oct 2026 12:00:00 +0000",
+		Categories:  []string{"Girls Who Code"},
+	}
+	if got.Title != want.Title || got.Description != want.Description || got.GUID != want.GUID ||
+		got.PubDate != want.PubDate || len(got.Categories) != 1 || got.Categories[0] != want.Categories[0] {
+		t.Errorf("item = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,247 @@
+package rewardutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+// the idempotency_key column is VARCHAR(191), leave room for the prefix Buy adds
+const maxKeyLength = 128
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusFulfilled Status = "fulfilled"
+	StatusRefunded  Status = "refunded"
+)
+
+type Purchase struct {
+	ID         int64  `json:"id"`
+	StudentID  int64  `json:"studentId"`
+	RewardID   *int64 `json:"rewardId"` // nil for purchases from before the catalog
+	ClubID     *int64 `json:"clubId"`
+	Title      string `json:"title"`
+	PointsCost int64  `json:"pointsCost"`
+	// BalanceAfter is the student's balance right after paying
+	BalanceAfter int64      `json:"balanceAfter"`
+	Status       Status     `json:"status"`
+	HandledBy    *int64     `json:"handledBy"`
+	HandledAt    *time.Time `json:"handledAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+const selectPurchases = "SELECT p.`id`, p.`member_id`, p.`reward_id`, r.`club_id`, COALESCE(p.`item_title`, ''), " +
+	"COALESCE(p.`points_cost`, 0), COALESCE(p.`points_after_purchase`, 0), p.`status`, p.`handled_by`, p.`handled_at`, p.`timestamp` " +
+	"FROM `PURCHASES` p LEFT JOIN `REWARDS` r ON r.`id` = p.`reward_id` "
+
+func scanPurchase(row interface{ Scan(...any) error }) (*Purchase, error) {
+	var purchase Purchase
+	err := row.Scan(&purchase.ID, &purchase.StudentID, &purchase.RewardID, &purchase.ClubID, &purchase.Title,
+		&purchase.PointsCost, &purchase.BalanceAfter, &purchase.Status, &purchase.HandledBy, &purchase.HandledAt, &purchase.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+// GetPurchase loads one purchase
+func GetPurchase(ctx context.Context, q databaseutils.Querier, purchaseID int64) (*Purchase, error) {
+	return getPurchase(ctx, q, "p.`id` = ?", purchaseID, "")
+}
+
+func getPurchase(ctx context.Context, q databaseutils.Querier, where string, arg any, suffix string) (*Purchase, error) {
+	purchase, err := scanPurchase(q.QueryRowContext(ctx, selectPurchases+"WHERE "+where+suffix, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: purchase", ErrNotFound)
+	}
+	return purchase, err
+}
+
+// PurchaseFilter narrows Purchases, zero values are ignored
+type PurchaseFilter struct {
+	StudentID int64
+	ClubID    int64
+	Status    Status
+	Limit     int64
+	Offset    int64
+}
+
+// Purchases lists purchases newest first
+func Purchases(ctx context.Context, q databaseutils.Querier, filter PurchaseFilter) ([]*Purchase, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	if filter.StudentID != 0 {
+		where = append(where, "p.`member_id` = ?")
+		args = append(args, filter.StudentID)
+	}
+	if filter.ClubID != 0 {
+		where = append(where, "r.`club_id` = ?")
+		args = append(args, filter.ClubID)
+	}
+	if filter.Status != "" {
+		where = append(where, "p.`status` = ?")
+		args = append(args, filter.Status)
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := q.QueryContext(ctx,
+		selectPurchases+"WHERE "+strings.Join(where, " AND ")+" ORDER BY p.`id` DESC LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purchases := []*Purchase{}
+	for rows.Next() {
+		purchase, err := scanPurchase(rows)
+		if err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, purchase)
+	}
+	return purchases, rows.Err()
+}
+
+// Buy spends the student's points on the reward and takes one out of stock, all in
+// q's transaction. key identifies the request so a retry returns the first purchase
+// instead of buying twice, the bool reports whether a new purchase was made.
+func Buy(ctx context.Context, q databaseutils.Querier, rewardID, studentID int64, key string) (*Purchase, bool, error) {
+	if key == "" || len(key) > maxKeyLength {
+		return nil, false, fmt.Errorf("%w: an idempotency key is required and can be at most %d characters", ErrInvalid, maxKeyLength)
+	}
+
+	reward, err := Lock(ctx, q, rewardID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// pointutils takes the student's lock, a key it has seen before means this is a retry
+	entry, added, err := pointutils.Post(ctx, q, pointutils.Posting{
+		StudentID:      studentID,
+		Points:         -reward.PointsCost,
+		Reason:         "Purchased " + reward.Title,
+		IdempotencyKey: fmt.Sprintf("buy:%d:%s", studentID, key),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !added {
+		purchase, err := getPurchase(ctx, q, "p.`ledger_entry_id` = ?", entry.ID, "")
+		return purchase, false, err
+	}
+
+	// returning an error rolls the ledger entry back with everything else
+	if !reward.Active {
+		return nil, false, fmt.Errorf("%w: reward isn't available", ErrConflict)
+	}
+	if reward.Stock != nil {
+		if *reward.Stock <= 0 {
+			return nil, false, ErrSoldOut
+		}
+		if _, err := q.ExecContext(ctx, "UPDATE `REWARDS` SET `stock` = `stock` - 1 WHERE `id` = ?", reward.ID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	purchase := Purchase{
+		StudentID:    studentID,
+		RewardID:     &reward.ID,
+		ClubID:       reward.ClubID,
+		Title:        reward.Title,
+		PointsCost:   reward.PointsCost,
+		BalanceAfter: entry.BalanceAfter,
+		Status:       StatusPending,
+		CreatedAt:    entry.CreatedAt,
+	}
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO `PURCHASES` (`member_id`, `item_title`, `points_cost`, `points_after_purchase`, `timestamp`, `reward_id`, `ledger_entry_id`, `status`) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		purchase.StudentID, purchase.Title, purchase.PointsCost, purchase.BalanceAfter, purchase.CreatedAt,
+		purchase.RewardID, entry.ID, purchase.Status,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if purchase.ID, err = result.LastInsertId(); err != nil {
+		return nil, false, err
+	}
+	return &purchase, true, nil
+}
+
+// Fulfill marks a pending purchase as handed out
+func Fulfill(ctx context.Context, q databaseutils.Querier, purchaseID, actorID int64) (*Purchase, error) {
+	purchase, err := lockPending(ctx, q, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	return purchase, handle(ctx, q, purchase, StatusFulfilled, actorID)
+}
+
+// Refund gives the student their points back and puts the reward back in stock. Only
+// pending purchases can be refunded, once it's fulfilled the student has the reward.
+func Refund(ctx context.Context, q databaseutils.Querier, purchaseID, actorID int64) (*Purchase, error) {
+	purchase, err := lockPending(ctx, q, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// same lock order as Buy, the reward then the student
+	if purchase.RewardID != nil {
+		reward, err := Lock(ctx, q, *purchase.RewardID)
+		if err != nil {
+			return nil, err
+		}
+		if reward.Stock != nil {
+			if _, err := q.ExecContext(ctx, "UPDATE `REWARDS` SET `stock` = `stock` + 1 WHERE `id` = ?", reward.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, _, err = pointutils.Post(ctx, q, pointutils.Posting{
+		StudentID:      purchase.StudentID,
+		Points:         purchase.PointsCost,
+		Reason:         "Refunded " + purchase.Title,
+		ActorID:        &actorID,
+		IdempotencyKey: fmt.Sprintf("refund:%d", purchase.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purchase, handle(ctx, q, purchase, StatusRefunded, actorID)
+}
+
+// lockPending loads the purchase, locks it and its reward, and checks it's still pending
+func lockPending(ctx context.Context, q databaseutils.Querier, purchaseID int64) (*Purchase, error) {
+	purchase, err := getPurchase(ctx, q, "p.`id` = ?", purchaseID, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if purchase.Status != StatusPending {
+		return nil, fmt.Errorf("%w: purchase was already %s", ErrConflict, purchase.Status)
+	}
+	return purchase, nil
+}
+
+func handle(ctx context.Context, q databaseutils.Querier, purchase *Purchase, status Status, actorID int64) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := q.ExecContext(ctx,
+		"UPDATE `PURCHASES` SET `status` = ?, `handled_by` = ?, `handled_at` = ? WHERE `id` = ?",
+		status, actorID, now, purchase.ID,
+	)
+	if err != nil {
+		return err
+	}
+	purchase.Status, purchase.HandledBy, purchase.HandledAt = status, &actorID, &now
+	return nil
+}
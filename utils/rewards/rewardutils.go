@@ -0,0 +1,187 @@
+package rewardutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid")
+	ErrSoldOut  = errors.New("reward is sold out")
+	// ErrConflict is returned when a purchase isn't in a state that allows the change,
+	// e.g. refunding something that was already handed out
+	ErrConflict = errors.New("conflict")
+)
+
+type Reward struct {
+	ID          int64     `json:"id"`
+	ClubID      *int64    `json:"clubId"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	PointsCost  int64     `json:"pointsCost"`
+	Stock       *int64    `json:"stock"` // nil for unlimited
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Fields are the parts of a reward its managers can change, nil fields are left as they are
+type Fields struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	PointsCost  *int64  `json:"pointsCost"`
+	Stock       *int64  `json:"stock"`
+	// Unlimited clears the stock count
+	Unlimited bool  `json:"unlimited"`
+	Active    *bool `json:"active"`
+}
+
+// apply validates the fields and copies them onto the reward
+func (f Fields) apply(reward *Reward) error {
+	if f.Title != nil {
+		title := strings.TrimSpace(*f.Title)
+		if title == "" || len(title) > 255 {
+			return fmt.Errorf("%w: title is required and can be at most 255 characters", ErrInvalid)
+		}
+		reward.Title = title
+	}
+	if f.Description != nil {
+		reward.Description = f.Description
+	}
+	if f.PointsCost != nil {
+		if *f.PointsCost <= 0 {
+			return fmt.Errorf("%w: pointsCost must be positive", ErrInvalid)
+		}
+		reward.PointsCost = *f.PointsCost
+	}
+	if f.Stock != nil && f.Unlimited {
+		return fmt.Errorf("%w: stock and unlimited can't both be set", ErrInvalid)
+	}
+	if f.Stock != nil {
+		if *f.Stock < 0 {
+			return fmt.Errorf("%w: stock can't be negative", ErrInvalid)
+		}
+		reward.Stock = f.Stock
+	}
+	if f.Unlimited {
+		reward.Stock = nil
+	}
+	if f.Active != nil {
+		reward.Active = *f.Active
+	}
+	return nil
+}
+
+const selectRewards = "SELECT `id`, `club_id`, `title`, `description`, `points_cost`, `stock`, `active`, `created_at` FROM `REWARDS` "
+
+func scanReward(row interface{ Scan(...any) error }) (*Reward, error) {
+	var reward Reward
+	err := row.Scan(&reward.ID, &reward.ClubID, &reward.Title, &reward.Description,
+		&reward.PointsCost, &reward.Stock, &reward.Active, &reward.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// Get loads one reward
+func Get(ctx context.Context, q databaseutils.Querier, rewardID int64) (*Reward, error) {
+	return get(ctx, q, rewardID, "")
+}
+
+// Lock loads the reward and locks its row until the transaction ends, purchases and
+// refunds take it so the stock count can't be oversold
+func Lock(ctx context.Context, q databaseutils.Querier, rewardID int64) (*Reward, error) {
+	return get(ctx, q, rewardID, " FOR UPDATE")
+}
+
+func get(ctx context.Context, q databaseutils.Querier, rewardID int64, suffix string) (*Reward, error) {
+	reward, err := scanReward(q.QueryRowContext(ctx, selectRewards+"WHERE `id` = ?"+suffix, rewardID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: reward %d", ErrNotFound, rewardID)
+	}
+	return reward, err
+}
+
+// Filter narrows List
+type Filter struct {
+	// ClubID only returns the club's rewards
+	ClubID int64
+	// IncludeInactive also returns rewards that can't be bought right now
+	IncludeInactive bool
+}
+
+// List returns the catalog, cheapest first
+func List(ctx context.Context, q databaseutils.Querier, filter Filter) ([]*Reward, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	if filter.ClubID != 0 {
+		where = append(where, "`club_id` = ?")
+		args = append(args, filter.ClubID)
+	}
+	if !filter.IncludeInactive {
+		where = append(where, "`active`")
+	}
+
+	rows, err := q.QueryContext(ctx,
+		selectRewards+"WHERE "+strings.Join(where, " AND ")+" ORDER BY `points_cost`, `title`, `id`",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rewards := []*Reward{}
+	for rows.Next() {
+		reward, err := scanReward(rows)
+		if err != nil {
+			return nil, err
+		}
+		rewards = append(rewards, reward)
+	}
+	return rewards, rows.Err()
+}
+
+// Create adds a reward to the catalog, clubID is nil for one run by admins
+func Create(ctx context.Context, q databaseutils.Querier, clubID *int64, fields Fields) (*Reward, error) {
+	if fields.Title == nil || fields.PointsCost == nil {
+		return nil, fmt.Errorf("%w: title and pointsCost are required", ErrInvalid)
+	}
+	reward := Reward{ClubID: clubID, Active: true, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := fields.apply(&reward); err != nil {
+		return nil, err
+	}
+
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO `REWARDS` (`club_id`, `title`, `description`, `points_cost`, `stock`, `active`, `created_at`) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?)",
+		reward.ClubID, reward.Title, reward.Description, reward.PointsCost, reward.Stock, reward.Active, reward.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if reward.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// Update changes the reward, it should have been loaded with Lock. Purchases that were
+// already made keep the price they were bought at.
+func Update(ctx context.Context, q databaseutils.Querier, reward *Reward, fields Fields) error {
+	if err := fields.apply(reward); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx,
+		"UPDATE `REWARDS` SET `title` = ?, `description` = ?, `points_cost` = ?, `stock` = ?, `active` = ? WHERE `id` = ?",
+		reward.Title, reward.Description, reward.PointsCost, reward.Stock, reward.Active, reward.ID,
+	)
+	return err
+}
@@ -0,0 +1,98 @@
+package rewardutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+func TestBuyAndRefund(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	students := make([]int64, 3)
+	for i, name := range []string{"Ada", "Grace", "Admin"} {
+		result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES (?)", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		students[i], _ = result.LastInsertId()
+	}
+	ada, grace, admin := students[0], students[1], students[2]
+
+	inTx := func(fn func(tx *sql.Tx) error) error {
+		return databaseutils.WithTx(ctx, db, fn)
+	}
+	for _, id := range []int64{ada, grace} {
+		if err := inTx(func(tx *sql.Tx) error {
+			_, _, err := pointutils.Adjust(ctx, tx, id, admin, 50, "Welcome bonus", "welcome")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	title, cost, stock := "Sticker pack", int64(30), int64(1)
+	reward, err := Create(ctx, db, nil, Fields{Title: &title, PointsCost: &cost, Stock: &stock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buy := func(studentID int64, key string) (*Purchase, bool, error) {
+		var purchase *Purchase
+		var added bool
+		err := inTx(func(tx *sql.Tx) error {
+			var err error
+			purchase, added, err = Buy(ctx, tx, reward.ID, studentID, key)
+			return err
+		})
+		return purchase, added, err
+	}
+
+	first, added, err := buy(ada, "k1")
+	if err != nil || !added {
+		t.Fatalf("Buy = %v, %v, want a new purchase", added, err)
+	}
+	if first.BalanceAfter != 20 {
+		t.Errorf("balance after = %d, want 20", first.BalanceAfter)
+	}
+	retry, added, err := buy(ada, "k1")
+	if err != nil || added || retry.ID != first.ID {
+		t.Errorf("retried Buy = %+v, %v, %v, want purchase %d again", retry, added, err, first.ID)
+	}
+	if _, _, err := buy(grace, "k1"); !errors.Is(err, ErrSoldOut) {
+		t.Errorf("Buy with no stock: err = %v, want ErrSoldOut", err)
+	}
+	if balance, _ := pointutils.Balance(ctx, db, grace); balance != 50 {
+		t.Errorf("failed purchase charged grace, balance = %d", balance)
+	}
+
+	if err := inTx(func(tx *sql.Tx) error {
+		_, err := Refund(ctx, tx, first.ID, admin)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := pointutils.Balance(ctx, db, ada); balance != 50 {
+		t.Errorf("balance after refund = %d, want 50", balance)
+	}
+	if err := inTx(func(tx *sql.Tx) error {
+		_, err := Fulfill(ctx, tx, first.ID, admin)
+		return err
+	}); !errors.Is(err, ErrConflict) {
+		t.Errorf("fulfilling a refund: err = %v, want ErrConflict", err)
+	}
+
+	// the refund put it back in stock
+	if _, added, err := buy(grace, "k2"); err != nil || !added {
+		t.Errorf("Buy after refund = %v, %v", added, err)
+	}
+	if _, _, err := buy(grace, "k3"); !errors.Is(err, pointutils.ErrInsufficient) {
+		t.Errorf("Buy with 20 points: err = %v, want ErrInsufficient", err)
+	}
+}
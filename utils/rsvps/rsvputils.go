@@ -0,0 +1,337 @@
+package rsvputils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	eventutils "cdk-infrastructure/utils/events"
+	studentutils "cdk-infrastructure/utils/students"
+)
+
+// A "going" RSVP is confirmed while the event has room and waitlisted once it's full.
+// When a confirmed student changes their answer, or the capacity goes up, the oldest
+// waitlisted RSVPs are confirmed. Every change locks the event's EVENTS row (through
+// eventutils.Lock) so two students can't both take the last spot.
+
+type Status string
+
+const (
+	StatusGoing    Status = "going"
+	StatusMaybe    Status = "maybe"
+	StatusNotGoing Status = "not_going"
+)
+
+var ErrInvalid = errors.New("invalid")
+
+type RSVP struct {
+	EventID     int64      `json:"eventId"`
+	StudentID   int64      `json:"studentId"`
+	Status      Status     `json:"status"`
+	Waitlisted  bool       `json:"waitlisted"`
+	RespondedAt time.Time  `json:"respondedAt"`
+	PromotedAt  *time.Time `json:"promotedAt,omitempty"`
+	// Position is 1 for the first student on the waitlist, 0 when not waitlisted
+	Position int64 `json:"position,omitempty"`
+}
+
+// Get loads the student's RSVP, nil if they haven't answered
+func Get(ctx context.Context, q databaseutils.Querier, eventID, studentID int64) (*RSVP, error) {
+	return get(ctx, q, eventID, studentID, "")
+}
+
+func get(ctx context.Context, q databaseutils.Querier, eventID, studentID int64, lock string) (*RSVP, error) {
+	r := RSVP{EventID: eventID, StudentID: studentID}
+	err := q.QueryRowContext(ctx,
+		"SELECT `status`, `waitlisted`, `responded_at`, `promoted_at` FROM `EVENT_RSVPS` "+
+			"WHERE `event_id` = ? AND `student_id` = ?"+lock,
+		eventID, studentID,
+	).Scan(&r.Status, &r.Waitlisted, &r.RespondedAt, &r.PromotedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Waitlisted {
+		err := q.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM `EVENT_RSVPS` WHERE `event_id` = ? AND `status` = 'going' AND `waitlisted` "+
+				"AND (`responded_at`, `student_id`) <= (?, ?)",
+			eventID, r.RespondedAt, studentID,
+		).Scan(&r.Position)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+// Respond records the student's answer. The event has to have been loaded with
+// eventutils.Lock in the same transaction.
+func Respond(ctx context.Context, q databaseutils.Querier, event *eventutils.Event, studentID int64, status Status) (*RSVP, error) {
+	if status != StatusGoing && status != StatusMaybe && status != StatusNotGoing {
+		return nil, fmt.Errorf("%w: status must be %q, %q or %q", ErrInvalid, StatusGoing, StatusMaybe, StatusNotGoing)
+	}
+
+	previous, err := get(ctx, q, event.ID, studentID, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.Status == status {
+		return previous, nil // same answer again, a waitlisted student keeps their place
+	}
+
+	waitlisted := false
+	if status == StatusGoing {
+		going, err := confirmed(ctx, q, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		waitlisted = event.Capacity != nil && going >= *event.Capacity
+	}
+
+	now := time.Now().UTC()
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO `EVENT_RSVPS` (`event_id`, `student_id`, `status`, `waitlisted`, `responded_at`) VALUES (?, ?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE `status` = VALUES(`status`), `waitlisted` = VALUES(`waitlisted`), "+
+			"`responded_at` = VALUES(`responded_at`), `promoted_at` = NULL",
+		event.ID, studentID, status, waitlisted, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// a confirmed spot just opened up
+	if previous != nil && previous.Status == StatusGoing && !previous.Waitlisted {
+		if _, err := Promote(ctx, q, event); err != nil {
+			return nil, err
+		}
+	}
+
+	return get(ctx, q, event.ID, studentID, "")
+}
+
+// SetCapacity changes the event's capacity, nil removes the limit. Lowering it never
+// takes a confirmed spot away, it only stops new students from being confirmed.
+// Returns the students that came off the waitlist.
+func SetCapacity(ctx context.Context, q databaseutils.Querier, event *eventutils.Event, capacity *int64) ([]int64, error) {
+	if capacity != nil && *capacity < 0 {
+		return nil, fmt.Errorf("%w: capacity can't be negative", ErrInvalid)
+	}
+
+	_, err := q.ExecContext(ctx, "UPDATE `EVENTS` SET `capacity` = ? WHERE `id` = ?", capacity, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	event.Capacity = capacity
+
+	return Promote(ctx, q, event)
+}
+
+// Promote confirms waitlisted students, oldest first, until the event is full, and
+// returns their ids. The event has to have been loaded with eventutils.Lock.
+func Promote(ctx context.Context, q databaseutils.Querier, event *eventutils.Event) ([]int64, error) {
+	going, err := confirmed(ctx, q, event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT `student_id` FROM `EVENT_RSVPS` WHERE `event_id` = ? AND `status` = 'going' AND `waitlisted` " +
+		"ORDER BY `responded_at`, `student_id`"
+	args := []any{event.ID}
+	if event.Capacity != nil {
+		open := *event.Capacity - going
+		if open <= 0 {
+			return nil, nil
+		}
+		query += " LIMIT ?"
+		args = append(args, open)
+	}
+
+	rows, err := q.QueryContext(ctx, query+" FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []int64
+	for rows.Next() {
+		var studentID int64
+		if err := rows.Scan(&studentID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, studentID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, studentID := range promoted {
+		_, err := q.ExecContext(ctx,
+			"UPDATE `EVENT_RSVPS` SET `waitlisted` = FALSE, `promoted_at` = ? WHERE `event_id` = ? AND `student_id` = ?",
+			now, event.ID, studentID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+// confirmed counts the students going that aren't waitlisted
+func confirmed(ctx context.Context, q databaseutils.Querier, eventID int64) (int64, error) {
+	var going int64
+	err := q.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM `EVENT_RSVPS` WHERE `event_id` = ? AND `status` = 'going' AND NOT `waitlisted`", eventID,
+	).Scan(&going)
+	return going, err
+}
+
+type Summary struct {
+	Capacity   *int64 `json:"capacity"`
+	Going      int64  `json:"going"`
+	Waitlisted int64  `json:"waitlisted"`
+	Maybe      int64  `json:"maybe"`
+	NotGoing   int64  `json:"notGoing"`
+}
+
+// Summarize counts the event's RSVPs
+func Summarize(ctx context.Context, q databaseutils.Querier, event *eventutils.Event) (*Summary, error) {
+	summary := Summary{Capacity: event.Capacity}
+	err := q.QueryRowContext(ctx,
+		"SELECT "+
+			"COALESCE(SUM(`status` = 'going' AND NOT `waitlisted`), 0), "+
+			"COALESCE(SUM(`status` = 'going' AND `waitlisted`), 0), "+
+			"COALESCE(SUM(`status` = 'maybe'), 0), "+
+			"COALESCE(SUM(`status` = 'not_going'), 0) "+
+			"FROM `EVENT_RSVPS` WHERE `event_id` = ?",
+		event.ID,
+	).Scan(&summary.Going, &summary.Waitlisted, &summary.Maybe, &summary.NotGoing)
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+type Attendee struct {
+	StudentID           int64     `json:"studentId"`
+	FirstName           *string   `json:"firstName"`
+	LastName            *string   `json:"lastName"`
+	Email               *string   `json:"email"`
+	Status              Status    `json:"status"`
+	Waitlisted          bool      `json:"waitlisted"`
+	RespondedAt         time.Time `json:"respondedAt"`
+	DietaryRestrictions *string   `json:"dietaryRestrictions"`
+}
+
+// Attendees lists everyone who answered, confirmed first, then the waitlist in order,
+// then maybe and not going
+func Attendees(ctx context.Context, q databaseutils.Querier, eventID int64) ([]Attendee, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT s.`id`, s.`first_name`, s.`last_name`, s.`email`, r.`status`, r.`waitlisted`, r.`responded_at`, "+
+			"i.`dietary_restrictions`, i.`dietary_restrictions_ciphertext` FROM `EVENT_RSVPS` r JOIN `STUDENTS` s ON s.`id` = r.`student_id` "+
+			"LEFT JOIN `STUDENT_INFO` i ON i.`student_id` = s.`id` WHERE r.`event_id` = ? "+
+			"ORDER BY FIELD(r.`status`, 'going', 'maybe', 'not_going'), r.`waitlisted`, r.`responded_at`, s.`id`",
+		eventID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []Attendee{}
+	for rows.Next() {
+		var a Attendee
+		var sealed []byte
+		err := rows.Scan(&a.StudentID, &a.FirstName, &a.LastName, &a.Email, &a.Status, &a.Waitlisted,
+			&a.RespondedAt, &a.DietaryRestrictions, &sealed)
+		if err != nil {
+			return nil, err
+		}
+		a.DietaryRestrictions, err = studentutils.Reveal(ctx, sealed, a.DietaryRestrictions, studentutils.LabelDietaryRestrictions)
+		if err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, a)
+	}
+	return attendees, rows.Err()
+}
+
+type Restriction struct {
+	Restriction string `json:"restriction"`
+	Count       int64  `json:"count"`
+}
+
+// Catering is what to order food for, from STUDENT_INFO.dietary_restrictions of the
+// students going. Maybe is there to plan some extra.
+type Catering struct {
+	Going          int64         `json:"going"`
+	Maybe          int64         `json:"maybe"`
+	NoRestrictions int64         `json:"noRestrictions"`
+	Restrictions   []Restriction `json:"restrictions"`
+}
+
+// CateringSummary groups the confirmed attendees' dietary restrictions. The column is
+// free text, so it's split on commas and semicolons and compared case insensitively.
+func CateringSummary(attendees []Attendee) Catering {
+	catering := Catering{Restrictions: []Restriction{}}
+	counts := map[string]int64{}
+
+	for _, a := range attendees {
+		if a.Status == StatusMaybe {
+			catering.Maybe++
+		}
+		if a.Status != StatusGoing || a.Waitlisted {
+			continue
+		}
+		catering.Going++
+
+		restrictions := parseRestrictions(a.DietaryRestrictions)
+		if len(restrictions) == 0 {
+			catering.NoRestrictions++
+		}
+		for _, restriction := range restrictions {
+			counts[restriction]++
+		}
+	}
+
+	for restriction, count := range counts {
+		catering.Restrictions = append(catering.Restrictions, Restriction{restriction, count})
+	}
+	sort.Slice(catering.Restrictions, func(i, j int) bool {
+		a, b := catering.Restrictions[i], catering.Restrictions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Restriction < b.Restriction
+	})
+	return catering
+}
+
+// answers that mean there's nothing to plan for
+var noRestriction = map[string]bool{"": true, "none": true, "n/a": true, "na": true, "no": true, "nothing": true, "-": true}
+
+func parseRestrictions(value *string) []string {
+	if value == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var restrictions []string
+	for _, part := range strings.FieldsFunc(*value, func(r rune) bool { return r == ',' || r == ';' }) {
+		restriction := strings.ToLower(strings.Join(strings.Fields(part), " "))
+		if noRestriction[restriction] || seen[restriction] {
+			continue
+		}
+		seen[restriction] = true
+		restrictions = append(restrictions, restriction)
+	}
+	return restrictions
+}
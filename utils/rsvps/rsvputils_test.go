@@ -0,0 +1,132 @@
+package rsvputils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+	eventutils "cdk-infrastructure/utils/events"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestCateringSummary(t *testing.T) {
+	attendees := []Attendee{
+		{Status: StatusGoing, DietaryRestrictions: strPtr("Vegetarian, nut allergy")},
+		{Status: StatusGoing, DietaryRestrictions: strPtr("vegetarian")},
+		{Status: StatusGoing, DietaryRestrictions: strPtr("N/A")},
+		{Status: StatusGoing},
+		{Status: StatusGoing, Waitlisted: true, DietaryRestrictions: strPtr("halal")},
+		{Status: StatusMaybe, DietaryRestrictions: strPtr("kosher")},
+		{Status: StatusNotGoing, DietaryRestrictions: strPtr("vegan")},
+	}
+
+	want := Catering{
+		Going:          4,
+		Maybe:          1,
+		NoRestrictions: 2,
+		Restrictions: []Restriction{
+			{"vegetarian", 2},
+			{"nut allergy", 1},
+		},
+	}
+	if got := CateringSummary(attendees); !reflect.DeepEqual(got, want) {
+		t.Errorf("CateringSummary = %+v, want %+v", got, want)
+	}
+}
+
+func TestWaitlistPromotion(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	result, err := db.Exec("INSERT INTO `CLUBS` (`club_name`) VALUES ('Girls Who Code')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clubID, _ := result.LastInsertId()
+	var students []int64
+	for i := 0; i < 4; i++ {
+		result, err := db.Exec("INSERT INTO `STUDENTS` (`first_name`) VALUES (?)", fmt.Sprintf("Student %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		students = append(students, id)
+	}
+
+	var eventID int64
+	err = databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+		start := eventutils.Fields{Name: strPtr("Resume workshop"), Status: eventutils.StatusDrafted}
+		event, err := eventutils.Create(ctx, tx, students[0], []int64{clubID}, start)
+		if err != nil {
+			return err
+		}
+		eventID = event.ID
+		capacity := int64(2)
+		_, err = SetCapacity(ctx, tx, event, &capacity)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	respond := func(studentID int64, status Status) *RSVP {
+		t.Helper()
+		var rsvp *RSVP
+		err := databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			event, err := eventutils.Lock(ctx, tx, eventID)
+			if err != nil {
+				return err
+			}
+			rsvp, err = Respond(ctx, tx, event, studentID, status)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Respond(%d, %s): %v", studentID, status, err)
+		}
+		return rsvp
+	}
+
+	for i, student := range students {
+		rsvp := respond(student, StatusGoing)
+		if waitlisted := i >= 2; rsvp.Waitlisted != waitlisted {
+			t.Errorf("student %d waitlisted = %v, want %v", i, rsvp.Waitlisted, waitlisted)
+		}
+	}
+	if rsvp, _ := Get(ctx, db, eventID, students[3]); rsvp.Position != 2 {
+		t.Errorf("last student's waitlist position = %d, want 2", rsvp.Position)
+	}
+
+	// a confirmed student drops out, the first on the waitlist takes their spot
+	respond(students[0], StatusNotGoing)
+
+	promoted, err := Get(ctx, db, eventID, students[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Waitlisted || promoted.PromotedAt == nil {
+		t.Errorf("first waitlisted student = %+v, want promoted", promoted)
+	}
+	if rsvp, _ := Get(ctx, db, eventID, students[3]); !rsvp.Waitlisted || rsvp.Position != 1 {
+		t.Errorf("second waitlisted student = %+v, want first on the waitlist", rsvp)
+	}
+
+	event, err := eventutils.Get(ctx, db, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := Summarize(ctx, db, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Summary{Capacity: event.Capacity, Going: 2, Waitlisted: 1, NotGoing: 1}
+	if !reflect.DeepEqual(*summary, want) {
+		t.Errorf("Summarize = %+v, want %+v", *summary, want)
+	}
+}
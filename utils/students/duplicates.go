@@ -0,0 +1,270 @@
+package studentutils
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// reasons two students look like the same person, with how much each counts
+const (
+	MatchEmail  = "email"
+	MatchEmplid = "emplid"
+	MatchName   = "name"
+	MatchFuzzy  = "similar_name"
+)
+
+var matchScores = map[string]int{
+	MatchEmail:  40,
+	MatchEmplid: 40,
+	MatchName:   20,
+	MatchFuzzy:  10,
+}
+
+// maxNameDistance is how many letters two full names can differ by and still be a
+// fuzzy match, e.g. "Katherine Jonson" and "Katharine Johnson"
+const maxNameDistance = 2
+
+// Candidate is a pair of students that might be the same person. Student is the older
+// row, the one a merge would normally keep.
+type Candidate struct {
+	Student   *Profile `json:"student"`
+	Duplicate *Profile `json:"duplicate"`
+	Reasons   []string `json:"reasons"`
+	Score     int      `json:"score"`
+}
+
+type pair struct{ a, b int64 }
+
+func newPair(a, b int64) pair {
+	if a > b {
+		a, b = b, a
+	}
+	return pair{a, b}
+}
+
+// Candidates finds possible duplicates among the students that weren't merged yet,
+// best matches first. Emails and emplids are compared exactly (ignoring case), names
+// within maxNameDistance of each other.
+func Candidates(ctx context.Context, q databaseutils.Querier, limit int) ([]Candidate, error) {
+	reasons := map[pair][]string{}
+	add := func(p pair, reason string) {
+		reasons[p] = append(reasons[p], reason)
+	}
+
+	exact := []struct {
+		reason string
+		query  string
+	}{
+		{MatchEmail, "SELECT a.`id`, b.`id` FROM `STUDENTS` a JOIN `STUDENTS` b " +
+			"ON LOWER(TRIM(b.`email`)) = LOWER(TRIM(a.`email`)) AND b.`id` > a.`id` " +
+			"WHERE a.`email` <> '' AND a.`merged_into_id` IS NULL AND b.`merged_into_id` IS NULL"},
+		// rows EncryptInfo hasn't sealed yet still have the plaintext
+		{MatchEmplid, "SELECT a.`student_id`, b.`student_id` FROM `STUDENT_INFO` a JOIN `STUDENT_INFO` b " +
+			"ON (b.`emplid_index` = a.`emplid_index` OR TRIM(b.`emplid`) = TRIM(a.`emplid`)) AND b.`student_id` > a.`student_id` " +
+			"WHERE a.`emplid_index` IS NOT NULL OR a.`emplid` <> ''"},
+	}
+	for _, match := range exact {
+		pairs, err := queryPairs(ctx, q, match.query)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pairs {
+			add(p, match.reason)
+		}
+	}
+
+	names, err := queryNames(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for p, reason := range nameMatches(names) {
+		add(p, reason)
+	}
+
+	candidates := make([]Candidate, 0, len(reasons))
+	for p, rs := range reasons {
+		c := Candidate{Student: &Profile{ID: p.a}, Duplicate: &Profile{ID: p.b}, Reasons: rs}
+		sort.Strings(c.Reasons)
+		for _, reason := range rs {
+			c.Score += matchScores[reason]
+		}
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].Student.ID != candidates[j].Student.ID {
+			return candidates[i].Student.ID < candidates[j].Student.ID
+		}
+		return candidates[i].Duplicate.ID < candidates[j].Duplicate.ID
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	// the emplid query doesn't look at merged_into_id, merging deletes the duplicate's
+	// STUDENT_INFO so that only matters if someone added it back by hand
+	ids := []int64{}
+	for _, c := range candidates {
+		ids = append(ids, c.Student.ID, c.Duplicate.ID)
+	}
+	profiles, err := byIDs(ctx, q, ids)
+	if err != nil {
+		return nil, err
+	}
+	found := candidates[:0]
+	for _, c := range candidates {
+		student, duplicate := profiles[c.Student.ID], profiles[c.Duplicate.ID]
+		if student == nil || duplicate == nil || student.MergedIntoID != nil || duplicate.MergedIntoID != nil {
+			continue
+		}
+		c.Student, c.Duplicate = student, duplicate
+		found = append(found, c)
+	}
+	return found, nil
+}
+
+func queryPairs(ctx context.Context, q databaseutils.Querier, query string) ([]pair, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []pair
+	for rows.Next() {
+		var a, b int64
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, newPair(a, b))
+	}
+	return pairs, rows.Err()
+}
+
+// queryNames returns the normalized full name of every student that has one
+func queryNames(ctx context.Context, q databaseutils.Querier) (map[int64]string, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT `id`, COALESCE(`first_name`, ''), COALESCE(`last_name`, '') FROM `STUDENTS` WHERE `merged_into_id` IS NULL",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var first, last string
+		if err := rows.Scan(&id, &first, &last); err != nil {
+			return nil, err
+		}
+		// without a last name too many students would match each other
+		if name := normalizeName(first, last); name != "" && normalizeName("", last) != "" {
+			names[id] = name
+		}
+	}
+	return names, rows.Err()
+}
+
+// nameMatches compares names within blocks of the same last name initial, every pair in
+// a block is compared so this stays cheap only while the club is club-sized
+func nameMatches(names map[int64]string) map[pair]string {
+	blocks := map[rune][]int64{}
+	for id, name := range names {
+		first := []rune(name)[0]
+		blocks[first] = append(blocks[first], id)
+	}
+
+	matches := map[pair]string{}
+	for _, ids := range blocks {
+		for i := range ids {
+			for j := i + 1; j < len(ids); j++ {
+				a, b := names[ids[i]], names[ids[j]]
+				switch {
+				case a == b:
+					matches[newPair(ids[i], ids[j])] = MatchName
+				case len(a) > 2*maxNameDistance && distance(a, b) <= maxNameDistance:
+					matches[newPair(ids[i], ids[j])] = MatchFuzzy
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// normalizeName lowercases "last first" and drops everything but letters, so
+// "O'Brien, Mary-Ann" and "obrien maryann" are the same
+func normalizeName(first, last string) string {
+	keep := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, s)
+	}
+	return strings.TrimSpace(keep(last) + " " + keep(first))
+}
+
+// distance is the Levenshtein distance between a and b
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// byIDs loads the profiles of ids, missing students aren't in the map
+func byIDs(ctx context.Context, q databaseutils.Querier, ids []int64) (map[int64]*Profile, error) {
+	profiles := map[int64]*Profile{}
+	if len(ids) == 0 {
+		return profiles, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.QueryContext(ctx, selectProfiles+"WHERE s.`id` IN ("+placeholders(len(args))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*Profile{}
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles[profile.ID] = profile
+		list = append(list, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := reveal(ctx, list); err != nil {
+		return nil, err
+	}
+	return profiles, attachInterests(ctx, q, list)
+}
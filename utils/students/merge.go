@@ -0,0 +1,338 @@
+package studentutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+// MergeRecord is a row of STUDENT_MERGES
+type MergeRecord struct {
+	ID         int64        `json:"id"`
+	SurvivorID int64        `json:"survivorId"`
+	MergedID   int64        `json:"mergedId"`
+	MergedBy   *int64       `json:"mergedBy"`
+	MergedAt   time.Time    `json:"mergedAt"`
+	Details    MergeDetails `json:"details"`
+}
+
+// MergeDetails is what the duplicate looked like before the merge, with its encrypted
+// columns redacted, and how many rows of each table were handed to the survivor, e.g.
+// {"CLUB_MEMBERS.student_id": 2}
+type MergeDetails struct {
+	Duplicate *Profile         `json:"duplicate"`
+	Moved     map[string]int64 `json:"moved"`
+}
+
+// references are the remaining columns pointing at a student that simply move to the
+// survivor, the tables with a key per student are handled on their own in Merge
+var references = []struct{ table, column string }{
+	{"POINT_HISTORIES", "member_id"},
+	{"POINT_HISTORIES", "actor_id"},
+	{"PURCHASES", "member_id"},
+	{"PURCHASES", "handled_by"},
+	{"EVENT_VERSIONS", "author_id"},
+	{"EVENT_COHOST_INVITATIONS", "invited_by"},
+	{"EVENT_COHOST_INVITATIONS", "responded_by"},
+	{"MEMBER_FORM_DATA", "student_id"},
+}
+
+// Merge folds the duplicate into the survivor: blanks in the survivor's profile are
+// filled from the duplicate, everything the duplicate owns moves to the survivor and
+// the duplicate is left as an empty row pointing at it. q should be a transaction so
+// a merge that fails halfway changes nothing.
+//
+// Students with different emplids, or that both signed in, are never merged, that's
+// two people sharing a name or an email by mistake.
+func Merge(ctx context.Context, q databaseutils.Querier, survivorID, duplicateID, actorID int64) (*MergeRecord, error) {
+	if survivorID == duplicateID {
+		return nil, fmt.Errorf("%w: a student can't be merged into themselves", ErrInvalid)
+	}
+
+	cognitoSubs, err := lockForMerge(ctx, q, survivorID, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+	if cognitoSubs[survivorID] != nil && cognitoSubs[duplicateID] != nil {
+		return nil, fmt.Errorf("%w: both students have an account", ErrConflict)
+	}
+
+	survivor, err := Get(ctx, q, survivorID)
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := Get(ctx, q, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+	if differ(survivor.Emplid, duplicate.Emplid) {
+		return nil, fmt.Errorf("%w: the students have different emplids", ErrConflict)
+	}
+
+	details := MergeDetails{Duplicate: duplicate.Redacted(), Moved: map[string]int64{}}
+	exec := func(moved, query string, args ...any) error {
+		result, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if moved != "" {
+			rows, _ := result.RowsAffected()
+			details.Moved[moved] += rows
+		}
+		return nil
+	}
+
+	// empty the duplicate first, the cognito sub is unique and it may be moving
+	err = exec("",
+		"UPDATE `STUDENTS` SET `merged_into_id` = ?, `first_name` = NULL, `last_name` = NULL, `email` = NULL, `cognito_sub` = NULL WHERE `id` = ?",
+		survivorID, duplicateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := exec("", "DELETE FROM `STUDENT_INFO` WHERE `student_id` = ?", duplicateID); err != nil {
+		return nil, err
+	}
+	// students merged into the duplicate before now point straight at the survivor
+	if err := exec("", "UPDATE `STUDENTS` SET `merged_into_id` = ? WHERE `merged_into_id` = ?", survivorID, duplicateID); err != nil {
+		return nil, err
+	}
+
+	fillBlanks(survivor, duplicate)
+	if err := Save(ctx, q, survivor); err != nil {
+		return nil, err
+	}
+	err = exec("",
+		"UPDATE `STUDENTS` SET `email` = COALESCE(NULLIF(`email`, ''), ?), `cognito_sub` = COALESCE(`cognito_sub`, ?) WHERE `id` = ?",
+		duplicate.Email, cognitoSubs[duplicateID], survivorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// rows the survivor already has a match for are resolved first, UPDATE IGNORE then
+	// moves the rest and whatever is left of the duplicate's is dropped
+	moveKeyed := func(table string) error {
+		err := exec(table+".student_id", "UPDATE IGNORE `"+table+"` SET `student_id` = ? WHERE `student_id` = ?", survivorID, duplicateID)
+		if err != nil {
+			return err
+		}
+		return exec("", "DELETE FROM `"+table+"` WHERE `student_id` = ?", duplicateID)
+	}
+
+	// eboard wins over member
+	err = exec("",
+		"UPDATE `CLUB_MEMBERS` s JOIN `CLUB_MEMBERS` d ON d.`club_id` = s.`club_id` AND d.`student_id` = ? "+
+			"SET s.`role` = 'eboard' WHERE s.`student_id` = ? AND d.`role` = 'eboard'",
+		duplicateID, survivorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveKeyed("CLUB_MEMBERS"); err != nil {
+		return nil, err
+	}
+	if err := moveKeyed("STUDENTS_TO_INTERESTS"); err != nil {
+		return nil, err
+	}
+
+	// a confirmed spot wins over anything else. Two confirmed spots free one up, it's
+	// handed out the next time anyone changes their RSVP to the event.
+	err = exec("",
+		"UPDATE `EVENT_RSVPS` s JOIN `EVENT_RSVPS` d ON d.`event_id` = s.`event_id` AND d.`student_id` = ? "+
+			"SET s.`status` = d.`status`, s.`waitlisted` = d.`waitlisted`, s.`responded_at` = d.`responded_at`, s.`promoted_at` = d.`promoted_at` "+
+			"WHERE s.`student_id` = ? AND d.`status` = 'going' AND NOT d.`waitlisted` AND NOT (s.`status` = 'going' AND NOT s.`waitlisted`)",
+		duplicateID, survivorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveKeyed("EVENT_RSVPS"); err != nil {
+		return nil, err
+	}
+
+	doubleAwards, err := doubleCheckIns(ctx, q, survivorID, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+	err = exec("",
+		"UPDATE `EVENT_CHECKINS` s JOIN `EVENT_CHECKINS` d ON d.`event_id` = s.`event_id` AND d.`student_id` = ? "+
+			"SET s.`checked_in_at` = LEAST(s.`checked_in_at`, d.`checked_in_at`), s.`points_earned` = COALESCE(s.`points_earned`, d.`points_earned`) "+
+			"WHERE s.`student_id` = ?",
+		duplicateID, survivorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := moveKeyed("EVENT_CHECKINS"); err != nil {
+		return nil, err
+	}
+
+	for _, ref := range references {
+		query := fmt.Sprintf("UPDATE `%s` SET `%s` = ? WHERE `%s` = ?", ref.table, ref.column, ref.column)
+		if err := exec(ref.table+"."+ref.column, query, survivorID, duplicateID); err != nil {
+			return nil, err
+		}
+	}
+
+	// the same person checked in twice got the event's points twice
+	for eventID, points := range doubleAwards {
+		_, _, err := pointutils.Post(ctx, q, pointutils.Posting{
+			StudentID:      survivorID,
+			Points:         -points,
+			Reason:         fmt.Sprintf("Duplicate check-in to event %d removed by a merge", eventID),
+			ActorID:        &actorID,
+			IdempotencyKey: fmt.Sprintf("merge:%d:checkin:%d", duplicateID, eventID),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := pointutils.Rebalance(ctx, q, survivorID); err != nil {
+		return nil, err
+	}
+
+	record := MergeRecord{
+		SurvivorID: survivorID,
+		MergedID:   duplicateID,
+		MergedBy:   &actorID,
+		MergedAt:   time.Now().UTC().Truncate(time.Second),
+		Details:    details,
+	}
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	result, err := q.ExecContext(ctx,
+		"INSERT INTO `STUDENT_MERGES` (`survivor_id`, `merged_id`, `merged_by`, `merged_at`, `details`) VALUES (?, ?, ?, ?, ?)",
+		record.SurvivorID, record.MergedID, record.MergedBy, record.MergedAt, string(encoded),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if record.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// lockForMerge locks both students in id order, so two merges of the same pair can't
+// deadlock, and returns their cognito subs
+func lockForMerge(ctx context.Context, q databaseutils.Querier, survivorID, duplicateID int64) (map[int64]*string, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT `id`, `cognito_sub`, `merged_into_id` FROM `STUDENTS` WHERE `id` IN (?, ?) ORDER BY `id` FOR UPDATE",
+		survivorID, duplicateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := map[int64]*string{}
+	for rows.Next() {
+		var id int64
+		var sub *string
+		var mergedInto *int64
+		if err := rows.Scan(&id, &sub, &mergedInto); err != nil {
+			return nil, err
+		}
+		if mergedInto != nil {
+			return nil, fmt.Errorf("%w: student %d was already merged into %d", ErrConflict, id, *mergedInto)
+		}
+		subs[id] = sub
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(subs) != 2 {
+		return nil, ErrNotFound
+	}
+	return subs, nil
+}
+
+// doubleCheckIns returns the points the duplicate got for events both students were
+// awarded points for, by event id
+func doubleCheckIns(ctx context.Context, q databaseutils.Querier, survivorID, duplicateID int64) (map[int64]int64, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT d.`event_id`, d.`points_earned` FROM `EVENT_CHECKINS` d "+
+			"JOIN `EVENT_CHECKINS` s ON s.`event_id` = d.`event_id` AND s.`student_id` = ? "+
+			"WHERE d.`student_id` = ? AND d.`points_earned` IS NOT NULL AND s.`points_earned` IS NOT NULL",
+		survivorID, duplicateID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := map[int64]int64{}
+	for rows.Next() {
+		var eventID, points int64
+		if err := rows.Scan(&eventID, &points); err != nil {
+			return nil, err
+		}
+		if points != 0 {
+			awards[eventID] = points
+		}
+	}
+	return awards, rows.Err()
+}
+
+// fillBlanks copies the duplicate's names and info into the survivor where the
+// survivor has nothing
+func fillBlanks(survivor, duplicate *Profile) {
+	fill := func(dst **string, src *string) {
+		if blank(*dst) && !blank(src) {
+			*dst = src
+		}
+	}
+	fill(&survivor.FirstName, duplicate.FirstName)
+	fill(&survivor.LastName, duplicate.LastName)
+	fill(&survivor.Major, duplicate.Major)
+	fill(&survivor.Emplid, duplicate.Emplid)
+	fill(&survivor.DietaryRestrictions, duplicate.DietaryRestrictions)
+	fill(&survivor.Comments, duplicate.Comments)
+	if survivor.GradYear == nil {
+		survivor.GradYear = duplicate.GradYear
+	}
+}
+
+func blank(s *string) bool {
+	return s == nil || strings.TrimSpace(*s) == ""
+}
+
+// differ is true when both values are set and aren't the same
+func differ(a, b *string) bool {
+	return !blank(a) && !blank(b) && !strings.EqualFold(strings.TrimSpace(*a), strings.TrimSpace(*b))
+}
+
+// Merges lists past merges, newest first
+func Merges(ctx context.Context, q databaseutils.Querier, limit, offset int64) ([]MergeRecord, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT `id`, `survivor_id`, `merged_id`, `merged_by`, `merged_at`, `details` FROM `STUDENT_MERGES` "+
+			"ORDER BY `merged_at` DESC, `id` DESC LIMIT ? OFFSET ?",
+		limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []MergeRecord{}
+	for rows.Next() {
+		var record MergeRecord
+		var details []byte
+		if err := rows.Scan(&record.ID, &record.SurvivorID, &record.MergedID, &record.MergedBy, &record.MergedAt, &details); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(details, &record.Details); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,178 @@
+package studentutils
+
+import (
+	"context"
+	"database/sql"
+
+	cryptoutils "cdk-infrastructure/utils/crypto"
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+// labels bind each sealed value to its column, see cryptoutils.Cipher.Encrypt
+const (
+	LabelEmplid              = "STUDENT_INFO.emplid"
+	LabelDietaryRestrictions = "STUDENT_INFO.dietary_restrictions"
+)
+
+type sealedInfo struct {
+	emplid              []byte
+	emplidIndex         []byte
+	dietaryRestrictions []byte
+}
+
+func seal(ctx context.Context, emplid, dietaryRestrictions *string) (*sealedInfo, error) {
+	cipher, err := cryptoutils.Default(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed sealedInfo
+	if sealed.emplid, err = cipher.EncryptNullable(ctx, emplid, LabelEmplid); err != nil {
+		return nil, err
+	}
+	if emplid != nil {
+		sealed.emplidIndex = cipher.BlindIndex(*emplid, LabelEmplid)
+	}
+	if sealed.dietaryRestrictions, err = cipher.EncryptNullable(ctx, dietaryRestrictions, LabelDietaryRestrictions); err != nil {
+		return nil, err
+	}
+	return &sealed, nil
+}
+
+// reveal decrypts the sealed columns of the profiles. Rows EncryptInfo hasn't got to
+// yet keep their plaintext.
+func reveal(ctx context.Context, profiles []*Profile) error {
+	for _, p := range profiles {
+		var err error
+		if p.Emplid, err = Reveal(ctx, p.sealedEmplid, p.Emplid, LabelEmplid); err != nil {
+			return err
+		}
+		if p.DietaryRestrictions, err = Reveal(ctx, p.sealedDietaryRestrictions, p.DietaryRestrictions, LabelDietaryRestrictions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reveal is the value of an encrypted STUDENT_INFO column, read as both its sealed and
+// its plaintext column. The cipher is only loaded when there's something to decrypt.
+func Reveal(ctx context.Context, sealed []byte, plaintext *string, label string) (*string, error) {
+	if sealed == nil {
+		return plaintext, nil
+	}
+	cipher, err := cryptoutils.Default(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.DecryptNullable(ctx, sealed, label)
+}
+
+// EmplidIndex is what STUDENT_INFO.emplid_index holds for the emplid
+func EmplidIndex(ctx context.Context, emplid string) ([]byte, error) {
+	cipher, err := cryptoutils.Default(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.BlindIndex(emplid, LabelEmplid), nil
+}
+
+// EncryptReport is what EncryptInfo did
+type EncryptReport struct {
+	Sealed int `json:"sealed"`
+}
+
+// encryptBatchSize is how many rows EncryptInfo seals per transaction
+const encryptBatchSize = 200
+
+// EncryptInfo seals the STUDENT_INFO rows that still have a plaintext emplid or
+// dietary restrictions and clears the plaintext. With rewrap every row is sealed again
+// with a fresh data key, e.g. after DATA_KEY_ARN was pointed at a new KMS key.
+// It can be stopped and run again at any point.
+func EncryptInfo(ctx context.Context, db databaseutils.Beginner, rewrap bool) (*EncryptReport, error) {
+	report := EncryptReport{}
+	where := "(`emplid` IS NOT NULL OR `dietary_restrictions` IS NOT NULL)"
+	if rewrap {
+		where = "(`emplid` IS NOT NULL OR `dietary_restrictions` IS NOT NULL OR " +
+			"`emplid_ciphertext` IS NOT NULL OR `dietary_restrictions_ciphertext` IS NOT NULL)"
+	}
+
+	var after int64
+	for {
+		var done bool
+		err := databaseutils.WithTx(ctx, db, func(tx *sql.Tx) error {
+			ids, err := lockInfoBatch(ctx, tx, where, after)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				done = true
+				return nil
+			}
+			after = ids[len(ids)-1]
+
+			for _, id := range ids {
+				if err := resealInfo(ctx, tx, id); err != nil {
+					return err
+				}
+				report.Sealed++
+			}
+			return nil
+		})
+		if err != nil {
+			return &report, err
+		}
+		if done {
+			return &report, nil
+		}
+	}
+}
+
+// lockInfoBatch locks the next rows to seal after the student id
+func lockInfoBatch(ctx context.Context, tx *sql.Tx, where string, after int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT `student_id` FROM `STUDENT_INFO` WHERE `student_id` > ? AND "+where+
+			" ORDER BY `student_id` LIMIT ? FOR UPDATE",
+		after, encryptBatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// resealInfo reads one row, decrypting what's already sealed, and writes it back sealed
+func resealInfo(ctx context.Context, q databaseutils.Querier, studentID int64) error {
+	p := Profile{ID: studentID}
+	err := q.QueryRowContext(ctx,
+		"SELECT `emplid`, `emplid_ciphertext`, `dietary_restrictions`, `dietary_restrictions_ciphertext` "+
+			"FROM `STUDENT_INFO` WHERE `student_id` = ?",
+		studentID,
+	).Scan(&p.Emplid, &p.sealedEmplid, &p.DietaryRestrictions, &p.sealedDietaryRestrictions)
+	if err != nil {
+		return err
+	}
+	if err := reveal(ctx, []*Profile{&p}); err != nil {
+		return err
+	}
+
+	sealed, err := seal(ctx, p.Emplid, p.DietaryRestrictions)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx,
+		"UPDATE `STUDENT_INFO` SET `emplid` = NULL, `emplid_ciphertext` = ?, `emplid_index` = ?, "+
+			"`dietary_restrictions` = NULL, `dietary_restrictions_ciphertext` = ? WHERE `student_id` = ?",
+		sealed.emplid, sealed.emplidIndex, sealed.dietaryRestrictions, studentID,
+	)
+	return err
+}
@@ -0,0 +1,290 @@
+package studentutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	databaseutils "cdk-infrastructure/utils/database"
+)
+
+var (
+	ErrNotFound = errors.New("student not found")
+	ErrConflict = errors.New("conflict")
+)
+
+type Interest struct {
+	ID    int64  `json:"id"`
+	Label string `json:"label"`
+}
+
+// Profile is a STUDENTS row joined with its STUDENT_INFO, info columns are nil when
+// the student has no info yet
+type Profile struct {
+	ID        int64   `json:"id"`
+	FirstName *string `json:"firstName"`
+	LastName  *string `json:"lastName"`
+	Email     *string `json:"email"`
+
+	Major               *string `json:"major"`
+	Emplid              *string `json:"emplid"`
+	GradYear            *int64  `json:"gradYear"`
+	DietaryRestrictions *string `json:"dietaryRestrictions"`
+	Comments            *string `json:"comments"`
+
+	Interests []Interest `json:"interests"`
+
+	// MergedIntoID is set on a duplicate that was merged, everything it had moved there
+	MergedIntoID *int64 `json:"mergedIntoId,omitempty"`
+
+	// the encrypted columns as they were read, see reveal
+	sealedEmplid              []byte
+	sealedDietaryRestrictions []byte
+}
+
+// Redacted is a copy of the profile with the encrypted columns replaced by
+// "[encrypted]", for the audit log and merge history, which would otherwise keep them
+// in plaintext
+func (p *Profile) Redacted() *Profile {
+	redacted, placeholder := *p, "[encrypted]"
+	for _, value := range []**string{&redacted.Emplid, &redacted.DietaryRestrictions} {
+		if *value != nil {
+			*value = &placeholder
+		}
+	}
+	return &redacted
+}
+
+const selectProfiles = "SELECT s.`id`, s.`first_name`, s.`last_name`, s.`email`, " +
+	"i.`major`, i.`emplid`, i.`emplid_ciphertext`, i.`grad_year`, i.`dietary_restrictions`, " +
+	"i.`dietary_restrictions_ciphertext`, i.`comments`, s.`merged_into_id` " +
+	"FROM `STUDENTS` s LEFT JOIN `STUDENT_INFO` i ON i.`student_id` = s.`id` "
+
+func scanProfile(row interface{ Scan(...any) error }) (*Profile, error) {
+	var p Profile
+	err := row.Scan(&p.ID, &p.FirstName, &p.LastName, &p.Email,
+		&p.Major, &p.Emplid, &p.sealedEmplid, &p.GradYear, &p.DietaryRestrictions,
+		&p.sealedDietaryRestrictions, &p.Comments, &p.MergedIntoID)
+	if err != nil {
+		return nil, err
+	}
+	p.Interests = []Interest{}
+	return &p, nil
+}
+
+// Get loads one student's profile with their interests
+func Get(ctx context.Context, q databaseutils.Querier, studentID int64) (*Profile, error) {
+	profile, err := scanProfile(q.QueryRowContext(ctx, selectProfiles+"WHERE s.`id` = ?", studentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reveal(ctx, []*Profile{profile}); err != nil {
+		return nil, err
+	}
+	if err := attachInterests(ctx, q, []*Profile{profile}); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Filter narrows List, zero values are ignored
+type Filter struct {
+	Major      string
+	GradYear   int64
+	InterestID int64
+
+	Limit  int64
+	Offset int64
+}
+
+// List returns a page of profiles ordered by name, merged and erased students are left out
+func List(ctx context.Context, q databaseutils.Querier, filter Filter) ([]*Profile, error) {
+	where := []string{"s.`merged_into_id` IS NULL", "s.`erased_at` IS NULL"}
+	var args []any
+
+	if filter.Major != "" {
+		where = append(where, "i.`major` = ?")
+		args = append(args, filter.Major)
+	}
+	if filter.GradYear != 0 {
+		where = append(where, "i.`grad_year` = ?")
+		args = append(args, filter.GradYear)
+	}
+	if filter.InterestID != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM `STUDENTS_TO_INTERESTS` si WHERE si.`student_id` = s.`id` AND si.`interest_id` = ?)")
+		args = append(args, filter.InterestID)
+	}
+
+	query := selectProfiles + "WHERE " + strings.Join(where, " AND ") + " "
+	query += "ORDER BY s.`last_name`, s.`first_name`, s.`id` LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []*Profile{}
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := reveal(ctx, profiles); err != nil {
+		return nil, err
+	}
+	if err := attachInterests(ctx, q, profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// attachInterests loads the interests of every profile in one query
+func attachInterests(ctx context.Context, q databaseutils.Querier, profiles []*Profile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Profile, len(profiles))
+	args := make([]any, 0, len(profiles))
+	for _, profile := range profiles {
+		byID[profile.ID] = profile
+		args = append(args, profile.ID)
+	}
+
+	rows, err := q.QueryContext(ctx,
+		"SELECT si.`student_id`, i.`id`, i.`label` FROM `STUDENTS_TO_INTERESTS` si "+
+			"JOIN `INTERESTS` i ON i.`id` = si.`interest_id` "+
+			"WHERE si.`student_id` IN ("+placeholders(len(args))+") ORDER BY i.`label`",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var studentID int64
+		var interest Interest
+		if err := rows.Scan(&studentID, &interest.ID, &interest.Label); err != nil {
+			return err
+		}
+		byID[studentID].Interests = append(byID[studentID].Interests, interest)
+	}
+	return rows.Err()
+}
+
+// Save writes the names and info of the profile, creating STUDENT_INFO if the student
+// doesn't have it yet. Email and interests are left alone. The emplid and dietary
+// restrictions are only written sealed, their plaintext columns are cleared.
+func Save(ctx context.Context, q databaseutils.Querier, p *Profile) error {
+	result, err := q.ExecContext(ctx,
+		"UPDATE `STUDENTS` SET `first_name` = ?, `last_name` = ? WHERE `id` = ?",
+		p.FirstName, p.LastName, p.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		// no change also reports 0 rows, make sure the student is really missing
+		var exists bool
+		if err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM `STUDENTS` WHERE `id` = ?)", p.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+
+	sealed, err := seal(ctx, p.Emplid, p.DietaryRestrictions)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO `STUDENT_INFO` (`student_id`, `major`, `emplid_ciphertext`, `emplid_index`, `grad_year`, "+
+			"`dietary_restrictions_ciphertext`, `comments`) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE "+
+			"`major` = VALUES(`major`), `emplid` = NULL, `emplid_ciphertext` = VALUES(`emplid_ciphertext`), "+
+			"`emplid_index` = VALUES(`emplid_index`), `grad_year` = VALUES(`grad_year`), `dietary_restrictions` = NULL, "+
+			"`dietary_restrictions_ciphertext` = VALUES(`dietary_restrictions_ciphertext`), `comments` = VALUES(`comments`)",
+		p.ID, p.Major, sealed.emplid, sealed.emplidIndex, p.GradYear, sealed.dietaryRestrictions, p.Comments,
+	)
+	return err
+}
+
+// Interests lists every interest students can pick
+func Interests(ctx context.Context, q databaseutils.Querier) ([]Interest, error) {
+	rows, err := q.QueryContext(ctx, "SELECT `id`, `label` FROM `INTERESTS` ORDER BY `label`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interests := []Interest{}
+	for rows.Next() {
+		var interest Interest
+		if err := rows.Scan(&interest.ID, &interest.Label); err != nil {
+			return nil, err
+		}
+		interests = append(interests, interest)
+	}
+	return interests, rows.Err()
+}
+
+// SetInterests replaces the student's interests, unknown interest ids are an error
+func SetInterests(ctx context.Context, q databaseutils.Querier, studentID int64, interestIDs []int64) error {
+	unique := map[int64]bool{}
+	args := []any{}
+	for _, id := range interestIDs {
+		if !unique[id] {
+			unique[id] = true
+			args = append(args, id)
+		}
+	}
+
+	if len(args) > 0 {
+		var found int
+		err := q.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM `INTERESTS` WHERE `id` IN ("+placeholders(len(args))+")", args...,
+		).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if found != len(args) {
+			return fmt.Errorf("%w: unknown interest id", ErrInvalid)
+		}
+	}
+
+	if _, err := q.ExecContext(ctx, "DELETE FROM `STUDENTS_TO_INTERESTS` WHERE `student_id` = ?", studentID); err != nil {
+		return err
+	}
+	for _, id := range args {
+		_, err := q.ExecContext(ctx,
+			"INSERT INTO `STUDENTS_TO_INTERESTS` (`student_id`, `interest_id`) VALUES (?, ?)", studentID, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrInvalid wraps errors caused by bad input rather than the database
+var ErrInvalid = errors.New("invalid")
+
+// placeholders returns "?, ?, ?" for n arguments
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,284 @@
+package studentutils
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	databaseutils "cdk-infrastructure/utils/database"
+	"cdk-infrastructure/utils/database/testdb"
+	pointutils "cdk-infrastructure/utils/points"
+)
+
+func TestNameMatches(t *testing.T) {
+	names := map[int64]string{
+		1: normalizeName("Katherine", "Johnson"),
+		2: normalizeName("Katharine", "Jonson"),
+		3: normalizeName("katherine", "JOHNSON"),
+		4: normalizeName("Mary-Ann", "O'Brien"),
+		5: normalizeName("Maryann", "OBrien"),
+		6: normalizeName("Kat", "Jo"),
+		7: normalizeName("Bea", "Jo"),
+	}
+	matches := nameMatches(names)
+
+	want := map[pair]string{
+		{1, 2}: MatchFuzzy,
+		{1, 3}: MatchName,
+		{2, 3}: MatchFuzzy,
+		{4, 5}: MatchName,
+	}
+	if len(matches) != len(want) {
+		t.Errorf("nameMatches = %v, want %v", matches, want)
+	}
+	for p, reason := range want {
+		if matches[p] != reason {
+			t.Errorf("match %v = %q, want %q", p, matches[p], reason)
+		}
+	}
+
+	if d := distance("kitten", "sitting"); d != 3 {
+		t.Errorf("distance(kitten, sitting) = %d, want 3", d)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	insert := func(query string, args ...any) int64 {
+		t.Helper()
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+	student := "INSERT INTO `STUDENTS` (`first_name`, `last_name`, `email`, `cognito_sub`) VALUES (?, ?, ?, ?)"
+	ada := insert(student, "Ada", "Lovelace", "ada@myhunter.cuny.edu", "sub-ada")
+	duplicate := insert(student, "Ada", "Lovelace", "ADA@myhunter.cuny.edu ", nil)
+	other := insert(student, "Adda", "Lovelace", "adda@myhunter.cuny.edu", nil)
+	admin := insert(student, "Admin", "Istrator", "admin@myhunter.cuny.edu", "sub-admin")
+
+	insert("INSERT INTO `STUDENT_INFO` (`student_id`, `major`) VALUES (?, 'CS')", ada)
+	insert("INSERT INTO `STUDENT_INFO` (`student_id`, `emplid`, `grad_year`) VALUES (?, '12345678', 2027)", duplicate)
+	insert("INSERT INTO `STUDENT_INFO` (`student_id`, `emplid`) VALUES (?, '87654321')", other)
+
+	club := insert("INSERT INTO `CLUBS` (`club_name`) VALUES ('GWC')")
+	insert("INSERT INTO `CLUB_MEMBERS` (`student_id`, `club_id`, `role`) VALUES (?, ?, 'member')", ada, club)
+	insert("INSERT INTO `CLUB_MEMBERS` (`student_id`, `club_id`, `role`) VALUES (?, ?, 'eboard')", duplicate, club)
+
+	careers := insert("INSERT INTO `INTERESTS` (`label`) VALUES ('career')")
+	community := insert("INSERT INTO `INTERESTS` (`label`) VALUES ('community')")
+	insert("INSERT INTO `STUDENTS_TO_INTERESTS` (`student_id`, `interest_id`) VALUES (?, ?)", ada, careers)
+	insert("INSERT INTO `STUDENTS_TO_INTERESTS` (`student_id`, `interest_id`) VALUES (?, ?)", duplicate, careers)
+	insert("INSERT INTO `STUDENTS_TO_INTERESTS` (`student_id`, `interest_id`) VALUES (?, ?)", duplicate, community)
+
+	inTx := func(fn func(tx *sql.Tx) error) error {
+		return databaseutils.WithTx(ctx, db, fn)
+	}
+
+	// both were awarded points for checking in to the same event
+	event := insert("INSERT INTO `EVENTS` (`current_version_id`) VALUES (NULL)")
+	for _, id := range []int64{ada, duplicate} {
+		insert("INSERT INTO `EVENT_CHECKINS` (`event_id`, `student_id`, `checked_in_at`, `points_earned`) VALUES (?, ?, NOW(), 10)", event, id)
+		if err := inTx(func(tx *sql.Tx) error {
+			_, _, err := pointutils.Adjust(ctx, tx, id, admin, 10, "Checked in", "checkin")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := inTx(func(tx *sql.Tx) error {
+		_, _, err := pointutils.Adjust(ctx, tx, duplicate, admin, 20, "Welcome bonus", "welcome")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := Candidates(ctx, db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) == 0 || candidates[0].Student.ID != ada || candidates[0].Duplicate.ID != duplicate {
+		t.Fatalf("Candidates = %+v, want ada and her duplicate first", candidates)
+	}
+	if got := candidates[0].Reasons; len(got) != 2 || got[0] != MatchEmail || got[1] != MatchName {
+		t.Errorf("Reasons = %v, want email and name", got)
+	}
+
+	merge := func(survivorID, duplicateID int64) (*MergeRecord, error) {
+		var record *MergeRecord
+		err := inTx(func(tx *sql.Tx) error {
+			var err error
+			record, err = Merge(ctx, tx, survivorID, duplicateID, admin)
+			return err
+		})
+		return record, err
+	}
+
+	record, err := merge(ada, duplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Details.Moved["POINT_HISTORIES.member_id"] != 2 || record.Details.Moved["STUDENTS_TO_INTERESTS.student_id"] != 1 {
+		t.Errorf("Moved = %v", record.Details.Moved)
+	}
+
+	profile, err := Get(ctx, db, ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Emplid == nil || *profile.Emplid != "12345678" || profile.GradYear == nil || *profile.Major != "CS" {
+		t.Errorf("survivor = %+v, want the duplicate's emplid and grad year filled in", profile)
+	}
+	if len(profile.Interests) != 2 {
+		t.Errorf("Interests = %v, want both", profile.Interests)
+	}
+
+	var role string
+	if err := db.QueryRow("SELECT `role` FROM `CLUB_MEMBERS` WHERE `student_id` = ? AND `club_id` = ?", ada, club).Scan(&role); err != nil || role != "eboard" {
+		t.Errorf("role = %q, %v, want eboard", role, err)
+	}
+	var checkIns int
+	if err := db.QueryRow("SELECT COUNT(*) FROM `EVENT_CHECKINS` WHERE `event_id` = ?", event).Scan(&checkIns); err != nil || checkIns != 1 {
+		t.Errorf("check-ins = %d, %v, want 1", checkIns, err)
+	}
+
+	// 10 + 10 + 20 with the second check-in award taken back
+	if balance, err := pointutils.Balance(ctx, db, ada); err != nil || balance != 30 {
+		t.Errorf("Balance = %d, %v, want 30", balance, err)
+	}
+	report, err := pointutils.Verify(ctx, db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("Verify = %+v, want the survivor's ledger consistent", report.Discrepancies)
+	}
+
+	merged, err := Get(ctx, db, duplicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.MergedIntoID == nil || *merged.MergedIntoID != ada || merged.Email != nil {
+		t.Errorf("duplicate = %+v, want it emptied and pointing at ada", merged)
+	}
+	profiles, err := List(ctx, db, Filter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range profiles {
+		if p.ID == duplicate {
+			t.Error("List returned the merged duplicate")
+		}
+	}
+
+	if _, err := merge(ada, duplicate); !errors.Is(err, ErrConflict) {
+		t.Errorf("merging twice = %v, want ErrConflict", err)
+	}
+	if _, err := merge(ada, other); !errors.Is(err, ErrConflict) {
+		t.Errorf("merging different emplids = %v, want ErrConflict", err)
+	}
+	if _, err := merge(ada, admin); !errors.Is(err, ErrConflict) {
+		t.Errorf("merging two accounts = %v, want ErrConflict", err)
+	}
+
+	merges, err := Merges(ctx, db, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merges) != 1 || merges[0].Details.Duplicate == nil || *merges[0].Details.Duplicate.Email != "ADA@myhunter.cuny.edu " {
+		t.Fatalf("Merges = %+v, want one with the duplicate's snapshot", merges)
+	}
+	if snapshot := merges[0].Details.Duplicate; snapshot.Emplid == nil || *snapshot.Emplid != "[encrypted]" {
+		t.Errorf("snapshot emplid = %v, want it redacted", snapshot.Emplid)
+	}
+}
+
+func TestEncryptInfo(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	insert := func(query string, args ...any) int64 {
+		t.Helper()
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+	ada := insert("INSERT INTO `STUDENTS` (`first_name`, `email`) VALUES ('Ada', 'ada@myhunter.cuny.edu')")
+	grace := insert("INSERT INTO `STUDENTS` (`first_name`, `email`) VALUES ('Grace', 'grace@myhunter.cuny.edu')")
+	// rows from before the migration are plaintext
+	insert("INSERT INTO `STUDENT_INFO` (`student_id`, `emplid`, `dietary_restrictions`) VALUES (?, '12345678', 'vegan')", ada)
+
+	emplid := "87654321"
+	if err := Save(ctx, db, &Profile{ID: grace, Emplid: &emplid}); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := func() int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM `STUDENT_INFO` WHERE `emplid` IS NOT NULL OR `dietary_restrictions` IS NOT NULL").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := plaintext(); n != 1 {
+		t.Errorf("plaintext rows after Save = %d, want only the legacy one", n)
+	}
+	if profile, err := Get(ctx, db, ada); err != nil || *profile.Emplid != "12345678" || *profile.DietaryRestrictions != "vegan" {
+		t.Errorf("legacy profile = %+v, %v, want the plaintext read", profile, err)
+	}
+
+	report, err := EncryptInfo(ctx, db, false)
+	if err != nil || report.Sealed != 1 {
+		t.Fatalf("EncryptInfo = %+v, %v, want the legacy row sealed", report, err)
+	}
+	if n := plaintext(); n != 0 {
+		t.Errorf("plaintext rows = %d, want 0", n)
+	}
+	if report, err := EncryptInfo(ctx, db, false); err != nil || report.Sealed != 0 {
+		t.Errorf("EncryptInfo again = %+v, %v, want nothing left", report, err)
+	}
+
+	var before []byte
+	if err := db.QueryRow("SELECT `emplid_ciphertext` FROM `STUDENT_INFO` WHERE `student_id` = ?", grace).Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := EncryptInfo(ctx, db, true); err != nil || report.Sealed != 2 {
+		t.Errorf("EncryptInfo rewrap = %+v, %v, want every row", report, err)
+	}
+
+	for id, want := range map[int64]string{ada: "12345678", grace: emplid} {
+		profile, err := Get(ctx, db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Emplid == nil || *profile.Emplid != want {
+			t.Errorf("student %d emplid = %v, want %s", id, profile.Emplid, want)
+		}
+
+		index, err := EmplidIndex(ctx, " "+want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found int64
+		if err := db.QueryRow("SELECT `student_id` FROM `STUDENT_INFO` WHERE `emplid_index` = ?", index).Scan(&found); err != nil || found != id {
+			t.Errorf("lookup by emplid index = %d, %v, want %d", found, err, id)
+		}
+	}
+
+	var after []byte
+	if err := db.QueryRow("SELECT `emplid_ciphertext` FROM `STUDENT_INFO` WHERE `student_id` = ?", grace).Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(before, after) {
+		t.Error("rewrap left the ciphertext as it was")
+	}
+}
@@ -0,0 +1,117 @@
+package tokenutils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Signed tokens carry a small JSON payload that only the api can have made, like the
+// event in a check-in QR code or the student in a calendar feed url.
+//
+// A token is base64url(payload) + "." + base64url(HMAC-SHA256(key, payload)).
+
+var ErrInvalid = errors.New("invalid token")
+
+// Sign returns the token for the payload, which has to marshal to JSON
+func Sign(key []byte, payload any) string {
+	body, _ := json.Marshal(payload)
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac(key, encoded))
+}
+
+// Verify checks the token's signature and unmarshals its payload into payload. The
+// callers check the payload's fields themselves.
+func Verify(key []byte, token string, payload any) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, mac(key, encoded)) {
+		return ErrInvalid
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalid
+	}
+	if err := json.Unmarshal(body, payload); err != nil {
+		return ErrInvalid
+	}
+	return nil
+}
+
+func mac(key []byte, encoded string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
+
+// Key is a signing key kept in a Secrets Manager secret. It's loaded on first use and
+// kept for the life of the container like the database pool. A failed load isn't kept,
+// the next call tries again.
+type Key struct {
+	// Env names the environment variable with the secret's ARN
+	Env string
+
+	mu    sync.Mutex
+	value []byte
+}
+
+// NewKey returns the Key for the secret whose ARN is in env
+func NewKey(env string) *Key {
+	return &Key{Env: env}
+}
+
+// Load returns the key, reading the secret if it hasn't been yet
+func (k *Key) Load(ctx context.Context) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.value != nil {
+		return k.value, nil
+	}
+
+	arn := os.Getenv(k.Env)
+	if arn == "" {
+		return nil, fmt.Errorf("%s must be set", k.Env)
+	}
+	secret, err := getSecret(ctx, arn)
+	if err != nil {
+		return nil, fmt.Errorf("loading the secret in %s: %w", k.Env, err)
+	}
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("the secret in %s is too short", k.Env)
+	}
+
+	k.value = []byte(secret)
+	return k.value, nil
+}
+
+// getSecret reads the secret's value from Secrets Manager, tests replace it
+var getSecret = func(ctx context.Context, arn string) (string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &arn,
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", nil
+	}
+	return *out.SecretString, nil
+}
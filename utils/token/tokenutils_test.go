@@ -0,0 +1,73 @@
+package tokenutils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+type payload struct {
+	ID int64 `json:"i"`
+}
+
+func TestSignVerify(t *testing.T) {
+	token := Sign(testKey, payload{ID: 42})
+
+	var got payload
+	if err := Verify(testKey, token, &got); err != nil || got.ID != 42 {
+		t.Fatalf("Verify = %+v, %v, want 42, nil", got, err)
+	}
+	if err := Verify([]byte("another key, another key, another"), token, &got); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify with another key = %v, want ErrInvalid", err)
+	}
+
+	encoded, _, _ := strings.Cut(token, ".")
+	_, signature, _ := strings.Cut(Sign(testKey, payload{ID: 43}), ".")
+	for _, bad := range []string{
+		"",
+		"no-dot",
+		encoded,
+		encoded + ".",
+		encoded + "." + signature, // 42 with 43's signature
+		token + "x",
+	} {
+		if err := Verify(testKey, bad, &got); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Verify(%q) = %v, want ErrInvalid", bad, err)
+		}
+	}
+}
+
+func TestKeyRetriesAfterError(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_SECRET_ARN", "arn:aws:secretsmanager:us-east-1:123456789012:secret:test")
+
+	calls := 0
+	secrets := []error{errors.New("throttled"), nil}
+	original := getSecret
+	getSecret = func(ctx context.Context, arn string) (string, error) {
+		err := secrets[calls]
+		calls++
+		return string(testKey), err
+	}
+	t.Cleanup(func() { getSecret = original })
+
+	key := NewKey("TEST_SECRET_ARN")
+	if _, err := key.Load(ctx); err == nil {
+		t.Fatal("Load = nil error, want the secret's error")
+	}
+	for i := 0; i < 2; i++ {
+		if value, err := key.Load(ctx); err != nil || string(value) != string(testKey) {
+			t.Fatalf("Load = %q, %v, want the key", value, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("secret read %d times, want once more after the error and then kept", calls)
+	}
+
+	if _, err := NewKey("UNSET_SECRET_ARN").Load(ctx); err == nil {
+		t.Error("Load without the env var = nil error")
+	}
+}